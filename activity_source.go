@@ -0,0 +1,61 @@
+package ecsazrlc
+
+import (
+	"log"
+	"time"
+)
+
+// ActivityHold est une raison, indépendante des conteneurs, de considérer l'instance active
+type ActivityHold struct {
+	Source    string    `json:"source"`
+	ID        string    `json:"id"`
+	Reason    string    `json:"reason"`
+	ExpiresAt time.Time `json:"expiresAt,omitempty"` // Zéro si le maintien n'expire pas
+}
+
+// ActivitySource fournit des maintiens d'activité (baux, fichiers marqueurs...) qui
+// s'ajoutent à la détection basée sur Docker dans HasActiveAgents
+type ActivitySource interface {
+	Name() string
+	Holds() ([]ActivityHold, error)
+}
+
+// AddActivitySource ajoute une source d'activité au moniteur
+func (m *Monitor) AddActivitySource(source ActivitySource) {
+	m.sourcesMu.Lock()
+	defer m.sourcesMu.Unlock()
+	m.sources = append(m.sources, source)
+}
+
+// ActivityHolds retourne les maintiens d'activité en cours de toutes les sources
+func (m *Monitor) ActivityHolds() []ActivityHold {
+	m.sourcesMu.Lock()
+	sources := append([]ActivitySource(nil), m.sources...)
+	m.sourcesMu.Unlock()
+
+	var holds []ActivityHold
+	for _, source := range sources {
+		sourceHolds, err := source.Holds()
+		if err != nil {
+			log.Printf("Warning: activity source %s failed: %v", source.Name(), err)
+			continue
+		}
+		holds = append(holds, sourceHolds...)
+	}
+	return holds
+}
+
+// Name retourne le nom de la source d'activité des baux
+func (s *LeaseStore) Name() string {
+	return "leases"
+}
+
+// Holds retourne les baux actifs sous forme de maintiens d'activité
+func (s *LeaseStore) Holds() ([]ActivityHold, error) {
+	leases := s.Active()
+	holds := make([]ActivityHold, 0, len(leases))
+	for _, lease := range leases {
+		holds = append(holds, ActivityHold{Source: s.Name(), ID: lease.ID, Reason: lease.Reason, ExpiresAt: lease.ExpiresAt})
+	}
+	return holds, nil
+}
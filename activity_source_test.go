@@ -0,0 +1,45 @@
+package ecsazrlc
+
+import (
+	"errors"
+	"testing"
+)
+
+// fakeActivitySource est une source d'activité de test
+type fakeActivitySource struct {
+	holds []ActivityHold
+	err   error
+}
+
+func (s *fakeActivitySource) Name() string                   { return "fake" }
+func (s *fakeActivitySource) Holds() ([]ActivityHold, error) { return s.holds, s.err }
+
+// TestActivitySources vérifie la combinaison des sources d'activité avec la détection Docker
+func TestActivitySources(t *testing.T) {
+	monitor := newFakeDocker(t).monitor(t, MonitorConfig{})
+
+	failing := &fakeActivitySource{err: errors.New("unavailable")}
+	source := &fakeActivitySource{}
+	monitor.AddActivitySource(failing)
+	monitor.AddActivitySource(source)
+
+	if active, _ := monitor.HasActiveAgents(); active {
+		t.Fatal("No agent and no hold: instance should be inactive")
+	}
+
+	source.holds = []ActivityHold{{Source: "fake", ID: "deploy", Reason: "deployment"}}
+	if active, _ := monitor.HasActiveAgents(); !active {
+		t.Error("An activity hold should keep the instance active")
+	}
+
+	// Les baux sont une source comme les autres
+	source.holds = nil
+	lease, err := monitor.Leases().Acquire(DefaultMaxLeaseTTL, "approval", "")
+	if err != nil {
+		t.Fatalf("Acquire() error: %v", err)
+	}
+	holds := monitor.ActivityHolds()
+	if len(holds) != 1 || holds[0].Source != "leases" || holds[0].ID != lease.ID {
+		t.Errorf("Unexpected holds: %+v", holds)
+	}
+}
@@ -0,0 +1,268 @@
+package ecsazrlc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+// Nombre maximal d'instances acceptées par appel ECS
+const (
+	describeInstancesBatch = 100
+	updateInstancesBatch   = 10
+)
+
+// InstanceVerdict indique si une instance peut être terminée
+type InstanceVerdict string
+
+const (
+	VerdictSafe    InstanceVerdict = "safe"
+	VerdictBusy    InstanceVerdict = "busy"
+	VerdictStale   InstanceVerdict = "stale"
+	VerdictUnknown InstanceVerdict = "unknown"
+)
+
+// InstanceAdvice décrit l'état d'activité d'une instance du cluster
+type InstanceAdvice struct {
+	ContainerInstanceARN string          `json:"containerInstanceArn"`
+	EC2InstanceID        string          `json:"ec2InstanceId"`
+	Status               string          `json:"status"`
+	Activity             string          `json:"activity"`
+	LastCheck            *time.Time      `json:"lastCheck,omitempty"`
+	RunningTasks         int32           `json:"runningTasks"`
+	Verdict              InstanceVerdict `json:"verdict"`
+	Reason               string          `json:"reason"`
+}
+
+// ClusterAdvice regroupe les recommandations pour l'ensemble du cluster
+type ClusterAdvice struct {
+	Cluster     string           `json:"cluster"`
+	GeneratedAt time.Time        `json:"generatedAt"`
+	Instances   []InstanceAdvice `json:"instances"`
+}
+
+// Advisor lit les attributs d'activité du cluster pour conseiller la réduction de capacité
+type Advisor struct {
+	ecsClient   *ecs.Client
+	clusterName string
+	staleAfter  time.Duration
+	ctx         context.Context
+}
+
+// NewAdvisor crée un conseiller pour le cluster donné
+func NewAdvisor(clusterName string, staleAfter time.Duration) (*Advisor, error) {
+	ctx := context.Background()
+
+	cfg, err := loadAWSConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Advisor{
+		ecsClient:   ecs.NewFromConfig(cfg),
+		clusterName: clusterName,
+		staleAfter:  staleAfter,
+		ctx:         ctx,
+	}, nil
+}
+
+// listClusterInstances décrit toutes les instances de conteneur du cluster (paginé)
+func listClusterInstances(ctx context.Context, client *ecs.Client, clusterName string) ([]types.ContainerInstance, error) {
+	var arns []string
+	paginator := ecs.NewListContainerInstancesPaginator(client, &ecs.ListContainerInstancesInput{
+		Cluster: aws.String(clusterName),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list container instances: %w", err)
+		}
+		arns = append(arns, page.ContainerInstanceArns...)
+	}
+
+	var instances []types.ContainerInstance
+	for start := 0; start < len(arns); start += describeInstancesBatch {
+		end := min(start+describeInstancesBatch, len(arns))
+		result, err := client.DescribeContainerInstances(ctx, &ecs.DescribeContainerInstancesInput{
+			Cluster:            aws.String(clusterName),
+			ContainerInstances: arns[start:end],
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe container instances: %w", err)
+		}
+		instances = append(instances, result.ContainerInstances...)
+	}
+
+	return instances, nil
+}
+
+// Advise calcule le verdict de chaque instance du cluster
+func (a *Advisor) Advise() (*ClusterAdvice, error) {
+	instances, err := listClusterInstances(a.ctx, a.ecsClient, a.clusterName)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	advice := &ClusterAdvice{
+		Cluster:     a.clusterName,
+		GeneratedAt: now,
+	}
+	for _, instance := range instances {
+		advice.Instances = append(advice.Instances, classifyInstance(instance, now, a.staleAfter))
+	}
+
+	return advice, nil
+}
+
+// instanceAttribute retourne la valeur d'un attribut de l'instance
+func instanceAttribute(instance types.ContainerInstance, name string) (string, bool) {
+	for _, attr := range instance.Attributes {
+		if aws.ToString(attr.Name) == name {
+			return aws.ToString(attr.Value), true
+		}
+	}
+	return "", false
+}
+
+// classifyInstance détermine le verdict d'une instance à partir de ses attributs
+func classifyInstance(instance types.ContainerInstance, now time.Time, staleAfter time.Duration) InstanceAdvice {
+	advice := InstanceAdvice{
+		ContainerInstanceARN: aws.ToString(instance.ContainerInstanceArn),
+		EC2InstanceID:        aws.ToString(instance.Ec2InstanceId),
+		Status:               aws.ToString(instance.Status),
+		RunningTasks:         instance.RunningTasksCount,
+	}
+
+	activity, hasActivity := instanceAttribute(instance, attrActivity)
+	lastCheckValue, hasLastCheck := instanceAttribute(instance, attrLastCheck)
+	advice.Activity = activity
+
+	if !hasActivity || !hasLastCheck {
+		advice.Verdict = VerdictUnknown
+		advice.Reason = "no activity attributes reported"
+		return advice
+	}
+
+	seconds, err := strconv.ParseInt(lastCheckValue, 10, 64)
+	if err != nil {
+		advice.Verdict = VerdictUnknown
+		advice.Reason = fmt.Sprintf("invalid %s value %q", attrLastCheck, lastCheckValue)
+		return advice
+	}
+	lastCheck := time.Unix(seconds, 0)
+	advice.LastCheck = &lastCheck
+
+	if staleAfter > 0 && now.Sub(lastCheck) > staleAfter {
+		advice.Verdict = VerdictStale
+		advice.Reason = fmt.Sprintf("last check %s ago", now.Sub(lastCheck).Truncate(time.Second))
+		return advice
+	}
+
+	switch activity {
+	case "active":
+		advice.Verdict = VerdictBusy
+		advice.Reason = "Azure agents are present"
+	case "inactive":
+		advice.Verdict = VerdictSafe
+		advice.Reason = "no active Azure agent"
+		if _, capped := instanceAttribute(instance, attrProtectionCapped); capped {
+			advice.Reason = "protection capped after continuous activity, agents may still look busy"
+		} else if idle, _ := instanceAttribute(instance, attrIdleAgents); idle != "" && idle != "0" {
+			advice.Reason = fmt.Sprintf("%s idle agent(s) not needed by the cluster warm pool", idle)
+		}
+	default:
+		advice.Verdict = VerdictUnknown
+		advice.Reason = fmt.Sprintf("unexpected activity value %q", activity)
+	}
+
+	return advice
+}
+
+// Count retourne le nombre d'instances ayant le verdict donné
+func (c *ClusterAdvice) Count(verdict InstanceVerdict) int {
+	count := 0
+	for _, instance := range c.Instances {
+		if instance.Verdict == verdict {
+			count++
+		}
+	}
+	return count
+}
+
+// WriteJSON écrit les recommandations au format JSON
+func (c *ClusterAdvice) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(c)
+}
+
+// WriteTable écrit les recommandations sous forme de tableau
+func (c *ClusterAdvice) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "INSTANCE\tEC2\tSTATUS\tACTIVITY\tTASKS\tVERDICT\tREASON")
+	for _, instance := range c.Instances {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+			instance.ContainerInstanceARN,
+			instance.EC2InstanceID,
+			instance.Status,
+			instance.Activity,
+			instance.RunningTasks,
+			instance.Verdict,
+			instance.Reason)
+	}
+	fmt.Fprintf(tw, "\nsafe: %d  busy: %d  stale: %d  unknown: %d\n",
+		c.Count(VerdictSafe), c.Count(VerdictBusy), c.Count(VerdictStale), c.Count(VerdictUnknown))
+	return tw.Flush()
+}
+
+// DrainSafe passe les instances sûres (et encore ACTIVE) en DRAINING par lots
+func (a *Advisor) DrainSafe(advice *ClusterAdvice, batchSize int, batchInterval time.Duration) ([]string, error) {
+	if batchSize <= 0 || batchSize > updateInstancesBatch {
+		batchSize = updateInstancesBatch
+	}
+
+	var candidates []string
+	for _, instance := range advice.Instances {
+		if instance.Verdict == VerdictSafe && instance.Status == string(types.ContainerInstanceStatusActive) {
+			candidates = append(candidates, instance.ContainerInstanceARN)
+		}
+	}
+
+	var drained []string
+	for start := 0; start < len(candidates); start += batchSize {
+		if start > 0 && batchInterval > 0 {
+			time.Sleep(batchInterval)
+		}
+
+		end := min(start+batchSize, len(candidates))
+		batch := candidates[start:end]
+		result, err := a.ecsClient.UpdateContainerInstancesState(a.ctx, &ecs.UpdateContainerInstancesStateInput{
+			Cluster:            aws.String(a.clusterName),
+			ContainerInstances: batch,
+			Status:             types.ContainerInstanceStatusDraining,
+		})
+		if err != nil {
+			return drained, fmt.Errorf("failed to drain container instances: %w", err)
+		}
+
+		for _, failure := range result.Failures {
+			log.Printf("Warning: failed to drain %s: %s", aws.ToString(failure.Arn), aws.ToString(failure.Reason))
+		}
+		for _, instance := range result.ContainerInstances {
+			drained = append(drained, aws.ToString(instance.ContainerInstanceArn))
+		}
+		log.Printf("Drained batch of %d container instance(s)", len(result.ContainerInstances))
+	}
+
+	return drained, nil
+}
@@ -0,0 +1,175 @@
+package ecsazrlc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+// TestClassifyInstance vérifie le verdict calculé à partir des attributs
+func TestClassifyInstance(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	fresh := fmt.Sprintf("%d", now.Add(-30*time.Second).Unix())
+	old := fmt.Sprintf("%d", now.Add(-time.Hour).Unix())
+
+	tests := []struct {
+		name       string
+		attributes map[string]string
+		expected   InstanceVerdict
+	}{
+		{
+			name:       "Idle instance",
+			attributes: map[string]string{attrActivity: "inactive", attrLastCheck: fresh},
+			expected:   VerdictSafe,
+		},
+		{
+			name:       "Busy instance",
+			attributes: map[string]string{attrActivity: "active", attrLastCheck: fresh},
+			expected:   VerdictBusy,
+		},
+		{
+			name:       "Capped protection",
+			attributes: map[string]string{attrActivity: "inactive", attrLastCheck: fresh, attrProtectionCapped: fresh},
+			expected:   VerdictSafe,
+		},
+		{
+			name:       "Idle agents beyond the warm pool",
+			attributes: map[string]string{attrActivity: "inactive", attrLastCheck: fresh, attrIdleAgents: "2"},
+			expected:   VerdictSafe,
+		},
+		{
+			name:       "Stale heartbeat",
+			attributes: map[string]string{attrActivity: "inactive", attrLastCheck: old},
+			expected:   VerdictStale,
+		},
+		{
+			name:     "No attributes",
+			expected: VerdictUnknown,
+		},
+		{
+			name:       "Invalid timestamp",
+			attributes: map[string]string{attrActivity: "active", attrLastCheck: "yesterday"},
+			expected:   VerdictUnknown,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instance := types.ContainerInstance{
+				ContainerInstanceArn: aws.String("arn:instance"),
+				Status:               aws.String("ACTIVE"),
+			}
+			for name, value := range tt.attributes {
+				instance.Attributes = append(instance.Attributes, types.Attribute{
+					Name:  aws.String(name),
+					Value: aws.String(value),
+				})
+			}
+
+			advice := classifyInstance(instance, now, 5*time.Minute)
+			if advice.Verdict != tt.expected {
+				t.Errorf("classifyInstance() = %s (%s), want %s", advice.Verdict, advice.Reason, tt.expected)
+			}
+		})
+	}
+}
+
+// TestAdvisorAdviseAndDrain vérifie la pagination et le drain par lots contre un faux ECS
+func TestAdvisorAdviseAndDrain(t *testing.T) {
+	fake := newFakeECS(t)
+	now := fmt.Sprintf("%d", time.Now().Unix())
+
+	fake.handle("ListContainerInstances", func(body map[string]interface{}) interface{} {
+		if body["nextToken"] == nil {
+			return map[string]interface{}{
+				"containerInstanceArns": []string{"arn:1", "arn:2"},
+				"nextToken":             "page-2",
+			}
+		}
+		return map[string]interface{}{"containerInstanceArns": []string{"arn:3", "arn:4"}}
+	})
+	fake.handle("DescribeContainerInstances", func(body map[string]interface{}) interface{} {
+		return map[string]interface{}{
+			"containerInstances": []interface{}{
+				fakeInstance("arn:1", "i-1", "ACTIVE", map[string]string{attrActivity: "inactive", attrLastCheck: now}),
+				fakeInstance("arn:2", "i-2", "ACTIVE", map[string]string{attrActivity: "active", attrLastCheck: now}),
+				fakeInstance("arn:3", "i-3", "ACTIVE", nil),
+				fakeInstance("arn:4", "i-4", "ACTIVE", map[string]string{attrActivity: "inactive", attrLastCheck: now}),
+			},
+		}
+	})
+	fake.handle("UpdateContainerInstancesState", func(body map[string]interface{}) interface{} {
+		var instances []interface{}
+		for _, arn := range body["containerInstances"].([]interface{}) {
+			instances = append(instances, map[string]interface{}{"containerInstanceArn": arn, "status": "DRAINING"})
+		}
+		return map[string]interface{}{"containerInstances": instances}
+	})
+
+	advisor := &Advisor{
+		ecsClient:   fake.client(),
+		clusterName: "test-cluster",
+		staleAfter:  5 * time.Minute,
+		ctx:         context.Background(),
+	}
+
+	advice, err := advisor.Advise()
+	if err != nil {
+		t.Fatalf("Advise() error: %v", err)
+	}
+	if len(fake.callsTo("ListContainerInstances")) != 2 {
+		t.Errorf("Expected 2 ListContainerInstances pages, got %d", len(fake.callsTo("ListContainerInstances")))
+	}
+	if advice.Count(VerdictSafe) != 2 || advice.Count(VerdictBusy) != 1 || advice.Count(VerdictUnknown) != 1 {
+		t.Errorf("Unexpected verdicts: %+v", advice.Instances)
+	}
+
+	drained, err := advisor.DrainSafe(advice, 1, 0)
+	if err != nil {
+		t.Fatalf("DrainSafe() error: %v", err)
+	}
+	if len(drained) != 2 {
+		t.Errorf("Expected 2 drained instances, got %v", drained)
+	}
+	if calls := fake.callsTo("UpdateContainerInstancesState"); len(calls) != 2 {
+		t.Errorf("Expected 2 drain batches, got %d", len(calls))
+	}
+}
+
+// TestClusterAdviceOutput vérifie les formats de sortie table et JSON
+func TestClusterAdviceOutput(t *testing.T) {
+	advice := &ClusterAdvice{
+		Cluster: "test-cluster",
+		Instances: []InstanceAdvice{
+			{ContainerInstanceARN: "arn:1", EC2InstanceID: "i-1", Verdict: VerdictSafe},
+			{ContainerInstanceARN: "arn:2", EC2InstanceID: "i-2", Verdict: VerdictBusy},
+		},
+	}
+
+	var table bytes.Buffer
+	if err := advice.WriteTable(&table); err != nil {
+		t.Fatalf("WriteTable() error: %v", err)
+	}
+	if !strings.Contains(table.String(), "safe: 1  busy: 1") {
+		t.Errorf("Unexpected table summary:\n%s", table.String())
+	}
+
+	var out bytes.Buffer
+	if err := advice.WriteJSON(&out); err != nil {
+		t.Fatalf("WriteJSON() error: %v", err)
+	}
+	var decoded ClusterAdvice
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatalf("Invalid JSON output: %v", err)
+	}
+	if len(decoded.Instances) != 2 || decoded.Instances[1].Verdict != VerdictBusy {
+		t.Errorf("Unexpected decoded advice: %+v", decoded)
+	}
+}
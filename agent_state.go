@@ -0,0 +1,216 @@
+package ecsazrlc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// Processus lancés par l'agent Azure DevOps
+const (
+	agentListenerProcess = "Agent.Listener"
+	agentWorkerProcess   = "Agent.Worker"
+)
+
+// AgentState décrit l'état d'occupation d'un agent Azure détecté
+type AgentState struct {
+	ActivityEvent
+	Busy      bool
+	Reason    string
+	BusySince time.Time // Début de la période d'occupation continue (zéro si inactif)
+	Overdue   bool      // Occupé au-delà de la durée maximale de sa règle JobOverdue
+	Released  bool      // Toujours occupé, mais ne protège plus l'instance (règle JobOverdue "release")
+}
+
+// JobDuration retourne la durée de la période d'occupation en cours (0 si inactif)
+func (s AgentState) JobDuration(now time.Time) time.Duration {
+	if s.BusySince.IsZero() {
+		return 0
+	}
+	return now.Sub(s.BusySince)
+}
+
+// ProbeResult est le résultat d'une sonde d'occupation
+type ProbeResult struct {
+	Known  bool   // La sonde a pu se prononcer
+	Busy   bool   // L'agent exécute un job
+	Reason string // Explication lisible du résultat
+}
+
+// BusyProbe détermine si un agent exécute actuellement un job
+type BusyProbe interface {
+	Name() string
+	Probe(ctx context.Context, agent ActivityEvent) (ProbeResult, error)
+}
+
+// processProbe détecte un job en cours via la présence du processus Agent.Worker
+type processProbe struct {
+	top func(ctx context.Context, containerID string) (container.TopResponse, error)
+}
+
+// newProcessProbe crée une sonde basée sur la liste des processus du conteneur
+func newProcessProbe(m *Monitor) *processProbe {
+	return &processProbe{
+		top: func(ctx context.Context, containerID string) (container.TopResponse, error) {
+			var top container.TopResponse
+			err := m.dockerCall(containerID, CapabilityTop, func() (err error) {
+				top, err = m.runtime.Top(ctx, containerID)
+				return err
+			})
+			return top, err
+		},
+	}
+}
+
+// Name retourne le nom de la sonde
+func (p *processProbe) Name() string {
+	return "process"
+}
+
+// Probe inspecte les processus du conteneur à la recherche de Agent.Worker
+func (p *processProbe) Probe(ctx context.Context, agent ActivityEvent) (ProbeResult, error) {
+	top, err := p.top(ctx, agent.ContainerID)
+	if errors.Is(err, ErrCapabilityUnavailable) {
+		// Processus non consultables (proxy du socket) : laisser les sondes suivantes se prononcer
+		return ProbeResult{}, nil
+	}
+	if err != nil {
+		return ProbeResult{}, fmt.Errorf("failed to list processes: %w", err)
+	}
+
+	// Colonne contenant la ligne de commande
+	cmdIndex := len(top.Titles) - 1
+	for i, title := range top.Titles {
+		if title == "CMD" || title == "COMMAND" {
+			cmdIndex = i
+		}
+	}
+
+	listenerFound := false
+	for _, process := range top.Processes {
+		if cmdIndex < 0 || cmdIndex >= len(process) {
+			continue
+		}
+		cmd := process[cmdIndex]
+		if strings.Contains(cmd, agentWorkerProcess) {
+			return ProbeResult{Known: true, Busy: true, Reason: agentWorkerProcess + " process running"}, nil
+		}
+		if strings.Contains(cmd, agentListenerProcess) {
+			listenerFound = true
+		}
+	}
+
+	if listenerFound {
+		return ProbeResult{Known: true, Busy: false, Reason: "only " + agentListenerProcess + " running"}, nil
+	}
+	return ProbeResult{}, nil
+}
+
+// samplingPass regroupe les conteneurs et agents d'un relevé (GetAgentStates), partagés par les
+// sondes pour ne lister les conteneurs qu'une fois par relevé plutôt qu'une fois par agent
+type samplingPass struct {
+	containers []container.Summary
+	agents     []ActivityEvent
+}
+
+type samplingPassKey struct{}
+
+// withSamplingPass associe un relevé au contexte passé aux sondes
+func withSamplingPass(ctx context.Context, pass *samplingPass) context.Context {
+	return context.WithValue(ctx, samplingPassKey{}, pass)
+}
+
+// samplingPassOf retourne le relevé en cours ; une sonde appelée hors relevé liste elle-même les conteneurs
+func (m *Monitor) samplingPassOf(ctx context.Context) (*samplingPass, error) {
+	if pass, ok := ctx.Value(samplingPassKey{}).(*samplingPass); ok {
+		return pass, nil
+	}
+	containers, err := m.listContainers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &samplingPass{containers: containers, agents: m.azureAgents(containers)}, nil
+}
+
+// probeAgent évalue les sondes dans l'ordre ; la première qui se prononce l'emporte
+func (m *Monitor) probeAgent(agent ActivityEvent) AgentState {
+	return m.probeAgentIn(m.ctx, agent)
+}
+
+// probeAgentIn évalue les sondes avec le contexte d'un relevé
+func (m *Monitor) probeAgentIn(ctx context.Context, agent ActivityEvent) AgentState {
+	for _, probe := range m.probes {
+		result, err := probe.Probe(ctx, agent)
+		if err != nil {
+			log.Printf("Warning: %s probe failed for %s: %v", probe.Name(), agent.ContainerName, err)
+			continue
+		}
+		if result.Known {
+			return AgentState{
+				ActivityEvent: agent,
+				Busy:          result.Busy,
+				Reason:        fmt.Sprintf("%s: %s", probe.Name(), result.Reason),
+			}
+		}
+	}
+
+	// Sans information, l'agent est considéré occupé par prudence
+	return AgentState{ActivityEvent: agent, Busy: true, Reason: "undetermined, assumed busy"}
+}
+
+// GetAgentStates retourne l'état d'occupation de chaque agent Azure en cours d'exécution
+func (m *Monitor) GetAgentStates() ([]AgentState, error) {
+	containers, err := m.listContainers(m.ctx)
+	if err != nil {
+		return nil, err
+	}
+	pass := &samplingPass{containers: containers, agents: m.azureAgents(containers)}
+	ctx := withSamplingPass(m.ctx, pass)
+
+	states := make([]AgentState, 0, len(pass.agents))
+	for _, agent := range pass.agents {
+		states = append(states, m.probeAgentIn(ctx, agent))
+	}
+	now := time.Now()
+	m.jobs.observe(states, now)
+	if m.overdue != nil {
+		m.overdue.apply(m, states, now)
+	}
+	return states, nil
+}
+
+// jobClock mémorise le début de la période d'occupation continue de chaque agent
+type jobClock struct {
+	mu        sync.Mutex
+	busySince map[string]time.Time
+}
+
+// newJobClock crée un suivi vide
+func newJobClock() *jobClock {
+	return &jobClock{busySince: map[string]time.Time{}}
+}
+
+// observe renseigne BusySince d'après un relevé complet ; les agents inactifs ou disparus sont oubliés
+func (c *jobClock) observe(states []AgentState, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	busy := make(map[string]time.Time, len(states))
+	for i := range states {
+		if !states[i].Busy {
+			continue
+		}
+		since, ok := c.busySince[states[i].ContainerID]
+		if !ok {
+			since = now
+		}
+		busy[states[i].ContainerID] = since
+		states[i].BusySince = since
+	}
+	c.busySince = busy
+}
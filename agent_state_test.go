@@ -0,0 +1,88 @@
+package ecsazrlc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// TestProcessProbe vérifie la détection d'un job via les processus de l'agent
+func TestProcessProbe(t *testing.T) {
+	tests := []struct {
+		name      string
+		titles    []string
+		processes []string
+		expected  ProbeResult
+	}{
+		{
+			name:      "Worker running",
+			titles:    []string{"UID", "PID", "CMD"},
+			processes: []string{"/azp/bin/Agent.Listener run", "/azp/bin/Agent.Worker spawnclient 1 2"},
+			expected:  ProbeResult{Known: true, Busy: true},
+		},
+		{
+			name:      "Listener only",
+			titles:    []string{"PID", "USER", "COMMAND"},
+			processes: []string{"/azp/bin/Agent.Listener run"},
+			expected:  ProbeResult{Known: true, Busy: false},
+		},
+		{
+			name:      "Unrecognised runner",
+			titles:    []string{"UID", "PID", "CMD"},
+			processes: []string{"/usr/bin/custom-runner"},
+			expected:  ProbeResult{Known: false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			probe := &processProbe{
+				top: func(ctx context.Context, containerID string) (container.TopResponse, error) {
+					top := container.TopResponse{Titles: tt.titles}
+					for _, cmd := range tt.processes {
+						// La ligne de commande est toujours la dernière colonne
+						row := make([]string, len(tt.titles))
+						row[len(row)-1] = cmd
+						top.Processes = append(top.Processes, row)
+					}
+					return top, nil
+				},
+			}
+
+			result, err := probe.Probe(context.Background(), ActivityEvent{ContainerID: "abc"})
+			if err != nil {
+				t.Fatalf("Probe() error: %v", err)
+			}
+			if result.Known != tt.expected.Known || result.Busy != tt.expected.Busy {
+				t.Errorf("Probe() = %+v, want %+v", result, tt.expected)
+			}
+		})
+	}
+}
+
+// TestGetAgentStates vérifie l'état d'occupation calculé contre un faux démon Docker
+func TestGetAgentStates(t *testing.T) {
+	fake := newFakeDocker(t,
+		&fakeContainer{ID: "aaaaaaaaaaaa0001", Name: "agent-busy", Image: "azp-agent:latest", Processes: []string{"Agent.Listener", "Agent.Worker"}},
+		&fakeContainer{ID: "bbbbbbbbbbbb0002", Name: "agent-idle", Image: "azp-agent:latest", Processes: []string{"Agent.Listener"}},
+		&fakeContainer{ID: "cccccccccccc0003", Name: "agent-other", Image: "azp-agent:latest", Processes: []string{"sleep"}},
+		&fakeContainer{ID: "dddddddddddd0004", Name: "nginx", Image: "nginx:latest"},
+	)
+	monitor := fake.monitor(t, MonitorConfig{})
+
+	states, err := monitor.GetAgentStates()
+	if err != nil {
+		t.Fatalf("GetAgentStates() error: %v", err)
+	}
+	if len(states) != 3 {
+		t.Fatalf("Expected 3 agents, got %d", len(states))
+	}
+
+	expected := map[string]bool{"agent-busy": true, "agent-idle": false, "agent-other": true}
+	for _, state := range states {
+		if state.Busy != expected[state.ContainerName] {
+			t.Errorf("%s busy = %v (%s), want %v", state.ContainerName, state.Busy, state.Reason, expected[state.ContainerName])
+		}
+	}
+}
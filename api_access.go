@@ -0,0 +1,308 @@
+package ecsazrlc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/containerd/errdefs"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/client"
+)
+
+// APICapability désigne un appel de l'API Docker utilisé par ecsazrlc
+type APICapability string
+
+const (
+	CapabilityPing        APICapability = "ping"         // GET /_ping
+	CapabilityVersion     APICapability = "version"      // GET /version
+	CapabilityList        APICapability = "list"         // GET /containers/json
+	CapabilityInspect     APICapability = "inspect"      // GET /containers/{id}/json
+	CapabilityEvents      APICapability = "events"       // GET /events
+	CapabilityTop         APICapability = "top"          // GET /containers/{id}/top
+	CapabilityStats       APICapability = "stats"        // GET /containers/{id}/stats
+	CapabilityLogs        APICapability = "logs"         // GET /containers/{id}/logs
+	CapabilityExecInspect APICapability = "exec-inspect" // GET /exec/{id}/json
+	CapabilityStop        APICapability = "stop"         // POST /containers/{id}/stop
+)
+
+// ErrCapabilityUnavailable signale un appel refusé par le démon ou par un proxy du socket
+var ErrCapabilityUnavailable = errors.New("Docker API capability unavailable")
+
+// ID inexistant utilisé par l'auto-diagnostic : 404 signifie autorisé, 403 refusé
+const selfCheckID = "ecsazrlc-self-check"
+
+// APIEndpoint est un appel de l'API Docker nécessaire à la configuration
+type APIEndpoint struct {
+	Capability   APICapability `json:"capability"`
+	Method       string        `json:"method"`
+	Path         string        `json:"path"`
+	Feature      string        `json:"feature"`      // Fonction d'ecsazrlc qui en dépend
+	Required     bool          `json:"required"`     // Indispensable (sinon la fonction est dégradée)
+	ProxySection string        `json:"proxySection"` // Variable de docker-socket-proxy qui l'autorise
+}
+
+// RequiredAPIEndpoints liste les appels de l'API Docker nécessaires à la configuration ;
+// stopAgents indique si les agents sont arrêtés pendant un drain (--drain-action=stop-after-job)
+func RequiredAPIEndpoints(config MonitorConfig, stopAgents bool) []APIEndpoint {
+	endpoints := []APIEndpoint{
+		{CapabilityPing, "GET", "/_ping", "API version negotiation", true, "PING"},
+	}
+	if len(config.Endpoints) > 0 || config.Runtime != RuntimeDocker {
+		endpoints = append(endpoints, APIEndpoint{CapabilityVersion, "GET", "/version", "Podman detection", false, "VERSION"})
+	}
+	endpoints = append(endpoints,
+		APIEndpoint{CapabilityList, "GET", "/containers/json", "agent discovery", true, "CONTAINERS"},
+		APIEndpoint{CapabilityInspect, "GET", "/containers/{id}/json", "agent discovery", true, "CONTAINERS"},
+		APIEndpoint{CapabilityEvents, "GET", "/events", "activity events", true, "EVENTS"},
+		APIEndpoint{CapabilityTop, "GET", "/containers/{id}/top", "busy detection from processes", false, "CONTAINERS"},
+		APIEndpoint{CapabilityExecInspect, "GET", "/exec/{id}/json", "exec session job metadata", false, "EXEC"},
+	)
+	if config.JobLogPatterns != nil {
+		endpoints = append(endpoints, APIEndpoint{CapabilityLogs, "GET", "/containers/{id}/logs", "job detection from agent logs", false, "CONTAINERS"})
+	}
+	if config.Stats != nil {
+		endpoints = append(endpoints, APIEndpoint{CapabilityStats, "GET", "/containers/{id}/stats", "resource usage fallback", false, "CONTAINERS"})
+	}
+	switch {
+	case stopAgents:
+		endpoints = append(endpoints, APIEndpoint{CapabilityStop, "POST", "/containers/{id}/stop", "stopping idle agents on drain", false, "ALLOW_STOP"})
+	case stopsOverdueAgents(config.OverdueRules):
+		endpoints = append(endpoints, APIEndpoint{CapabilityStop, "POST", "/containers/{id}/stop", "stopping overdue agents", false, "ALLOW_STOP"})
+	}
+	return endpoints
+}
+
+// ProxyEnvironment retourne les variables de docker-socket-proxy autorisant les appels
+func ProxyEnvironment(endpoints []APIEndpoint) []string {
+	sections := map[string]bool{}
+	for _, endpoint := range endpoints {
+		sections[endpoint.ProxySection] = true
+	}
+	var env []string
+	for section := range sections {
+		env = append(env, section+"=1")
+	}
+	sort.Strings(env)
+	return env
+}
+
+// isForbidden indique si une erreur de l'API correspond à un refus d'accès
+func isForbidden(err error) bool {
+	return errdefs.IsPermissionDenied(err) || errdefs.IsUnauthorized(err)
+}
+
+// UnavailableCapability est un appel refusé depuis le démarrage
+type UnavailableCapability struct {
+	Capability APICapability `json:"capability"`
+	Endpoint   string        `json:"endpoint,omitempty"`
+	Error      string        `json:"error"`
+}
+
+// apiAccess mémorise les appels refusés par endpoint, pour ne plus les tenter
+type apiAccess struct {
+	mu     sync.Mutex
+	denied map[string]map[APICapability]string // endpoint -> capacité -> erreur
+}
+
+// allowed indique si un appel n'a pas encore été refusé sur l'endpoint
+func (a *apiAccess) allowed(endpoint string, capability APICapability) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_, denied := a.denied[endpoint][capability]
+	return !denied
+}
+
+// check enregistre un refus d'accès et retourne ErrCapabilityUnavailable à sa place ;
+// les autres erreurs sont retournées telles quelles
+func (a *apiAccess) check(endpoint string, capability APICapability, err error) error {
+	if err == nil || !isForbidden(err) {
+		return err
+	}
+
+	a.mu.Lock()
+	if a.denied == nil {
+		a.denied = map[string]map[APICapability]string{}
+	}
+	if a.denied[endpoint] == nil {
+		a.denied[endpoint] = map[APICapability]string{}
+	}
+	_, known := a.denied[endpoint][capability]
+	a.denied[endpoint][capability] = err.Error()
+	a.mu.Unlock()
+
+	if !known {
+		log.Printf("Warning: Docker API capability %q forbidden on %s (socket proxy or daemon authorization): %v", capability, endpoint, err)
+	}
+	return fmt.Errorf("%w: %s", ErrCapabilityUnavailable, capability)
+}
+
+// unavailable retourne les appels refusés, triés par endpoint puis capacité
+func (a *apiAccess) unavailable() []UnavailableCapability {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var list []UnavailableCapability
+	for endpoint, capabilities := range a.denied {
+		for capability, err := range capabilities {
+			list = append(list, UnavailableCapability{Capability: capability, Endpoint: endpoint, Error: err})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Endpoint != list[j].Endpoint {
+			return list[i].Endpoint < list[j].Endpoint
+		}
+		return list[i].Capability < list[j].Capability
+	})
+	return list
+}
+
+// UnavailableCapabilities retourne les appels de l'API Docker refusés depuis le démarrage
+func (m *Monitor) UnavailableCapabilities() []UnavailableCapability {
+	return m.api.unavailable()
+}
+
+// dockerCall vérifie qu'un appel lié à un conteneur est autorisé, l'exécute et enregistre un éventuel refus
+func (m *Monitor) dockerCall(containerID string, capability APICapability, call func() error) error {
+	endpoint := m.runtime.Endpoint(containerID)
+	if !m.api.allowed(endpoint, capability) {
+		return fmt.Errorf("%w: %s", ErrCapabilityUnavailable, capability)
+	}
+	return m.api.check(endpoint, capability, call())
+}
+
+// APICheck est le résultat de l'auto-diagnostic d'un appel sur un endpoint
+type APICheck struct {
+	APIEndpoint
+	Endpoint string `json:"endpoint"`
+	Allowed  bool   `json:"allowed"`
+	Error    string `json:"error,omitempty"` // Refus ou erreur inattendue
+}
+
+// dockerEndpoints retourne les démons Docker interrogés par le moniteur
+func (m *Monitor) dockerEndpoints() []*dockerRuntime {
+	switch runtime := m.runtime.(type) {
+	case *dockerRuntime:
+		return []*dockerRuntime{runtime}
+	case *multiRuntime:
+		return runtime.endpoints
+	}
+	return nil
+}
+
+// SelfCheck tente chaque appel nécessaire sur chaque démon, sans effet de bord :
+// les appels visant un conteneur utilisent un ID inexistant (404 = autorisé)
+func (m *Monitor) SelfCheck(ctx context.Context, endpoints []APIEndpoint) ([]APICheck, error) {
+	dockers := m.dockerEndpoints()
+	if len(dockers) == 0 {
+		return nil, fmt.Errorf("self-check requires the Docker API, not available with %s", m.runtime.Name())
+	}
+
+	var checks []APICheck
+	for _, docker := range dockers {
+		for _, endpoint := range endpoints {
+			err := probeCapability(ctx, docker.client, endpoint.Capability)
+			check := APICheck{APIEndpoint: endpoint, Endpoint: docker.endpoint, Allowed: err == nil || errdefs.IsNotFound(err)}
+			if !check.Allowed {
+				check.Error = err.Error()
+			}
+			checks = append(checks, check)
+		}
+	}
+	return checks, nil
+}
+
+// probeCapability exécute l'appel correspondant à une capacité
+func probeCapability(ctx context.Context, cli *client.Client, capability APICapability) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	switch capability {
+	case CapabilityPing:
+		_, err := cli.Ping(ctx)
+		return err
+	case CapabilityVersion:
+		_, err := cli.ServerVersion(ctx)
+		return err
+	case CapabilityList:
+		_, err := cli.ContainerList(ctx, container.ListOptions{Limit: 1})
+		return err
+	case CapabilityInspect:
+		_, err := cli.ContainerInspect(ctx, selfCheckID)
+		return err
+	case CapabilityEvents:
+		// Intervalle vide : le démon répond immédiatement
+		now := fmt.Sprintf("%d", time.Now().Unix())
+		messages, errs := cli.Events(ctx, events.ListOptions{Since: now, Until: now})
+		for {
+			select {
+			case <-messages:
+			case err := <-errs:
+				if err == io.EOF {
+					return nil
+				}
+				return err
+			}
+		}
+	case CapabilityTop:
+		_, err := cli.ContainerTop(ctx, selfCheckID, nil)
+		return err
+	case CapabilityStats:
+		stats, err := cli.ContainerStatsOneShot(ctx, selfCheckID)
+		if err == nil {
+			stats.Body.Close()
+		}
+		return err
+	case CapabilityLogs:
+		logs, err := cli.ContainerLogs(ctx, selfCheckID, container.LogsOptions{ShowStdout: true})
+		if err == nil {
+			logs.Close()
+		}
+		return err
+	case CapabilityExecInspect:
+		_, err := cli.ContainerExecInspect(ctx, selfCheckID)
+		return err
+	case CapabilityStop:
+		return cli.ContainerStop(ctx, selfCheckID, container.StopOptions{})
+	}
+	return fmt.Errorf("unknown capability %q", capability)
+}
+
+// WriteSelfCheck écrit le résultat de l'auto-diagnostic et les variables de docker-socket-proxy à définir
+func WriteSelfCheck(w io.Writer, checks []APICheck) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ENDPOINT\tMETHOD\tPATH\tFEATURE\tREQUIRED\tSTATUS")
+	var endpoints []APIEndpoint
+	seen := map[APICapability]bool{}
+	for _, check := range checks {
+		status := "allowed"
+		if !check.Allowed {
+			status = "DENIED: " + check.Error
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%v\t%s\n",
+			check.Endpoint, check.Method, check.Path, check.Feature, check.Required, status)
+		if !seen[check.Capability] {
+			seen[check.Capability] = true
+			endpoints = append(endpoints, check.APIEndpoint)
+		}
+	}
+	fmt.Fprintf(tw, "\ndocker-socket-proxy: %s\n", strings.Join(ProxyEnvironment(endpoints), " "))
+	return tw.Flush()
+}
+
+// SelfCheckPassed indique si tous les appels indispensables sont autorisés
+func SelfCheckPassed(checks []APICheck) bool {
+	for _, check := range checks {
+		if check.Required && !check.Allowed {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,126 @@
+package ecsazrlc
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// capabilities retourne les capacités d'une liste d'appels
+func capabilities(endpoints []APIEndpoint) map[APICapability]bool {
+	set := map[APICapability]bool{}
+	for _, endpoint := range endpoints {
+		set[endpoint.Capability] = true
+	}
+	return set
+}
+
+// TestRequiredAPIEndpoints vérifie que les appels listés suivent la configuration
+func TestRequiredAPIEndpoints(t *testing.T) {
+	minimal := capabilities(RequiredAPIEndpoints(MonitorConfig{Runtime: RuntimeDocker}, false))
+	for _, capability := range []APICapability{CapabilityPing, CapabilityList, CapabilityInspect, CapabilityEvents, CapabilityTop} {
+		if !minimal[capability] {
+			t.Errorf("%s should always be listed", capability)
+		}
+	}
+	for _, capability := range []APICapability{CapabilityVersion, CapabilityLogs, CapabilityStats, CapabilityStop} {
+		if minimal[capability] {
+			t.Errorf("%s should not be needed by the minimal configuration", capability)
+		}
+	}
+
+	full := RequiredAPIEndpoints(MonitorConfig{JobLogPatterns: &LogPatterns{}, Stats: &StatsThresholds{}}, true)
+	for _, capability := range []APICapability{CapabilityVersion, CapabilityLogs, CapabilityStats, CapabilityStop} {
+		if !capabilities(full)[capability] {
+			t.Errorf("%s should be listed for the full configuration", capability)
+		}
+	}
+
+	overdue := RequiredAPIEndpoints(MonitorConfig{OverdueRules: []OverdueRule{{MaxBusy: time.Hour, Action: OverdueActionStop}}}, false)
+	if !capabilities(overdue)[CapabilityStop] {
+		t.Error("stop should be listed when overdue agents are stopped")
+	}
+
+	env := strings.Join(ProxyEnvironment(full), " ")
+	if env != "ALLOW_STOP=1 CONTAINERS=1 EVENTS=1 EXEC=1 PING=1 VERSION=1" {
+		t.Errorf("Unexpected proxy environment: %s", env)
+	}
+}
+
+// forbidden répond comme un docker-socket-proxy refusant l'appel
+func forbidden(calls *atomic.Int32) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if calls != nil {
+			calls.Add(1)
+		}
+		http.Error(w, `{"message":"forbidden"}`, http.StatusForbidden)
+	}
+}
+
+// TestForbiddenTopDegrades vérifie qu'un Top refusé n'est tenté qu'une fois et laisse les autres sondes décider
+func TestForbiddenTopDegrades(t *testing.T) {
+	fake := newFakeDocker(t, &fakeContainer{ID: "aaaaaaaaaaaa0001", Name: "agent", Image: "azp-agent", Processes: []string{"Agent.Listener"}})
+	var calls atomic.Int32
+	fake.route("GET /containers/aaaaaaaaaaaa/top", forbidden(&calls))
+	monitor := fake.monitor(t, MonitorConfig{})
+
+	agent := ActivityEvent{ContainerID: "aaaaaaaaaaaa", ContainerName: "agent"}
+	for range 3 {
+		state := monitor.probeAgent(agent)
+		if !state.Busy || state.Reason != "undetermined, assumed busy" {
+			t.Errorf("Without process listing the agent should be assumed busy, got %+v", state)
+		}
+	}
+	if calls.Load() != 1 {
+		t.Errorf("Forbidden call should be attempted once, got %d", calls.Load())
+	}
+
+	unavailable := monitor.UnavailableCapabilities()
+	if len(unavailable) != 1 || unavailable[0].Capability != CapabilityTop || unavailable[0].Endpoint == "" {
+		t.Errorf("Unexpected unavailable capabilities: %+v", unavailable)
+	}
+}
+
+// TestSelfCheck vérifie le diagnostic des appels autorisés par un proxy
+func TestSelfCheck(t *testing.T) {
+	fake := newFakeDocker(t)
+	fake.route("GET /events", func(w http.ResponseWriter, r *http.Request) {})
+	fake.route("GET /containers/"+selfCheckID+"/top", forbidden(nil))
+	fake.route("POST /containers/", forbidden(nil))
+	monitor := fake.monitor(t, MonitorConfig{})
+
+	checks, err := monitor.SelfCheck(context.Background(), RequiredAPIEndpoints(MonitorConfig{Runtime: RuntimeDocker}, true))
+	if err != nil {
+		t.Fatalf("SelfCheck() error: %v", err)
+	}
+	denied := map[APICapability]bool{}
+	for _, check := range checks {
+		if !check.Allowed {
+			denied[check.Capability] = true
+		}
+	}
+	if len(denied) != 2 || !denied[CapabilityTop] || !denied[CapabilityStop] {
+		t.Errorf("Expected top and stop to be denied, got %v", denied)
+	}
+	if !SelfCheckPassed(checks) {
+		t.Error("Only optional capabilities are denied, the self-check should pass")
+	}
+
+	var out bytes.Buffer
+	if err := WriteSelfCheck(&out, checks); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "DENIED") || !strings.Contains(out.String(), "docker-socket-proxy: ALLOW_STOP=1 CONTAINERS=1 EVENTS=1 EXEC=1 PING=1") {
+		t.Errorf("Unexpected self-check output:\n%s", out.String())
+	}
+
+	fake.route("GET /containers/json", forbidden(nil))
+	checks, _ = monitor.SelfCheck(context.Background(), RequiredAPIEndpoints(MonitorConfig{Runtime: RuntimeDocker}, false))
+	if SelfCheckPassed(checks) {
+		t.Error("Listing containers is required, the self-check should fail")
+	}
+}
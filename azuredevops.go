@@ -0,0 +1,333 @@
+package ecsazrlc
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// Version de l'API REST Azure DevOps utilisée
+const azureDevOpsAPIVersion = "7.1"
+
+// Pool utilisé par l'image officielle de l'agent lorsque AZP_POOL n'est pas défini
+const defaultAgentPool = "Default"
+
+// JobRequest est une demande de job assignée à un agent
+type JobRequest struct {
+	RequestID  int64  `json:"requestId"`
+	PlanType   string `json:"planType"`
+	Definition struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	} `json:"definition"`
+	Owner struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	} `json:"owner"`
+}
+
+// PoolAgent est un agent d'un pool Azure DevOps
+type PoolAgent struct {
+	ID              int         `json:"id"`
+	Name            string      `json:"name"`
+	Status          string      `json:"status"`
+	Enabled         bool        `json:"enabled"`
+	AssignedRequest *JobRequest `json:"assignedRequest"`
+}
+
+// AzureDevOpsClient interroge l'API Agents d'une organisation Azure DevOps
+type AzureDevOpsClient struct {
+	orgURL     string
+	authHeader string
+	httpClient *http.Client
+	mu         sync.Mutex
+	poolIDs    map[string]int // Cache nom de pool -> ID
+}
+
+// NewAzureDevOpsClient crée un client pour l'organisation (https://dev.azure.com/org) et le PAT donnés
+func NewAzureDevOpsClient(orgURL, pat string) *AzureDevOpsClient {
+	return &AzureDevOpsClient{
+		orgURL:     strings.TrimSuffix(orgURL, "/"),
+		authHeader: "Basic " + base64.StdEncoding.EncodeToString([]byte(":"+pat)),
+		httpClient: &http.Client{Timeout: 15 * time.Second},
+		poolIDs:    map[string]int{},
+	}
+}
+
+// LoadAzureDevOpsPAT lit le PAT depuis une variable d'environnement ou, à défaut, un fichier
+func LoadAzureDevOpsPAT(envVar, file string) (string, error) {
+	if pat := os.Getenv(envVar); pat != "" {
+		return pat, nil
+	}
+	if file == "" {
+		return "", fmt.Errorf("no Azure DevOps PAT: set %s or provide a PAT file", envVar)
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to read Azure DevOps PAT file: %w", err)
+	}
+	pat := strings.TrimSpace(string(data))
+	if pat == "" {
+		return "", fmt.Errorf("Azure DevOps PAT file %s is empty", file)
+	}
+	return pat, nil
+}
+
+// get effectue une requête GET sur l'API et décode la réponse JSON
+func (c *AzureDevOpsClient) get(ctx context.Context, path string, query url.Values, out interface{}) error {
+	return c.do(ctx, http.MethodGet, path, query, nil, out)
+}
+
+// do effectue une requête sur l'API et décode la réponse JSON (si out n'est pas nil)
+func (c *AzureDevOpsClient) do(ctx context.Context, method, path string, query url.Values, body interface{}, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	query.Set("api-version", azureDevOpsAPIVersion)
+	req, err := http.NewRequestWithContext(ctx, method, c.orgURL+path+"?"+query.Encode(), reader)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", c.authHeader)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request to Azure DevOps failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Azure DevOps returned status %d for %s %s", resp.StatusCode, method, path)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode Azure DevOps response: %w", err)
+	}
+	return nil
+}
+
+// GetPoolID retourne l'ID du pool d'agents portant ce nom
+func (c *AzureDevOpsClient) GetPoolID(ctx context.Context, poolName string) (int, error) {
+	c.mu.Lock()
+	id, ok := c.poolIDs[poolName]
+	c.mu.Unlock()
+	if ok {
+		return id, nil
+	}
+
+	var result struct {
+		Value []struct {
+			ID   int    `json:"id"`
+			Name string `json:"name"`
+		} `json:"value"`
+	}
+	if err := c.get(ctx, "/_apis/distributedtask/pools", url.Values{"poolName": {poolName}}, &result); err != nil {
+		return 0, err
+	}
+	if len(result.Value) == 0 {
+		return 0, fmt.Errorf("agent pool %q not found", poolName)
+	}
+
+	c.mu.Lock()
+	c.poolIDs[poolName] = result.Value[0].ID
+	c.mu.Unlock()
+	return result.Value[0].ID, nil
+}
+
+// FindAgent retourne l'agent du pool portant ce nom, avec sa demande de job assignée (nil si absent)
+func (c *AzureDevOpsClient) FindAgent(ctx context.Context, poolID int, agentName string) (*PoolAgent, error) {
+	var result struct {
+		Value []PoolAgent `json:"value"`
+	}
+	query := url.Values{
+		"agentName":              {agentName},
+		"includeAssignedRequest": {"true"},
+	}
+	if err := c.get(ctx, fmt.Sprintf("/_apis/distributedtask/pools/%d/agents", poolID), query, &result); err != nil {
+		return nil, err
+	}
+	for _, agent := range result.Value {
+		if strings.EqualFold(agent.Name, agentName) {
+			return &agent, nil
+		}
+	}
+	return nil, nil
+}
+
+// SetAgentEnabled active ou désactive un agent du pool (il ne reçoit plus de nouveaux jobs)
+func (c *AzureDevOpsClient) SetAgentEnabled(ctx context.Context, poolID, agentID int, enabled bool) error {
+	body := map[string]interface{}{"id": agentID, "enabled": enabled}
+	path := fmt.Sprintf("/_apis/distributedtask/pools/%d/agents/%d", poolID, agentID)
+	return c.do(ctx, http.MethodPatch, path, url.Values{}, body, nil)
+}
+
+// AgentIdentity associe un conteneur à son agent de pool
+type AgentIdentity struct {
+	AgentName string
+	PoolName  string
+}
+
+// agentIdentity déduit le nom d'agent (AZP_AGENT_NAME, sinon hostname) et le pool (AZP_POOL) d'un conteneur
+func agentIdentity(info container.InspectResponse, defaultPool string) AgentIdentity {
+	identity := AgentIdentity{PoolName: defaultPool}
+	if info.Config != nil {
+		for _, env := range info.Config.Env {
+			name, value, _ := strings.Cut(env, "=")
+			switch name {
+			case "AZP_AGENT_NAME":
+				identity.AgentName = value
+			case "AZP_POOL":
+				if value != "" {
+					identity.PoolName = value
+				}
+			}
+		}
+		if identity.AgentName == "" {
+			identity.AgentName = info.Config.Hostname
+		}
+	}
+	if identity.PoolName == "" {
+		identity.PoolName = defaultAgentPool
+	}
+	return identity
+}
+
+// azureDevOpsProbe lit l'état réel de l'agent dans Azure DevOps (assignedRequest)
+type azureDevOpsProbe struct {
+	client      *AzureDevOpsClient
+	defaultPool string
+	inspect     func(ctx context.Context, containerID string) (container.InspectResponse, error)
+}
+
+// newAzureDevOpsProbe crée une sonde Azure DevOps pour le moniteur
+func newAzureDevOpsProbe(m *Monitor, client *AzureDevOpsClient, defaultPool string) *azureDevOpsProbe {
+	return &azureDevOpsProbe{
+		client:      client,
+		defaultPool: defaultPool,
+		inspect: func(ctx context.Context, containerID string) (container.InspectResponse, error) {
+			return m.runtime.Inspect(ctx, containerID)
+		},
+	}
+}
+
+// Name retourne le nom de la sonde
+func (p *azureDevOpsProbe) Name() string {
+	return "azure-devops"
+}
+
+// Probe retourne l'état d'occupation de l'agent tel que connu d'Azure DevOps
+func (p *azureDevOpsProbe) Probe(ctx context.Context, agent ActivityEvent) (ProbeResult, error) {
+	info, err := p.inspect(ctx, agent.ContainerID)
+	if err != nil {
+		return ProbeResult{}, fmt.Errorf("failed to inspect container: %w", err)
+	}
+
+	poolAgent, identity, err := p.lookup(ctx, info)
+	if err != nil {
+		return ProbeResult{}, err
+	}
+	if poolAgent == nil {
+		// Agent inconnu du pool : laisser les autres sondes se prononcer
+		return ProbeResult{}, nil
+	}
+
+	if request := poolAgent.AssignedRequest; request != nil {
+		reason := fmt.Sprintf("job request %d assigned to %s", request.RequestID, identity.AgentName)
+		if request.Definition.Name != "" {
+			reason += " (" + request.Definition.Name + ")"
+		}
+		return ProbeResult{Known: true, Busy: true, Reason: reason}, nil
+	}
+	return ProbeResult{Known: true, Busy: false, Reason: "no job assigned to " + identity.AgentName}, nil
+}
+
+// lookup retrouve l'agent de pool correspondant à un conteneur
+func (p *azureDevOpsProbe) lookup(ctx context.Context, info container.InspectResponse) (*PoolAgent, AgentIdentity, error) {
+	poolAgent, _, identity, err := lookupPoolAgent(ctx, p.client, info, p.defaultPool)
+	return poolAgent, identity, err
+}
+
+// lookupPoolAgent retrouve l'agent de pool (et l'ID du pool) correspondant à un conteneur
+func lookupPoolAgent(ctx context.Context, client *AzureDevOpsClient, info container.InspectResponse, defaultPool string) (*PoolAgent, int, AgentIdentity, error) {
+	identity := agentIdentity(info, defaultPool)
+	if identity.AgentName == "" {
+		return nil, 0, identity, nil
+	}
+
+	poolID, err := client.GetPoolID(ctx, identity.PoolName)
+	if err != nil {
+		return nil, 0, identity, err
+	}
+	poolAgent, err := client.FindAgent(ctx, poolID, identity.AgentName)
+	return poolAgent, poolID, identity, err
+}
+
+// LocalPoolAgent associe un conteneur agent de cette machine à son agent de pool
+type LocalPoolAgent struct {
+	ContainerID   string
+	ContainerName string
+	PoolID        int
+	Agent         PoolAgent
+}
+
+// LocalPoolAgents retourne les agents de pool hébergés par les conteneurs agents de cette machine
+func (m *Monitor) LocalPoolAgents(client *AzureDevOpsClient, defaultPool string) ([]LocalPoolAgent, error) {
+	agents, err := m.GetRunningAzureAgents()
+	if err != nil {
+		return nil, err
+	}
+
+	var local []LocalPoolAgent
+	for _, agent := range agents {
+		// L'identité d'un agent de l'hôte ne se déduit pas d'un conteneur
+		if agent.HostPID != 0 {
+			continue
+		}
+		info, err := m.runtime.Inspect(m.ctx, agent.ContainerID)
+		if err != nil {
+			log.Printf("Warning: failed to inspect container %s: %v", agent.ContainerID, err)
+			continue
+		}
+
+		poolAgent, poolID, identity, err := lookupPoolAgent(m.ctx, client, info, defaultPool)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find pool agent for %s: %w", agent.ContainerName, err)
+		}
+		if poolAgent == nil {
+			log.Printf("Warning: agent %s (pool %s) not found in Azure DevOps", identity.AgentName, identity.PoolName)
+			continue
+		}
+
+		local = append(local, LocalPoolAgent{
+			ContainerID:   agent.ContainerID,
+			ContainerName: agent.ContainerName,
+			PoolID:        poolID,
+			Agent:         *poolAgent,
+		})
+	}
+	return local, nil
+}
@@ -0,0 +1,131 @@
+package ecsazrlc
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// disabledAgent est un agent de pool désactivé par ecsazrlc
+type disabledAgent struct {
+	PoolID int
+	ID     int
+	Name   string
+}
+
+// AgentDrainer désactive les agents Azure DevOps de cette machine avant un drain
+// et attend la fin de leurs jobs en cours. Implémente DrainHook.
+type AgentDrainer struct {
+	monitor      *Monitor
+	client       *AzureDevOpsClient
+	defaultPool  string
+	pollInterval time.Duration
+	jobTimeout   time.Duration // Attente maximale des jobs en cours (0 = sans limite)
+	mu           sync.Mutex
+	disabled     []disabledAgent
+}
+
+// NewAgentDrainer crée l'étape de drain Azure DevOps
+func NewAgentDrainer(monitor *Monitor, client *AzureDevOpsClient, defaultPool string, jobTimeout time.Duration) *AgentDrainer {
+	return &AgentDrainer{
+		monitor:      monitor,
+		client:       client,
+		defaultPool:  defaultPool,
+		pollInterval: 15 * time.Second,
+		jobTimeout:   jobTimeout,
+	}
+}
+
+// PrepareDrain désactive les agents locaux puis attend qu'aucun n'ait de job assigné
+func (d *AgentDrainer) PrepareDrain(ctx context.Context) error {
+	agents, err := d.monitor.LocalPoolAgents(d.client, d.defaultPool)
+	if err != nil {
+		return err
+	}
+
+	for _, agent := range agents {
+		if !agent.Agent.Enabled {
+			continue
+		}
+		err := d.client.SetAgentEnabled(ctx, agent.PoolID, agent.Agent.ID, false)
+		if err != nil && ctx.Err() == nil {
+			return fmt.Errorf("failed to disable agent %s: %w", agent.Agent.Name, err)
+		}
+
+		// Une requête interrompue par l'annulation a pu être appliquée par le serveur :
+		// l'agent est réactivé par CancelDrain dans le doute
+		d.mu.Lock()
+		d.disabled = append(d.disabled, disabledAgent{PoolID: agent.PoolID, ID: agent.Agent.ID, Name: agent.Agent.Name})
+		d.mu.Unlock()
+		if err != nil {
+			return fmt.Errorf("failed to disable agent %s: %w", agent.Agent.Name, err)
+		}
+		log.Printf("Azure DevOps agent %s disabled before drain", agent.Agent.Name)
+	}
+
+	return d.waitForJobs(ctx, agents)
+}
+
+// waitForJobs attend que les agents n'aient plus de job assigné. Passé jobTimeout, l'instance
+// est libérée malgré les jobs restants : les agents restent désactivés, le drain se poursuit.
+func (d *AgentDrainer) waitForJobs(ctx context.Context, agents []LocalPoolAgent) error {
+	var timeout <-chan time.Time
+	if d.jobTimeout > 0 {
+		timer := time.NewTimer(d.jobTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	for {
+		busy := 0
+		for _, agent := range agents {
+			current, err := d.client.FindAgent(ctx, agent.PoolID, agent.Agent.Name)
+			if err != nil {
+				log.Printf("Warning: failed to refresh agent %s: %v", agent.Agent.Name, err)
+				busy++
+				continue
+			}
+			if current != nil && current.AssignedRequest != nil {
+				busy++
+			}
+		}
+
+		if busy == 0 {
+			log.Println("No Azure DevOps job running, instance can be released")
+			return nil
+		}
+
+		log.Printf("Waiting for %d Azure DevOps job(s) to finish before drain", busy)
+		select {
+		case <-time.After(d.pollInterval):
+		case <-timeout:
+			log.Printf("Warning: %d Azure DevOps job(s) still running after %s, releasing the instance anyway", busy, d.jobTimeout)
+			return nil
+		case <-ctx.Done():
+			return fmt.Errorf("jobs still running: %w", ctx.Err())
+		}
+	}
+}
+
+// CancelDrain réactive les agents désactivés par PrepareDrain
+func (d *AgentDrainer) CancelDrain(ctx context.Context) error {
+	d.mu.Lock()
+	disabled := d.disabled
+	d.disabled = nil
+	d.mu.Unlock()
+
+	var firstErr error
+	for _, agent := range disabled {
+		if err := d.client.SetAgentEnabled(ctx, agent.PoolID, agent.ID, true); err != nil {
+			log.Printf("Error re-enabling Azure DevOps agent %s: %v", agent.Name, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		log.Printf("Azure DevOps agent %s re-enabled", agent.Name)
+	}
+	return firstErr
+}
@@ -0,0 +1,172 @@
+package ecsazrlc
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestAgentDrainer vérifie la désactivation, l'attente des jobs et la réactivation des agents
+func TestAgentDrainer(t *testing.T) {
+	azdo := newFakeAzureDevOps(t)
+	azdo.pools["Linux"] = 3
+	azdo.agents[3] = []PoolAgent{
+		{ID: 10, Name: "agent-a", Enabled: true, AssignedRequest: &JobRequest{RequestID: 1}},
+		{ID: 11, Name: "agent-b", Enabled: true},
+		{ID: 12, Name: "agent-remote", Enabled: true},
+	}
+
+	fake := newFakeDocker(t,
+		&fakeContainer{ID: "aaaaaaaaaaaa0001", Name: "a", Image: "azp-agent", Env: []string{"AZP_AGENT_NAME=agent-a", "AZP_POOL=Linux"}},
+		&fakeContainer{ID: "bbbbbbbbbbbb0002", Name: "b", Image: "azp-agent", Env: []string{"AZP_AGENT_NAME=agent-b", "AZP_POOL=Linux"}},
+	)
+	monitor := fake.monitor(t, MonitorConfig{})
+
+	drainer := NewAgentDrainer(monitor, NewAzureDevOpsClient(azdo.server.URL, "pat"), "", time.Second)
+	drainer.pollInterval = 10 * time.Millisecond
+
+	// Le job de agent-a se termine pendant l'attente
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		azdo.mu.Lock()
+		azdo.agents[3][0].AssignedRequest = nil
+		azdo.mu.Unlock()
+	}()
+
+	start := time.Now()
+	if err := drainer.PrepareDrain(context.Background()); err != nil {
+		t.Fatalf("PrepareDrain() error: %v", err)
+	}
+	if time.Since(start) < 50*time.Millisecond {
+		t.Error("PrepareDrain() should wait for the running job to finish")
+	}
+
+	if azdo.agent(3, "agent-a").Enabled || azdo.agent(3, "agent-b").Enabled {
+		t.Error("Local agents should be disabled")
+	}
+	if !azdo.agent(3, "agent-remote").Enabled {
+		t.Error("Agents of other machines must not be touched")
+	}
+
+	if err := drainer.CancelDrain(context.Background()); err != nil {
+		t.Fatalf("CancelDrain() error: %v", err)
+	}
+	if !azdo.agent(3, "agent-a").Enabled || !azdo.agent(3, "agent-b").Enabled {
+		t.Error("Local agents should be re-enabled after cancel")
+	}
+}
+
+// TestAgentDrainerJobTimeout vérifie que le drain se poursuit lorsque les jobs ne finissent pas à temps
+func TestAgentDrainerJobTimeout(t *testing.T) {
+	azdo := newFakeAzureDevOps(t)
+	azdo.pools["Default"] = 1
+	azdo.agents[1] = []PoolAgent{{ID: 1, Name: "agent-a", Enabled: true, AssignedRequest: &JobRequest{RequestID: 1}}}
+
+	fake := newFakeDocker(t, &fakeContainer{ID: "aaaaaaaaaaaa0001", Name: "a", Image: "azp-agent", Env: []string{"AZP_AGENT_NAME=agent-a"}})
+	drainer := NewAgentDrainer(fake.monitor(t, MonitorConfig{}), NewAzureDevOpsClient(azdo.server.URL, "pat"), "", 30*time.Millisecond)
+	drainer.pollInterval = 10 * time.Millisecond
+
+	ecs := newFakeECS(t)
+	notifier := newTestNotifier(t, ecs)
+	notifier.AddDrainHook(drainer)
+
+	if err := notifier.Drain(context.Background()); err != nil {
+		t.Fatalf("Drain() should proceed after the job timeout, got %v", err)
+	}
+	if calls := ecs.callsTo("UpdateContainerInstancesState"); len(calls) != 1 || calls[0].Body["status"] != "DRAINING" {
+		t.Errorf("Instance should be set to DRAINING, got %+v", calls)
+	}
+	if azdo.agent(1, "agent-a").Enabled {
+		t.Error("Agent should stay disabled while its job finishes")
+	}
+}
+
+// hookJournal enregistre l'ordre des appels aux étapes de drain
+type hookJournal struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (j *hookJournal) add(call string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.calls = append(j.calls, call)
+}
+
+func (j *hookJournal) list() []string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return append([]string(nil), j.calls...)
+}
+
+// orderedHook est une étape de drain qui consigne ses appels
+type orderedHook struct {
+	name    string
+	fail    bool
+	journal *hookJournal
+}
+
+func (h *orderedHook) PrepareDrain(ctx context.Context) error {
+	h.journal.add("prepare " + h.name)
+	if h.fail {
+		return errors.New("boom")
+	}
+	return nil
+}
+
+func (h *orderedHook) CancelDrain(ctx context.Context) error {
+	h.journal.add("cancel " + h.name)
+	return nil
+}
+
+// TestNotifierDrainHooks vérifie l'exécution des étapes avant le passage en DRAINING
+func TestNotifierDrainHooks(t *testing.T) {
+	fake := newFakeECS(t)
+	journal := &hookJournal{}
+	notifier := newTestNotifier(t, fake)
+	notifier.AddDrainHook(&orderedHook{name: "first", journal: journal})
+	notifier.AddDrainHook(&orderedHook{name: "second", journal: journal})
+
+	if err := notifier.Drain(context.Background()); err != nil {
+		t.Fatalf("Drain() error: %v", err)
+	}
+	calls := fake.callsTo("UpdateContainerInstancesState")
+	if len(calls) != 1 || calls[0].Body["status"] != "DRAINING" {
+		t.Fatalf("Expected instance to be set to DRAINING, got %+v", calls)
+	}
+
+	if err := notifier.CancelDrain(context.Background()); err != nil {
+		t.Fatalf("CancelDrain() error: %v", err)
+	}
+	hookCalls := journal.list()
+	expected := []string{"prepare first", "prepare second", "cancel second", "cancel first"}
+	if len(hookCalls) != len(expected) {
+		t.Fatalf("Unexpected hook calls: %v", hookCalls)
+	}
+	for i := range expected {
+		if hookCalls[i] != expected[i] {
+			t.Errorf("Hook call %d = %s, want %s", i, hookCalls[i], expected[i])
+		}
+	}
+}
+
+// TestNotifierDrainHookFailure vérifie qu'un échec annule le drain sans toucher ECS
+func TestNotifierDrainHookFailure(t *testing.T) {
+	fake := newFakeECS(t)
+	journal := &hookJournal{}
+	notifier := newTestNotifier(t, fake)
+	notifier.AddDrainHook(&orderedHook{name: "first", journal: journal})
+	notifier.AddDrainHook(&orderedHook{name: "second", fail: true, journal: journal})
+
+	if err := notifier.Drain(context.Background()); err == nil {
+		t.Fatal("Expected Drain() to fail")
+	}
+	if len(fake.callsTo("UpdateContainerInstancesState")) != 0 {
+		t.Error("Instance state must not change when a drain step fails")
+	}
+	if calls := journal.list(); calls[len(calls)-1] != "cancel first" {
+		t.Errorf("Expected prepared steps to be cancelled, got %v", calls)
+	}
+}
@@ -0,0 +1,213 @@
+package ecsazrlc
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// fakeAzureDevOps simule les API Pools et Agents d'Azure DevOps
+type fakeAzureDevOps struct {
+	mu     sync.Mutex
+	server *httptest.Server
+	pools  map[string]int
+	agents map[int][]PoolAgent
+	auth   []string
+	// Délai de traitement des PATCH, appliqués même si le client a abandonné la requête
+	patchDelay time.Duration
+	patches    int // PATCH reçus, avant leur traitement
+}
+
+// newFakeAzureDevOps démarre un faux serveur Azure DevOps
+func newFakeAzureDevOps(t *testing.T) *fakeAzureDevOps {
+	t.Helper()
+	f := &fakeAzureDevOps{pools: map[string]int{}, agents: map[int][]PoolAgent{}}
+	f.server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+// receivedPatches retourne le nombre de PATCH reçus
+func (f *fakeAzureDevOps) receivedPatches() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.patches
+}
+
+func (f *fakeAzureDevOps) serve(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPatch {
+		f.mu.Lock()
+		f.patches++
+		f.mu.Unlock()
+		time.Sleep(f.patchDelay)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.auth = append(f.auth, r.Header.Get("Authorization"))
+
+	if r.URL.Query().Get("api-version") == "" {
+		http.Error(w, "missing api-version", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case r.URL.Path == "/_apis/distributedtask/pools":
+		var value []map[string]interface{}
+		name := r.URL.Query().Get("poolName")
+		if id, ok := f.pools[name]; ok {
+			value = append(value, map[string]interface{}{"id": id, "name": name})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"count": len(value), "value": value})
+
+	case r.Method == http.MethodPatch && strings.HasPrefix(r.URL.Path, "/_apis/distributedtask/pools/"):
+		var poolID int
+		json.Unmarshal([]byte(strings.Split(r.URL.Path, "/")[4]), &poolID)
+		var update struct {
+			ID      int  `json:"id"`
+			Enabled bool `json:"enabled"`
+		}
+		json.NewDecoder(r.Body).Decode(&update)
+		for i := range f.agents[poolID] {
+			if f.agents[poolID][i].ID == update.ID {
+				f.agents[poolID][i].Enabled = update.Enabled
+				json.NewEncoder(w).Encode(f.agents[poolID][i])
+				return
+			}
+		}
+		http.NotFound(w, r)
+
+	case strings.HasPrefix(r.URL.Path, "/_apis/distributedtask/pools/") && strings.HasSuffix(r.URL.Path, "/agents"):
+		var poolID int
+		json.Unmarshal([]byte(strings.Split(r.URL.Path, "/")[4]), &poolID)
+		var value []PoolAgent
+		for _, agent := range f.agents[poolID] {
+			if name := r.URL.Query().Get("agentName"); name == "" || name == agent.Name {
+				if r.URL.Query().Get("includeAssignedRequest") != "true" {
+					agent.AssignedRequest = nil
+				}
+				value = append(value, agent)
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"count": len(value), "value": value})
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// agent retourne une copie de l'agent de pool portant ce nom
+func (f *fakeAzureDevOps) agent(poolID int, name string) PoolAgent {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, agent := range f.agents[poolID] {
+		if agent.Name == name {
+			return agent
+		}
+	}
+	return PoolAgent{}
+}
+
+// TestAgentIdentity vérifie l'association conteneur -> agent de pool
+func TestAgentIdentity(t *testing.T) {
+	withEnv := container.InspectResponse{Config: &container.Config{
+		Hostname: "3f2a1b4c5d6e",
+		Env:      []string{"AZP_URL=https://dev.azure.com/org", "AZP_AGENT_NAME=build-01", "AZP_POOL=Linux"},
+	}}
+	identity := agentIdentity(withEnv, "")
+	if identity.AgentName != "build-01" || identity.PoolName != "Linux" {
+		t.Errorf("Unexpected identity from env: %+v", identity)
+	}
+
+	fromHostname := container.InspectResponse{Config: &container.Config{Hostname: "3f2a1b4c5d6e"}}
+	identity = agentIdentity(fromHostname, "Custom")
+	if identity.AgentName != "3f2a1b4c5d6e" || identity.PoolName != "Custom" {
+		t.Errorf("Unexpected identity from hostname: %+v", identity)
+	}
+
+	if identity := agentIdentity(fromHostname, ""); identity.PoolName != defaultAgentPool {
+		t.Errorf("Expected default pool %q, got %q", defaultAgentPool, identity.PoolName)
+	}
+}
+
+// TestAzureDevOpsProbe vérifie que l'état Azure DevOps fait foi sur les processus
+func TestAzureDevOpsProbe(t *testing.T) {
+	azdo := newFakeAzureDevOps(t)
+	azdo.pools["Linux"] = 7
+	azdo.agents[7] = []PoolAgent{
+		{ID: 1, Name: "busy-agent", Status: "online", Enabled: true, AssignedRequest: &JobRequest{RequestID: 42}},
+		{ID: 2, Name: "idle-agent", Status: "online", Enabled: true},
+	}
+
+	fake := newFakeDocker(t,
+		// Agent.Worker présent mais Azure DevOps dit inactif : Azure DevOps l'emporte
+		&fakeContainer{ID: "aaaaaaaaaaaa0001", Name: "idle", Image: "azp-agent", Env: []string{"AZP_AGENT_NAME=idle-agent", "AZP_POOL=Linux"}, Processes: []string{"Agent.Worker"}},
+		&fakeContainer{ID: "bbbbbbbbbbbb0002", Name: "busy", Image: "azp-agent", Env: []string{"AZP_AGENT_NAME=busy-agent", "AZP_POOL=Linux"}, Processes: []string{"Agent.Listener"}},
+		// Agent inconnu du pool : repli sur les processus
+		&fakeContainer{ID: "cccccccccccc0003", Name: "unknown", Image: "azp-agent", Env: []string{"AZP_AGENT_NAME=other", "AZP_POOL=Linux"}, Processes: []string{"Agent.Listener"}},
+	)
+	monitor := fake.monitor(t, MonitorConfig{
+		AzureDevOps: NewAzureDevOpsClient(azdo.server.URL+"/", "my-pat"),
+	})
+
+	states, err := monitor.GetAgentStates()
+	if err != nil {
+		t.Fatalf("GetAgentStates() error: %v", err)
+	}
+
+	expected := map[string]bool{"idle": false, "busy": true, "unknown": false}
+	for _, state := range states {
+		if state.Busy != expected[state.ContainerName] {
+			t.Errorf("%s busy = %v (%s), want %v", state.ContainerName, state.Busy, state.Reason, expected[state.ContainerName])
+		}
+	}
+
+	wantAuth := "Basic " + base64.StdEncoding.EncodeToString([]byte(":my-pat"))
+	for _, auth := range azdo.auth {
+		if auth != wantAuth {
+			t.Fatalf("Unexpected Authorization header: %s", auth)
+		}
+	}
+}
+
+// TestGetPoolIDNotFound vérifie l'erreur pour un pool inexistant
+func TestGetPoolIDNotFound(t *testing.T) {
+	azdo := newFakeAzureDevOps(t)
+	client := NewAzureDevOpsClient(azdo.server.URL, "pat")
+
+	if _, err := client.GetPoolID(context.Background(), "missing"); err == nil {
+		t.Error("Expected an error for a missing pool")
+	}
+}
+
+// TestLoadAzureDevOpsPAT vérifie la lecture du PAT depuis l'environnement ou un fichier
+func TestLoadAzureDevOpsPAT(t *testing.T) {
+	t.Setenv("TEST_AZDO_PAT", "")
+	file := filepath.Join(t.TempDir(), "pat")
+	os.WriteFile(file, []byte("from-file\n"), 0o600)
+
+	pat, err := LoadAzureDevOpsPAT("TEST_AZDO_PAT", file)
+	if err != nil || pat != "from-file" {
+		t.Errorf("LoadAzureDevOpsPAT() = %q, %v; want from-file", pat, err)
+	}
+
+	t.Setenv("TEST_AZDO_PAT", "from-env")
+	if pat, _ := LoadAzureDevOpsPAT("TEST_AZDO_PAT", file); pat != "from-env" {
+		t.Errorf("Expected environment variable to take precedence, got %q", pat)
+	}
+
+	t.Setenv("TEST_AZDO_PAT", "")
+	if _, err := LoadAzureDevOpsPAT("TEST_AZDO_PAT", ""); err == nil {
+		t.Error("Expected an error without PAT")
+	}
+}
@@ -0,0 +1,114 @@
+package ecsazrlc
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	cwtypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+)
+
+// Limites de l'API PutMetricData
+const (
+	maxDatumsPerRequest = 1000
+	maxPendingDatums    = 10 * maxDatumsPerRequest
+)
+
+// DefaultMetricsNamespace est le namespace CloudWatch par défaut
+const DefaultMetricsNamespace = "ECSAzureAgents"
+
+// CloudWatchPublisher publie les métriques d'activité via PutMetricData
+type CloudWatchPublisher struct {
+	client    *cloudwatch.Client
+	namespace string
+	ctx       context.Context
+	mu        sync.Mutex
+	pending   []cwtypes.MetricDatum
+}
+
+// NewCloudWatchPublisher crée un publieur CloudWatch pour le namespace donné
+func NewCloudWatchPublisher(namespace string) (*CloudWatchPublisher, error) {
+	ctx := context.Background()
+
+	cfg, err := loadAWSConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return newCloudWatchPublisherWithClient(ctx, cloudwatch.NewFromConfig(cfg), namespace), nil
+}
+
+// newCloudWatchPublisherWithClient crée un publieur avec un client CloudWatch existant
+func newCloudWatchPublisherWithClient(ctx context.Context, client *cloudwatch.Client, namespace string) *CloudWatchPublisher {
+	if namespace == "" {
+		namespace = DefaultMetricsNamespace
+	}
+	return &CloudWatchPublisher{
+		client:    client,
+		namespace: namespace,
+		ctx:       ctx,
+	}
+}
+
+// Publish met en tampon les points de mesure par instance et par cluster
+func (p *CloudWatchPublisher) Publish(metrics ActivityMetrics) error {
+	clusterDimension := cwtypes.Dimension{
+		Name:  aws.String("ClusterName"),
+		Value: aws.String(metrics.ClusterName),
+	}
+	instanceDimensions := []cwtypes.Dimension{clusterDimension}
+	if metrics.InstanceID != "" {
+		instanceDimensions = append(instanceDimensions, cwtypes.Dimension{
+			Name:  aws.String("InstanceId"),
+			Value: aws.String(metrics.InstanceID),
+		})
+	}
+
+	p.mu.Lock()
+	for _, value := range metrics.values() {
+		for _, dimensions := range [][]cwtypes.Dimension{instanceDimensions, {clusterDimension}} {
+			p.pending = append(p.pending, cwtypes.MetricDatum{
+				MetricName: aws.String(value.Name),
+				Dimensions: dimensions,
+				Timestamp:  aws.Time(metrics.Timestamp),
+				Value:      aws.Float64(value.Value),
+				Unit:       cwtypes.StandardUnit(value.Unit),
+			})
+		}
+	}
+	// Éviter une croissance illimitée si CloudWatch est injoignable
+	if dropped := len(p.pending) - maxPendingDatums; dropped > 0 {
+		log.Printf("Warning: dropping %d pending CloudWatch data point(s)", dropped)
+		p.pending = p.pending[dropped:]
+	}
+	full := len(p.pending) >= maxDatumsPerRequest
+	p.mu.Unlock()
+
+	if full {
+		return p.Flush()
+	}
+	return nil
+}
+
+// Flush envoie les points en attente par lots de 1000
+func (p *CloudWatchPublisher) Flush() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for len(p.pending) > 0 {
+		end := min(maxDatumsPerRequest, len(p.pending))
+		_, err := p.client.PutMetricData(p.ctx, &cloudwatch.PutMetricDataInput{
+			Namespace:  aws.String(p.namespace),
+			MetricData: p.pending[:end],
+		})
+		if err != nil {
+			return fmt.Errorf("failed to put metric data: %w", err)
+		}
+		p.pending = p.pending[end:]
+	}
+
+	return nil
+}
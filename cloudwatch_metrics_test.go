@@ -0,0 +1,132 @@
+package ecsazrlc
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+)
+
+// fakeCloudWatch simule PutMetricData (protocole query) sur un serveur HTTP local
+type fakeCloudWatch struct {
+	mu       sync.Mutex
+	server   *httptest.Server
+	requests []url.Values
+}
+
+func newFakeCloudWatch(t *testing.T) *fakeCloudWatch {
+	t.Helper()
+	f := &fakeCloudWatch{}
+	f.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			gz, err := gzip.NewReader(r.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			body = gz
+		}
+		data, _ := io.ReadAll(body)
+		values, _ := url.ParseQuery(string(data))
+
+		f.mu.Lock()
+		f.requests = append(f.requests, values)
+		f.mu.Unlock()
+
+		w.Header().Set("Content-Type", "text/xml")
+		io.WriteString(w, `<PutMetricDataResponse><ResponseMetadata><RequestId>test</RequestId></ResponseMetadata></PutMetricDataResponse>`)
+	}))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func (f *fakeCloudWatch) client() *cloudwatch.Client {
+	return cloudwatch.New(cloudwatch.Options{
+		Region:           "us-east-1",
+		BaseEndpoint:     aws.String(f.server.URL),
+		Credentials:      aws.AnonymousCredentials{},
+		RetryMaxAttempts: 1,
+	})
+}
+
+// datumCount retourne le nombre de points contenus dans une requête PutMetricData
+func datumCount(values url.Values) int {
+	count := 0
+	for key := range values {
+		if strings.HasPrefix(key, "MetricData.member.") && strings.HasSuffix(key, ".MetricName") {
+			count++
+		}
+	}
+	return count
+}
+
+// TestCloudWatchPublisher vérifie la mise en tampon et l'envoi des points par lots
+func TestCloudWatchPublisher(t *testing.T) {
+	fake := newFakeCloudWatch(t)
+	publisher := newCloudWatchPublisherWithClient(context.Background(), fake.client(), "")
+
+	metrics := ActivityMetrics{ClusterName: "test-cluster", InstanceID: "i-123", Timestamp: time.Now(), BusyAgents: 2, IdleAgents: 1}
+	if err := publisher.Publish(metrics); err != nil {
+		t.Fatalf("Publish() error: %v", err)
+	}
+	if len(fake.requests) != 0 {
+		t.Fatal("Publish() should buffer data points until flush")
+	}
+
+	if err := publisher.Flush(); err != nil {
+		t.Fatalf("Flush() error: %v", err)
+	}
+	if len(fake.requests) != 1 {
+		t.Fatalf("Expected 1 PutMetricData request, got %d", len(fake.requests))
+	}
+
+	request := fake.requests[0]
+	if request.Get("Action") != "PutMetricData" || request.Get("Namespace") != DefaultMetricsNamespace {
+		t.Errorf("Unexpected request: %v", request)
+	}
+	// 5 métriques x (dimensions instance + dimension cluster)
+	if count := datumCount(request); count != 10 {
+		t.Errorf("Expected 10 data points, got %d", count)
+	}
+	if request.Get("MetricData.member.1.Dimensions.member.2.Name") != "InstanceId" {
+		t.Errorf("Expected per-instance InstanceId dimension, got %v", request)
+	}
+}
+
+// TestCloudWatchPublisherBatches vérifie le découpage en requêtes de 1000 points
+func TestCloudWatchPublisherBatches(t *testing.T) {
+	fake := newFakeCloudWatch(t)
+	publisher := newCloudWatchPublisherWithClient(context.Background(), fake.client(), "Custom")
+
+	metrics := ActivityMetrics{ClusterName: "test-cluster", InstanceID: "i-123", Timestamp: time.Now()}
+	for i := 0; i < 200; i++ {
+		if err := publisher.Publish(metrics); err != nil {
+			t.Fatalf("Publish() error: %v", err)
+		}
+	}
+	if err := publisher.Flush(); err != nil {
+		t.Fatalf("Flush() error: %v", err)
+	}
+
+	total := 0
+	for _, request := range fake.requests {
+		count := datumCount(request)
+		if count > maxDatumsPerRequest {
+			t.Errorf("Request exceeds %d data points: %d", maxDatumsPerRequest, count)
+		}
+		total += count
+	}
+	if total != 2000 {
+		t.Errorf("Expected 2000 data points sent, got %d", total)
+	}
+}
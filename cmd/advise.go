@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"time"
+
+	"github.com/hypolas/ecsazrlc"
+)
+
+// runAdvise exécute la sous-commande "advise" : conseil de réduction de capacité du cluster
+func runAdvise(args []string) {
+	fs := flag.NewFlagSet("advise", flag.ExitOnError)
+	clusterName := fs.String("cluster", "", "Nom du cluster ECS (requis)")
+	format := fs.String("format", "table", "Format de sortie: table ou json")
+	staleAfter := fs.Duration("stale-after", 5*time.Minute, "Délai après lequel un heartbeat est considéré comme périmé")
+	drain := fs.Bool("drain", false, "Passer les instances sûres en DRAINING")
+	batchSize := fs.Int("batch-size", 5, "Nombre d'instances drainées par lot (max 10)")
+	batchInterval := fs.Duration("batch-interval", 30*time.Second, "Pause entre deux lots de drain")
+	fs.Parse(args)
+
+	if *clusterName == "" {
+		log.Fatal("Le nom du cluster ECS est requis (utilisez --cluster)")
+	}
+
+	advisor, err := ecsazrlc.NewAdvisor(*clusterName, *staleAfter)
+	if err != nil {
+		log.Fatalf("Failed to create advisor: %v", err)
+	}
+
+	advice, err := advisor.Advise()
+	if err != nil {
+		log.Fatalf("Failed to compute cluster advice: %v", err)
+	}
+
+	switch *format {
+	case "json":
+		err = advice.WriteJSON(os.Stdout)
+	case "table":
+		err = advice.WriteTable(os.Stdout)
+	default:
+		log.Fatalf("Unknown output format: %s", *format)
+	}
+	if err != nil {
+		log.Fatalf("Failed to write advice: %v", err)
+	}
+
+	if *drain {
+		drained, err := advisor.DrainSafe(advice, *batchSize, *batchInterval)
+		if err != nil {
+			log.Fatalf("Drain failed after %d instance(s): %v", len(drained), err)
+		}
+		log.Printf("Drained %d safe container instance(s)", len(drained))
+	}
+}
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"strings"
@@ -13,6 +16,12 @@ import (
 )
 
 func main() {
+	// Sous-commandes
+	if len(os.Args) > 1 && os.Args[1] == "advise" {
+		runAdvise(os.Args[2:])
+		return
+	}
+
 	// Flags de ligne de commande
 	clusterName := flag.String("cluster", "", "Nom du cluster ECS (requis si mode ECS activé)")
 	heartbeatInterval := flag.Duration("heartbeat", 30*time.Second, "Intervalle entre les heartbeats ECS")
@@ -21,6 +30,76 @@ func main() {
 	verbose := flag.Bool("verbose", false, "Mode verbose")
 	excludeContainers := flag.String("exclude-containers", "", "Conteneurs à exclure (séparés par des virgules)")
 	excludeImages := flag.String("exclude-images", "", "Images à exclure (séparés par des virgules)")
+	enableMetrics := flag.Bool("enable-metrics", false, "Publier les métriques d'activité dans CloudWatch")
+	metricsFormat := flag.String("metrics-format", "cloudwatch", "Format des métriques: cloudwatch (PutMetricData) ou emf (JSON sur stdout)")
+	metricsNamespace := flag.String("metrics-namespace", ecsazrlc.DefaultMetricsNamespace, "Namespace CloudWatch des métriques")
+	metricsFlush := flag.Duration("metrics-flush", time.Minute, "Intervalle d'envoi des métriques (au moins le heartbeat)")
+	enableEventBridge := flag.Bool("enable-eventbridge", false, "Publier les transitions d'état dans EventBridge")
+	eventBusName := flag.String("event-bus", "", "Nom ou ARN du bus EventBridge (bus par défaut si vide)")
+	transitionInterval := flag.Duration("transition-interval", 10*time.Second, "Intervalle de détection des transitions busy/idle")
+	longRunningJob := flag.Duration("long-running-job", 0, "Durée au-delà de laquelle un job est signalé comme long (0 = désactivé)")
+	webhookURL := flag.String("webhook-url", "", "URL du webhook recevant les transitions (POST)")
+	webhookHeaders := flag.String("webhook-headers", "", "En-têtes du webhook (Nom=Valeur, séparés par des virgules)")
+	webhookTemplate := flag.String("webhook-template", "", "Fichier modèle text/template du corps du webhook")
+	webhookEvents := flag.String("webhook-events", "AgentStarted,AgentStopped,JobLongRunning,InstanceDraining", "Transitions envoyées au webhook (séparées par des virgules, vide = toutes)")
+	webhookRetries := flag.Int("webhook-retries", 5, "Nombre de nouvelles tentatives d'un webhook en échec")
+	webhookDeadLetter := flag.String("webhook-dead-letter", "", "Fichier recevant les webhooks abandonnés (JSON lines)")
+	azdoURL := flag.String("azdo-url", "", "URL de l'organisation Azure DevOps (https://dev.azure.com/org) pour lire l'état réel des agents")
+	azdoPATFile := flag.String("azdo-pat-file", "", "Fichier contenant le PAT Azure DevOps (si ECSAZRLC_AZDO_PAT n'est pas défini)")
+	azdoPool := flag.String("azdo-pool", "", "Pool d'agents par défaut si le conteneur ne définit pas AZP_POOL")
+	followLogs := flag.Bool("follow-logs", false, "Suivre les logs des agents pour détecter le début et la fin des jobs")
+	jobStartedPattern := flag.String("job-started-pattern", ecsazrlc.DefaultJobStartedPattern, "Expression régulière d'une ligne de début de job (groupe nommé job)")
+	jobFinishedPattern := flag.String("job-finished-pattern", ecsazrlc.DefaultJobFinishedPattern, "Expression régulière d'une ligne de fin de job (groupes nommés job et result)")
+	jobOwnerLabel := flag.String("job-owner-label", ecsazrlc.DefaultJobOwnerLabel, "Label désignant l'agent propriétaire d'un conteneur de job (nom ou ID du conteneur agent, nom de l'agent)")
+	jobContainerNetwork := flag.Bool("job-container-network", false, "Attribuer à un agent les conteneurs partageant un de ses réseaux utilisateur")
+	statsProbe := flag.Bool("stats-probe", false, "Utiliser la consommation CPU/disque/réseau des agents en dernier recours")
+	statsCPU := flag.Float64("stats-cpu", ecsazrlc.DefaultStatsThresholds().CPUPercent, "Seuil CPU en % (100 = un cœur, 0 = ignoré)")
+	statsBlockIO := flag.Float64("stats-blkio", 0, "Seuil de débit disque en octets/s (0 = ignoré)")
+	statsNetwork := flag.Float64("stats-network", 0, "Seuil de débit réseau en octets/s (0 = ignoré)")
+	statsWindow := flag.Duration("stats-window", ecsazrlc.DefaultStatsThresholds().Window, "Durée pendant laquelle un seuil doit être dépassé")
+	statsInterval := flag.Duration("stats-interval", ecsazrlc.DefaultStatsThresholds().MinInterval, "Intervalle minimal entre deux relevés de stats d'un conteneur")
+	controlListen := flag.String("control-listen", "", "Adresse de l'API locale de contrôle: unix:///chemin.sock ou 127.0.0.1:port (vide = désactivée)")
+	maxLeaseTTL := flag.Duration("max-lease-ttl", ecsazrlc.DefaultMaxLeaseTTL, "Durée maximale d'un bail d'activité")
+	containerRuntime := flag.String("runtime", ecsazrlc.RuntimeAuto, "Runtime de conteneurs: auto, docker, podman ou containerd (socket détecté automatiquement)")
+	containerdAddress := flag.String("containerd-address", ecsazrlc.DefaultContainerdAddress, "Socket containerd")
+	containerdNamespace := flag.String("containerd-namespace", ecsazrlc.DefaultContainerdNamespace, "Namespace containerd des conteneurs agents")
+	var endpoints []ecsazrlc.EndpointConfig
+	flag.Func("endpoint", "Démon Docker supplémentaire à surveiller, répétable: [nom=]unix://...|tcp://...|ssh://...[,tlscacert=..,tlscert=..,tlskey=..] (remplace --runtime)", func(value string) error {
+		endpoint, err := ecsazrlc.ParseEndpoint(value)
+		if err != nil {
+			return err
+		}
+		endpoints = append(endpoints, endpoint)
+		return nil
+	})
+	var overdueRules []ecsazrlc.OverdueRule
+	flag.Func("job-overdue", "Durée d'occupation maximale d'un agent, répétable (première règle correspondante): [image=..,][pool=..,]max=4h[,action=alert|release|stop][,warning=10m]", func(value string) error {
+		rule, err := ecsazrlc.ParseOverdueRule(value)
+		if err != nil {
+			return err
+		}
+		overdueRules = append(overdueRules, rule)
+		return nil
+	})
+	hostProc := flag.String("host-proc", "", "Racine /proc de l'hôte pour détecter les agents hors conteneur, ex. /proc ou /host/proc (vide = désactivé) ; également lue pour les processus des conteneurs au lieu de /proc")
+	busyDir := flag.String("busy-dir", "", "Répertoire de fichiers marqueurs d'activité, ex. "+ecsazrlc.DefaultMarkerDir+" (vide = désactivé)")
+	busyMaxAge := flag.Duration("busy-max-age", 0, "Expiration d'un fichier marqueur sans échéance, depuis sa dernière modification (0 = aucune)")
+	maxProtection := flag.Duration("max-protection", 0, "Durée maximale d'activité continue signalée à ECS, même si des agents semblent occupés (0 = sans limite)")
+	publishBuildID := flag.Bool("publish-build-id", false, "Publier le build en cours dans l'attribut ECS azure-agent-build-id")
+	drainWatch := flag.Duration("drain-watch", 0, "Intervalle de vérification du statut DRAINING de l'instance (0 = désactivé)")
+	drainAction := flag.String("drain-action", "none", "Action lorsque l'instance passe en DRAINING: none, stop-after-job ou hook")
+	drainHook := flag.String("drain-hook", "", "Commande shell exécutée avec --drain-action=hook")
+	ecsEventsListen := flag.String("ecs-events-listen", "", "Adresse HTTP recevant les événements ECS (ex: 127.0.0.1:9090, vide = désactivé)")
+	drainJobTimeout := flag.Duration("drain-job-timeout", 0, "Attente maximale des jobs Azure DevOps en cours, au-delà de laquelle le drain se poursuit (0 = sans limite)")
+	warmIdleAgents := flag.Int("warm-idle-agents", 0, "Agents inactifs à conserver dans le cluster : une instance inactive n'est libérable que s'il en reste autant ailleurs (0 = désactivé)")
+	warmStaleAfter := flag.Duration("warm-stale-after", ecsazrlc.DefaultWarmPoolStaleAfter, "Âge au-delà duquel les agents inactifs d'une autre instance ne sont plus comptés")
+	selfTerminateIdle := flag.Duration("self-terminate-idle", 0, "Terminer l'instance après cette durée sans agent occupé ni bail d'activité (0 = désactivé)")
+	selfTerminateMethod := flag.String("self-terminate-method", "autoscaling", "Méthode de terminaison: autoscaling (TerminateInstanceInAutoScalingGroup) ou hook")
+	selfTerminateHook := flag.String("self-terminate-hook", "", "Commande shell exécutée avec --self-terminate-method=hook (ex: shutdown -h now)")
+	selfTerminateDrainTimeout := flag.Duration("self-terminate-drain-timeout", ecsazrlc.DefaultSelfTerminateDrainTimeout, "Attente maximale du départ des tâches ECS avant la terminaison")
+	selfTerminateRemainingTasks := flag.Int("self-terminate-remaining-tasks", 0, "Tâches ECS tolérées sur l'instance drainée (1 si ecsazrlc tourne lui-même en tâche ECS)")
+	selfTerminateDryRun := flag.Bool("self-terminate-dry-run", false, "Journaliser les étapes de l'auto-terminaison sans drainer ni terminer l'instance")
+	selfCheck := flag.Bool("self-check", false, "Lister et tester les appels de l'API Docker nécessaires à la configuration (ACL d'un proxy du socket), puis quitter")
 	flag.Parse()
 
 	if *verbose {
@@ -36,32 +115,112 @@ func main() {
 	if *enableECS && !*monitorOnly && *clusterName == "" {
 		log.Fatal("Le nom du cluster ECS est requis avec --enable-ecs (utilisez --cluster)")
 	}
+	if *enableMetrics && *clusterName == "" {
+		log.Fatal("Le nom du cluster ECS est requis avec --enable-metrics (utilisez --cluster)")
+	}
+	if *enableEventBridge && *clusterName == "" {
+		log.Fatal("Le nom du cluster ECS est requis avec --enable-eventbridge (utilisez --cluster)")
+	}
+	if *metricsFormat != "cloudwatch" && *metricsFormat != "emf" {
+		log.Fatalf("Format de métriques inconnu: %s (cloudwatch ou emf)", *metricsFormat)
+	}
+	drainActionValue, err := ecsazrlc.ParseDrainAction(*drainAction)
+	if err != nil {
+		log.Fatalf("Action de drain invalide: %v", err)
+	}
+	if drainActionValue == ecsazrlc.DrainActionHook && *drainHook == "" {
+		log.Fatal("Une commande est requise avec --drain-action=hook (utilisez --drain-hook)")
+	}
+	selfTerminateMethodValue, err := ecsazrlc.ParseTerminationMethod(*selfTerminateMethod)
+	if err != nil {
+		log.Fatalf("Méthode de terminaison invalide: %v", err)
+	}
+	if *selfTerminateIdle > 0 && selfTerminateMethodValue == ecsazrlc.TerminationMethodHook && *selfTerminateHook == "" {
+		log.Fatal("Une commande est requise avec --self-terminate-method=hook (utilisez --self-terminate-hook)")
+	}
 
 	// Préparer la configuration du moniteur
-	var excludeContainersList, excludeImagesList []string
-	if *excludeContainers != "" {
-		excludeContainersList = strings.Split(*excludeContainers, ",")
-		for i := range excludeContainersList {
-			excludeContainersList[i] = strings.TrimSpace(excludeContainersList[i])
+	excludeContainersList := splitList(*excludeContainers)
+	excludeImagesList := splitList(*excludeImages)
+
+	// Client Azure DevOps optionnel
+	var azdoClient *ecsazrlc.AzureDevOpsClient
+	if *azdoURL != "" {
+		pat, err := ecsazrlc.LoadAzureDevOpsPAT("ECSAZRLC_AZDO_PAT", *azdoPATFile)
+		if err != nil {
+			log.Fatalf("Failed to load Azure DevOps PAT: %v", err)
+		}
+		azdoClient = ecsazrlc.NewAzureDevOpsClient(*azdoURL, pat)
+		log.Printf("Azure DevOps integration enabled: %s", *azdoURL)
+	}
+
+	// Motifs de détection des jobs dans les logs des agents
+	var jobLogPatterns *ecsazrlc.LogPatterns
+	if *followLogs {
+		jobLogPatterns, err = ecsazrlc.NewLogPatterns(*jobStartedPattern, *jobFinishedPattern)
+		if err != nil {
+			log.Fatalf("Motif de log invalide: %v", err)
 		}
+		log.Println("Agent log following enabled")
 	}
-	if *excludeImages != "" {
-		excludeImagesList = strings.Split(*excludeImages, ",")
-		for i := range excludeImagesList {
-			excludeImagesList[i] = strings.TrimSpace(excludeImagesList[i])
+
+	// Seuils de consommation optionnels
+	var statsThresholds *ecsazrlc.StatsThresholds
+	if *statsProbe {
+		statsThresholds = &ecsazrlc.StatsThresholds{
+			CPUPercent:         *statsCPU,
+			BlockIOBytesPerSec: *statsBlockIO,
+			NetworkBytesPerSec: *statsNetwork,
+			Window:             *statsWindow,
+			MinInterval:        *statsInterval,
 		}
+		log.Printf("Resource usage probe enabled: %+v", *statsThresholds)
 	}
 
 	// Créer le moniteur Docker
-	monitor, err := ecsazrlc.NewMonitorWithConfig(ecsazrlc.MonitorConfig{
+	monitorConfig := ecsazrlc.MonitorConfig{
 		ExcludeContainers: excludeContainersList,
 		ExcludeImages:     excludeImagesList,
-	})
+
+		LongRunningJobAfter: *longRunningJob,
+
+		AzureDevOps:     azdoClient,
+		AzureDevOpsPool: *azdoPool,
+
+		JobLogPatterns: jobLogPatterns,
+
+		JobOwnerLabel:       *jobOwnerLabel,
+		JobContainerNetwork: *jobContainerNetwork,
+
+		Stats: statsThresholds,
+
+		MaxLeaseTTL: *maxLeaseTTL,
+
+		HostProcRoot: *hostProc,
+
+		Runtime:             *containerRuntime,
+		ContainerdAddress:   *containerdAddress,
+		ContainerdNamespace: *containerdNamespace,
+		Endpoints:           endpoints,
+
+		OverdueRules: overdueRules,
+	}
+	monitor, err := ecsazrlc.NewMonitorWithConfig(monitorConfig)
 	if err != nil {
 		log.Fatalf("Failed to create monitor: %v", err)
 	}
 	defer monitor.Stop()
 
+	// Vérifier les appels autorisés par le démon ou le proxy du socket, puis quitter
+	if *selfCheck {
+		stopAgents := *enableECS && !*monitorOnly && *drainWatch > 0 && drainActionValue == ecsazrlc.DrainActionStopAfterJob
+		if !runSelfCheck(monitor, ecsazrlc.RequiredAPIEndpoints(monitorConfig, stopAgents)) {
+			monitor.Stop()
+			os.Exit(1)
+		}
+		return
+	}
+
 	if len(excludeContainersList) > 0 {
 		log.Printf("Excluding containers: %v", excludeContainersList)
 	}
@@ -80,6 +239,7 @@ func main() {
 
 	// Créer le notificateur ECS si activé
 	var notifier *ecsazrlc.ECSNotifier
+	var warmPool *ecsazrlc.WarmPool
 	if *enableECS && !*monitorOnly {
 		notifier, err = ecsazrlc.NewECSNotifier(*clusterName, *heartbeatInterval)
 		if err != nil {
@@ -96,12 +256,140 @@ func main() {
 				log.Printf("Cluster info: %+v", clusterInfo)
 			}
 
+			notifier.SetPublishBuildID(*publishBuildID)
+			notifier.SetMaxProtection(*maxProtection)
+
+			// Désactiver les agents Azure DevOps avant tout drain de l'instance
+			if azdoClient != nil {
+				notifier.AddDrainHook(ecsazrlc.NewAgentDrainer(monitor, azdoClient, *azdoPool, *drainJobTimeout))
+				// Les étapes de drain ne s'exécutent qu'avec le suivi du DRAINING ou l'auto-terminaison
+				if *drainWatch <= 0 && *selfTerminateIdle <= 0 {
+					log.Println("Warning: Azure DevOps agents are only disabled before a drain with --drain-watch or --self-terminate-idle")
+				}
+			}
+
+			// Conserver des agents inactifs dans le cluster
+			if *warmIdleAgents > 0 {
+				warmPool = ecsazrlc.NewWarmPool(notifier, monitor, ecsazrlc.WarmPoolConfig{
+					MinIdle:    *warmIdleAgents,
+					StaleAfter: *warmStaleAfter,
+				})
+				notifier.SetWarmPool(warmPool)
+				go warmPool.Start()
+				log.Printf("Warm pool enabled (min idle agents elsewhere: %d)", *warmIdleAgents)
+			}
+
 			// Démarrer le heartbeat
 			go notifier.StartHeartbeat(monitor)
 			log.Printf("Heartbeat started with interval: %v", *heartbeatInterval)
 		}
 	}
 
+	// Démarrer la publication des métriques si activée
+	var metricsReporter *ecsazrlc.MetricsReporter
+	if *enableMetrics {
+		metricsReporter = startMetrics(notifier, *clusterName, *metricsFormat, *metricsNamespace, *heartbeatInterval, *metricsFlush, monitor)
+	}
+
+	// Publier les transitions d'état si un récepteur est configuré
+	var eventSink *ecsazrlc.EventBridgeSink
+	if *enableEventBridge {
+		eventSink, err = ecsazrlc.NewEventBridgeSink(*eventBusName, *clusterName, resolveInstanceID(notifier), *transitionInterval)
+		if err != nil {
+			log.Printf("Warning: Failed to create EventBridge sink: %v", err)
+		} else {
+			monitor.AddTransitionSink(eventSink)
+			go eventSink.Start()
+			log.Printf("EventBridge events enabled (bus: %s)", *eventBusName)
+		}
+	}
+	var webhookSink *ecsazrlc.WebhookSink
+	if *webhookURL != "" {
+		webhookSink, err = newWebhookSink(*webhookURL, *webhookHeaders, *webhookTemplate, *webhookEvents, *webhookRetries, *webhookDeadLetter, *clusterName, notifier)
+		if err != nil {
+			log.Fatalf("Failed to create webhook sink: %v", err)
+		}
+		monitor.AddTransitionSink(webhookSink)
+		go webhookSink.Start()
+		log.Printf("Webhook notifications enabled: %s", *webhookURL)
+	}
+	if eventSink != nil || webhookSink != nil {
+		if notifier != nil {
+			notifier.SetTransitionSink(monitor)
+		}
+		go monitor.WatchTransitions(*transitionInterval)
+	}
+
+	// Jobs bloqués : alerte, libération de la protection ou arrêt de l'agent
+	if len(overdueRules) > 0 {
+		go monitor.WatchOverdueJobs(*transitionInterval)
+		log.Printf("Overdue job detection enabled (%d rule(s))", len(overdueRules))
+	}
+
+	// Fichiers marqueurs d'activité
+	var markerSource *ecsazrlc.MarkerDirSource
+	if *busyDir != "" {
+		var err error
+		markerSource, err = ecsazrlc.NewMarkerDirSource(*busyDir, *busyMaxAge)
+		if err != nil {
+			log.Fatalf("Failed to watch busy marker directory: %v", err)
+		}
+		monitor.AddActivitySource(markerSource)
+		go markerSource.Start()
+		log.Printf("Busy marker directory enabled: %s", *busyDir)
+	}
+
+	// API locale de contrôle (baux d'activité, état)
+	var controlServer *ecsazrlc.ControlServer
+	if *controlListen != "" {
+		controlServer = ecsazrlc.NewControlServer(monitor, *controlListen)
+		if err := controlServer.Start(); err != nil {
+			log.Fatalf("Failed to start control API: %v", err)
+		}
+	}
+
+	// Suivre le statut DRAINING de l'instance (y compris lorsqu'il est décidé hors d'ecsazrlc)
+	var drainWatcher *ecsazrlc.DrainWatcher
+	if notifier != nil && *drainWatch > 0 {
+		drainWatcher = ecsazrlc.NewDrainWatcher(notifier, monitor, ecsazrlc.DrainWatcherConfig{
+			Interval:    *drainWatch,
+			Action:      drainActionValue,
+			HookCommand: *drainHook,
+		})
+		go drainWatcher.Start()
+		log.Printf("Drain watcher started (interval: %v, action: %s)", *drainWatch, drainActionValue)
+
+		if *ecsEventsListen != "" {
+			go func() {
+				if err := http.ListenAndServe(*ecsEventsListen, drainWatcher); err != nil {
+					log.Printf("Error serving ECS events: %v", err)
+				}
+			}()
+			log.Printf("Listening for ECS events on %s", *ecsEventsListen)
+		}
+	} else if notifier != nil && (*ecsEventsListen != "" || drainActionValue != ecsazrlc.DrainActionNone) {
+		log.Println("Warning: --ecs-events-listen and --drain-action require --drain-watch")
+	}
+
+	// Terminer l'instance lorsqu'elle reste inactive
+	var selfTerminator *ecsazrlc.SelfTerminator
+	if notifier != nil && *selfTerminateIdle > 0 {
+		selfTerminator, err = ecsazrlc.NewSelfTerminator(notifier, monitor, ecsazrlc.SelfTerminationConfig{
+			IdleAfter:      *selfTerminateIdle,
+			Method:         selfTerminateMethodValue,
+			HookCommand:    *selfTerminateHook,
+			DrainTimeout:   *selfTerminateDrainTimeout,
+			RemainingTasks: *selfTerminateRemainingTasks,
+			DryRun:         *selfTerminateDryRun,
+		})
+		if err != nil {
+			log.Printf("Warning: Failed to create self-terminator: %v", err)
+		} else {
+			go selfTerminator.Start()
+			log.Printf("Self-termination enabled (idle: %v, method: %s, dry run: %v)", *selfTerminateIdle, selfTerminateMethodValue, *selfTerminateDryRun)
+		}
+	}
+
 	// Écouter les événements d'activité
 	go func() {
 		activityChan := monitor.GetActivityChannel()
@@ -112,11 +400,23 @@ func main() {
 				event.Action,
 				event.ImageName)
 
+			if event.Job != nil {
+				log.Printf("[ACTIVITY] Job: %+v", *event.Job)
+			}
+
 			// Notifier ECS en cas d'activité importante
-			if notifier != nil && (event.Action == "start" || event.Action == "exec_start") {
+			if notifier == nil {
+				continue
+			}
+			switch event.Action {
+			case "start", "exec_start", ecsazrlc.ActionJobStarted:
 				if err := notifier.NotifyActivity(event); err != nil {
 					log.Printf("Error notifying ECS: %v", err)
 				}
+			case ecsazrlc.ActionJobFinished:
+				if err := notifier.NotifyJobFinished(event); err != nil {
+					log.Printf("Error notifying ECS: %v", err)
+				}
 			}
 		}
 	}()
@@ -131,10 +431,124 @@ func main() {
 	log.Println("\nShutdown signal received, stopping...")
 
 	// Arrêter proprement
+	if controlServer != nil {
+		controlServer.Stop()
+	}
+	if markerSource != nil {
+		markerSource.Stop()
+	}
+	if selfTerminator != nil {
+		selfTerminator.Stop()
+	}
+	if warmPool != nil {
+		warmPool.Stop()
+	}
+	if drainWatcher != nil {
+		drainWatcher.Stop()
+	}
 	if notifier != nil {
 		notifier.Stop()
 	}
+	if metricsReporter != nil {
+		metricsReporter.Stop()
+	}
 	monitor.Stop()
+	if eventSink != nil {
+		eventSink.Stop()
+	}
+	if webhookSink != nil {
+		webhookSink.Stop()
+	}
 
 	log.Println("Application stopped successfully")
 }
+
+// runSelfCheck teste les appels de l'API Docker et affiche le résultat ; retourne false si un appel indispensable est refusé
+func runSelfCheck(monitor *ecsazrlc.Monitor, endpoints []ecsazrlc.APIEndpoint) bool {
+	checks, err := monitor.SelfCheck(context.Background(), endpoints)
+	if err != nil {
+		log.Fatalf("Self-check failed: %v", err)
+	}
+	if err := ecsazrlc.WriteSelfCheck(os.Stdout, checks); err != nil {
+		log.Fatalf("Failed to write self-check: %v", err)
+	}
+	return ecsazrlc.SelfCheckPassed(checks)
+}
+
+// startMetrics crée le publieur de métriques et démarre la publication périodique
+func startMetrics(notifier *ecsazrlc.ECSNotifier, clusterName, format, namespace string, interval, flushInterval time.Duration, monitor *ecsazrlc.Monitor) *ecsazrlc.MetricsReporter {
+	var publisher ecsazrlc.MetricsPublisher
+	var err error
+	if format == "emf" {
+		publisher = ecsazrlc.NewEMFPublisher(os.Stdout, namespace)
+	} else {
+		publisher, err = ecsazrlc.NewCloudWatchPublisher(namespace)
+		if err != nil {
+			log.Printf("Warning: Failed to create CloudWatch publisher: %v", err)
+			return nil
+		}
+	}
+
+	reporter := ecsazrlc.NewMetricsReporter(publisher, clusterName, resolveInstanceID(notifier), interval, flushInterval)
+	go reporter.Start(monitor)
+	log.Printf("Metrics enabled (format: %s, namespace: %s)", format, namespace)
+	return reporter
+}
+
+// resolveInstanceID retourne l'instance ID EC2 connu du notificateur ou lu depuis les métadonnées
+func resolveInstanceID(notifier *ecsazrlc.ECSNotifier) string {
+	if notifier != nil && notifier.InstanceID() != "" {
+		return notifier.InstanceID()
+	}
+	instanceID, err := ecsazrlc.FetchInstanceID()
+	if err != nil {
+		log.Printf("Warning: Could not determine EC2 instance ID: %v", err)
+	}
+	return instanceID
+}
+
+// splitList découpe une liste séparée par des virgules en ignorant les éléments vides
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// newWebhookSink construit le récepteur webhook à partir des options de ligne de commande
+func newWebhookSink(url, headers, templateFile, events string, retries int, deadLetterFile, clusterName string, notifier *ecsazrlc.ECSNotifier) (*ecsazrlc.WebhookSink, error) {
+	config := ecsazrlc.WebhookConfig{
+		URL:            url,
+		Headers:        map[string]string{},
+		Secret:         os.Getenv("ECSAZRLC_WEBHOOK_SECRET"),
+		MaxRetries:     retries,
+		DeadLetterFile: deadLetterFile,
+		ClusterName:    clusterName,
+		InstanceID:     resolveInstanceID(notifier),
+	}
+
+	for _, header := range splitList(headers) {
+		name, value, ok := strings.Cut(header, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid webhook header %q (expected Name=Value)", header)
+		}
+		config.Headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+
+	for _, event := range splitList(events) {
+		config.Transitions = append(config.Transitions, ecsazrlc.TransitionType(event))
+	}
+
+	if templateFile != "" {
+		data, err := os.ReadFile(templateFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read webhook template: %w", err)
+		}
+		config.Template = string(data)
+	}
+
+	return ecsazrlc.NewWebhookSink(config)
+}
@@ -0,0 +1,330 @@
+package ecsazrlc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	apievents "github.com/containerd/containerd/api/events"
+	containerd "github.com/containerd/containerd/v2/client"
+	ctrdevents "github.com/containerd/containerd/v2/core/events"
+	"github.com/containerd/errdefs"
+	"github.com/containerd/typeurl/v2"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/network"
+)
+
+// RuntimeContainerd désigne containerd sans dockerd (conteneurs lancés avec nerdctl)
+const RuntimeContainerd = "containerd"
+
+// Socket et namespace containerd par défaut (ceux de nerdctl)
+const (
+	DefaultContainerdAddress   = "/run/containerd/containerd.sock"
+	DefaultContainerdNamespace = "default"
+)
+
+// Labels posés par nerdctl sur les conteneurs
+const (
+	nerdctlNameLabel     = "nerdctl/name"
+	nerdctlNetworksLabel = "nerdctl/networks"
+)
+
+// containerdSocketPath retourne le chemin du socket containerd
+func containerdSocketPath(address string) string {
+	if address == "" {
+		return DefaultContainerdAddress
+	}
+	return strings.TrimPrefix(address, "unix://")
+}
+
+// containerdRuntime interroge containerd et traduit ses réponses au format de l'API Docker
+type containerdRuntime struct {
+	client    *containerd.Client
+	address   string
+	namespace string
+	procRoot  string // /proc de l'hôte pour lire la ligne de commande des processus
+	// describe retourne le nom et l'image d'un conteneur (remplaçable pour les tests)
+	describe func(ctx context.Context, containerID string) (string, string)
+}
+
+// newContainerdRuntime se connecte au socket containerd dans le namespace donné
+func newContainerdRuntime(address, namespace, procRoot string) (*containerdRuntime, error) {
+	if namespace == "" {
+		namespace = DefaultContainerdNamespace
+	}
+	cli, err := containerd.New(containerdSocketPath(address), containerd.WithDefaultNamespace(namespace))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to containerd: %w", err)
+	}
+	log.Printf("Using containerd at %s (namespace: %s)", containerdSocketPath(address), namespace)
+
+	r := &containerdRuntime{client: cli, address: containerdSocketPath(address), namespace: namespace, procRoot: procRoot}
+	r.describe = r.lookup
+	return r, nil
+}
+
+// Name retourne le nom du runtime
+func (r *containerdRuntime) Name() string {
+	return RuntimeContainerd
+}
+
+// load retrouve un conteneur par ID complet ou par préfixe (les agents sont suivis par ID court)
+func (r *containerdRuntime) load(ctx context.Context, containerID string) (containerd.Container, error) {
+	c, err := r.client.LoadContainer(ctx, containerID)
+	if err == nil || !errdefs.IsNotFound(err) {
+		return c, err
+	}
+
+	matches, err := r.client.Containers(ctx, fmt.Sprintf(`id~="^%s"`, containerID))
+	if err != nil {
+		return nil, err
+	}
+	if len(matches) != 1 {
+		return nil, fmt.Errorf("container %s: %w", containerID, errdefs.ErrNotFound)
+	}
+	return matches[0], nil
+}
+
+// running retourne la tâche d'un conteneur si elle est en cours d'exécution
+func running(ctx context.Context, c containerd.Container) (containerd.Task, containerd.ProcessStatus) {
+	task, err := c.Task(ctx, nil)
+	if err != nil {
+		return nil, containerd.Stopped
+	}
+	status, err := task.Status(ctx)
+	if err != nil {
+		return nil, containerd.Unknown
+	}
+	return task, status.Status
+}
+
+// List retourne les conteneurs dont la tâche est en cours d'exécution
+func (r *containerdRuntime) List(ctx context.Context) ([]container.Summary, error) {
+	list, err := r.client.Containers(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containerd containers: %w", err)
+	}
+
+	var summaries []container.Summary
+	for _, c := range list {
+		if _, status := running(ctx, c); status != containerd.Running {
+			continue
+		}
+		info, err := c.Info(ctx)
+		if err != nil {
+			// Le conteneur a pu être supprimé entre-temps
+			continue
+		}
+		summaries = append(summaries, container.Summary{
+			ID:              info.ID,
+			Names:           []string{"/" + containerdName(info.ID, info.Labels)},
+			Image:           info.Image,
+			Labels:          info.Labels,
+			State:           string(containerd.Running),
+			NetworkSettings: &container.NetworkSettingsSummary{Networks: containerdNetworks(info.Labels)},
+		})
+	}
+	return summaries, nil
+}
+
+// Inspect retourne le détail d'un conteneur (environnement et hostname lus dans la spec OCI)
+func (r *containerdRuntime) Inspect(ctx context.Context, containerID string) (container.InspectResponse, error) {
+	c, err := r.load(ctx, containerID)
+	if err != nil {
+		return container.InspectResponse{}, err
+	}
+	info, err := c.Info(ctx)
+	if err != nil {
+		return container.InspectResponse{}, err
+	}
+	spec, err := c.Spec(ctx)
+	if err != nil {
+		return container.InspectResponse{}, fmt.Errorf("failed to read container spec: %w", err)
+	}
+
+	config := &container.Config{Image: info.Image, Labels: info.Labels, Hostname: spec.Hostname}
+	if spec.Process != nil {
+		config.Env = spec.Process.Env
+	}
+	_, status := running(ctx, c)
+	return container.InspectResponse{
+		ContainerJSONBase: &container.ContainerJSONBase{
+			ID:      info.ID,
+			Name:    "/" + containerdName(info.ID, info.Labels),
+			Created: info.CreatedAt.Format(time.RFC3339Nano),
+			State:   &container.State{Running: status == containerd.Running, Status: string(status)},
+		},
+		Config:          config,
+		NetworkSettings: &container.NetworkSettings{Networks: containerdNetworks(info.Labels)},
+	}, nil
+}
+
+// Top retourne les processus de la tâche, avec leur ligne de commande lue dans /proc
+func (r *containerdRuntime) Top(ctx context.Context, containerID string) (container.TopResponse, error) {
+	c, err := r.load(ctx, containerID)
+	if err != nil {
+		return container.TopResponse{}, err
+	}
+	task, status := running(ctx, c)
+	if task == nil || status != containerd.Running {
+		return container.TopResponse{}, fmt.Errorf("container %s is not running", containerID)
+	}
+	pids, err := task.Pids(ctx)
+	if err != nil {
+		return container.TopResponse{}, err
+	}
+
+	top := container.TopResponse{Titles: []string{"PID", "CMD"}}
+	for _, process := range pids {
+		pid := strconv.FormatUint(uint64(process.Pid), 10)
+		cmdline, err := os.ReadFile(filepath.Join(r.procRoot, pid, "cmdline"))
+		if err != nil {
+			continue
+		}
+		cmd := strings.TrimSpace(strings.ReplaceAll(string(cmdline), "\x00", " "))
+		top.Processes = append(top.Processes, []string{pid, cmd})
+	}
+	return top, nil
+}
+
+// Events s'abonne aux événements des tâches et conteneurs du namespace
+func (r *containerdRuntime) Events(ctx context.Context) (<-chan events.Message, <-chan error) {
+	envelopes, subscribeErrs := r.client.Subscribe(ctx,
+		fmt.Sprintf(`namespace==%s,topic~="^/tasks/"`, r.namespace),
+		fmt.Sprintf(`namespace==%s,topic~="^/containers/"`, r.namespace),
+	)
+
+	messages := make(chan events.Message)
+	errs := make(chan error, 1)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case err := <-subscribeErrs:
+				errs <- err
+				return
+			case envelope := <-envelopes:
+				message, ok := r.convert(ctx, envelope)
+				if !ok {
+					continue
+				}
+				select {
+				case messages <- message:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return messages, errs
+}
+
+// convert traduit un événement containerd en événement Docker
+func (r *containerdRuntime) convert(ctx context.Context, envelope *ctrdevents.Envelope) (events.Message, bool) {
+	if envelope == nil || envelope.Event == nil {
+		return events.Message{}, false
+	}
+	payload, err := typeurl.UnmarshalAny(envelope.Event)
+	if err != nil {
+		log.Printf("Warning: failed to decode containerd event %s: %v", envelope.Topic, err)
+		return events.Message{}, false
+	}
+
+	var containerID string
+	var action events.Action
+	attributes := map[string]string{}
+	switch event := payload.(type) {
+	case *apievents.ContainerCreate:
+		containerID, action = event.ID, events.ActionCreate
+		attributes["image"] = event.Image
+	case *apievents.ContainerDelete:
+		containerID, action = event.ID, events.ActionDestroy
+	case *apievents.TaskStart:
+		containerID, action = event.ContainerID, events.ActionStart
+	case *apievents.TaskExit:
+		// La sortie du processus principal porte l'ID du conteneur, celle d'un exec l'ID de l'exec
+		containerID, action = event.ContainerID, events.ActionDie
+		if event.ID != "" && event.ID != event.ContainerID {
+			action = events.ActionExecDie
+			attributes["execID"] = event.ID
+		}
+		attributes["exitCode"] = strconv.FormatUint(uint64(event.ExitStatus), 10)
+	case *apievents.TaskExecStarted:
+		containerID, action = event.ContainerID, events.ActionExecStart
+		attributes["execID"] = event.ExecID
+	case *apievents.TaskOOM:
+		containerID, action = event.ContainerID, events.ActionOOM
+	case *apievents.TaskPaused:
+		containerID, action = event.ContainerID, events.ActionPause
+	case *apievents.TaskResumed:
+		containerID, action = event.ContainerID, events.ActionUnPause
+	default:
+		return events.Message{}, false
+	}
+
+	name, image := r.describe(ctx, containerID)
+	attributes["name"] = name
+	if attributes["image"] == "" {
+		attributes["image"] = image
+	}
+	return events.Message{
+		Type:     events.ContainerEventType,
+		Action:   action,
+		Actor:    events.Actor{ID: containerID, Attributes: attributes},
+		Scope:    "local",
+		Time:     envelope.Timestamp.Unix(),
+		TimeNano: envelope.Timestamp.UnixNano(),
+	}, true
+}
+
+// lookup retourne le nom et l'image d'un conteneur, son ID court s'il n'existe plus
+func (r *containerdRuntime) lookup(ctx context.Context, containerID string) (string, string) {
+	c, err := r.client.LoadContainer(ctx, containerID)
+	if err != nil {
+		return shortID(containerID), ""
+	}
+	info, err := c.Info(ctx)
+	if err != nil {
+		return shortID(containerID), ""
+	}
+	return containerdName(info.ID, info.Labels), info.Image
+}
+
+// Endpoint retourne l'adresse du socket containerd
+func (r *containerdRuntime) Endpoint(containerID string) string {
+	return "unix://" + r.address
+}
+
+// Close ferme la connexion à containerd
+func (r *containerdRuntime) Close() error {
+	return r.client.Close()
+}
+
+// containerdName retourne le nom nerdctl du conteneur, à défaut son ID court
+func containerdName(containerID string, labels map[string]string) string {
+	if name := labels[nerdctlNameLabel]; name != "" {
+		return name
+	}
+	return shortID(containerID)
+}
+
+// containerdNetworks retourne les réseaux nerdctl du conteneur
+func containerdNetworks(labels map[string]string) map[string]*network.EndpointSettings {
+	networks := map[string]*network.EndpointSettings{}
+	var names []string
+	if err := json.Unmarshal([]byte(labels[nerdctlNetworksLabel]), &names); err != nil {
+		return networks
+	}
+	for _, name := range names {
+		networks[name] = &network.EndpointSettings{}
+	}
+	return networks
+}
@@ -0,0 +1,123 @@
+package ecsazrlc
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	apievents "github.com/containerd/containerd/api/events"
+	ctrdevents "github.com/containerd/containerd/v2/core/events"
+	"github.com/containerd/typeurl/v2"
+	"github.com/docker/docker/api/types/events"
+)
+
+// Conteneur agent des événements enregistrés dans testdata/containerd
+const containerdAgentID = "5c1e9a7b3d2f4e6a8b0c1d2e3f4a5b6c7d8e9f0a1b2c3d4e5f6a7b8c9d0e1f2a"
+
+// containerdPayloads associe les sujets enregistrés à leur type d'événement
+var containerdPayloads = map[string]func() any{
+	"/containers/create":  func() any { return &apievents.ContainerCreate{} },
+	"/containers/delete":  func() any { return &apievents.ContainerDelete{} },
+	"/tasks/create":       func() any { return &apievents.TaskCreate{} },
+	"/tasks/start":        func() any { return &apievents.TaskStart{} },
+	"/tasks/exec-added":   func() any { return &apievents.TaskExecAdded{} },
+	"/tasks/exec-started": func() any { return &apievents.TaskExecStarted{} },
+	"/tasks/exit":         func() any { return &apievents.TaskExit{} },
+	"/tasks/delete":       func() any { return &apievents.TaskDelete{} },
+}
+
+// loadContainerdEvents lit les événements enregistrés avec `ctr events`
+// ("<date> <heure> <décalage> <zone> <namespace> <sujet> <json>")
+func loadContainerdEvents(t *testing.T) []*ctrdevents.Envelope {
+	t.Helper()
+	file, err := os.Open(filepath.Join("testdata", "containerd", "events.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var envelopes []*ctrdevents.Envelope
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), " ", 7)
+		if len(fields) != 7 {
+			t.Fatalf("Invalid recorded event %q", scanner.Text())
+		}
+		timestamp, err := time.Parse("2006-01-02 15:04:05.999999999 -0700 MST", strings.Join(fields[:4], " "))
+		if err != nil {
+			t.Fatalf("Invalid timestamp in %q: %v", scanner.Text(), err)
+		}
+		payload := containerdPayloads[fields[5]]()
+		if err := json.Unmarshal([]byte(fields[6]), payload); err != nil {
+			t.Fatalf("Invalid payload in %q: %v", scanner.Text(), err)
+		}
+		event, err := typeurl.MarshalAny(payload)
+		if err != nil {
+			t.Fatalf("MarshalAny() error: %v", err)
+		}
+		envelopes = append(envelopes, &ctrdevents.Envelope{Timestamp: timestamp, Namespace: fields[4], Topic: fields[5], Event: event})
+	}
+	return envelopes
+}
+
+// TestContainerdEvents vérifie la traduction des événements containerd au format Docker
+func TestContainerdEvents(t *testing.T) {
+	runtime := &containerdRuntime{
+		namespace: DefaultContainerdNamespace,
+		describe: func(ctx context.Context, containerID string) (string, string) {
+			return "azp-agent-1", "docker.io/library/azp-agent:latest"
+		},
+	}
+
+	var messages []events.Message
+	for _, envelope := range loadContainerdEvents(t) {
+		if message, ok := runtime.convert(context.Background(), envelope); ok {
+			messages = append(messages, message)
+		}
+	}
+
+	expected := []events.Action{events.ActionCreate, events.ActionStart, events.ActionExecStart, events.ActionExecDie, events.ActionDie, events.ActionDestroy}
+	if len(messages) != len(expected) {
+		t.Fatalf("Expected %d converted events, got %+v", len(expected), messages)
+	}
+	for i, message := range messages {
+		if message.Action != expected[i] || message.Type != events.ContainerEventType || message.Actor.ID != containerdAgentID {
+			t.Errorf("Event %d: expected %s, got %+v", i, expected[i], message)
+		}
+		if message.Actor.Attributes["name"] != "azp-agent-1" || message.Actor.Attributes["image"] != "docker.io/library/azp-agent:latest" {
+			t.Errorf("Event %d: unexpected attributes %v", i, message.Actor.Attributes)
+		}
+	}
+
+	if execID := messages[2].Actor.Attributes["execID"]; execID != "3f0c2a9e51d4" {
+		t.Errorf("exec_start should carry the exec ID, got %q", execID)
+	}
+	if exitCode := messages[4].Actor.Attributes["exitCode"]; exitCode != "143" {
+		t.Errorf("die should carry the exit code, got %q", exitCode)
+	}
+	if messages[1].Time != time.Date(2025, 10, 9, 8, 12, 0, 0, time.UTC).Unix() {
+		t.Errorf("Unexpected event time %d", messages[1].Time)
+	}
+}
+
+// TestContainerdHelpers vérifie la lecture des labels nerdctl
+func TestContainerdHelpers(t *testing.T) {
+	labels := map[string]string{nerdctlNameLabel: "azp-agent-1", nerdctlNetworksLabel: `["bridge","ci"]`}
+	if name := containerdName(containerdAgentID, labels); name != "azp-agent-1" {
+		t.Errorf("Expected nerdctl name, got %q", name)
+	}
+	if name := containerdName(containerdAgentID, nil); name != containerdAgentID[:12] {
+		t.Errorf("Expected short ID without nerdctl name, got %q", name)
+	}
+	if networks := containerdNetworks(labels); len(networks) != 2 || networks["ci"] == nil {
+		t.Errorf("Unexpected networks %v", networks)
+	}
+	if socket := containerdSocketPath("unix:///var/run/containerd.sock"); socket != "/var/run/containerd.sock" {
+		t.Errorf("Unexpected socket path %q", socket)
+	}
+}
@@ -0,0 +1,240 @@
+package ecsazrlc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Préfixe d'une adresse de socket Unix pour l'API de contrôle
+const unixAddressPrefix = "unix://"
+
+// leaseRequest est le corps des requêtes de création et de renouvellement de bail
+type leaseRequest struct {
+	TTL    string `json:"ttl"` // Durée Go (ex: "30m")
+	Reason string `json:"reason"`
+	Holder string `json:"holder"`
+}
+
+// AgentStatus est l'état d'un agent dans la sortie de /v1/status
+type AgentStatus struct {
+	ContainerID   string        `json:"containerId"`
+	ContainerName string        `json:"containerName"`
+	Image         string        `json:"image"`
+	Endpoint      string        `json:"endpoint,omitempty"`
+	Busy          bool          `json:"busy"`
+	Reason        string        `json:"reason"`
+	Execs         []ExecSession `json:"execs,omitempty"` // Sessions docker exec ouvertes
+	BusySince     *time.Time    `json:"busySince,omitempty"`
+	JobDuration   int64         `json:"jobDurationSeconds,omitempty"` // Durée de la période d'occupation en cours
+	Overdue       bool          `json:"overdue,omitempty"`            // Au-delà de la durée maximale de sa règle JobOverdue
+	Released      bool          `json:"released,omitempty"`           // Ne protège plus l'instance (action release)
+}
+
+// Status est la réponse de /v1/status
+type Status struct {
+	HasActiveAgents bool           `json:"hasActiveAgents"`
+	Agents          []AgentStatus  `json:"agents"`
+	Leases          []Lease        `json:"leases"`
+	Holds           []ActivityHold `json:"holds"` // Maintiens d'activité de toutes les sources, baux compris
+	// Appels de l'API Docker refusés (proxy du socket), fonctions correspondantes dégradées
+	Unavailable []UnavailableCapability `json:"unavailableCapabilities,omitempty"`
+}
+
+// ControlServer expose l'API locale de contrôle (baux d'activité, état) en HTTP,
+// sur une socket Unix ou une adresse locale
+type ControlServer struct {
+	monitor  *Monitor
+	address  string
+	server   *http.Server
+	listener net.Listener
+}
+
+// NewControlServer crée le serveur de contrôle ; address est "unix:///chemin.sock" ou "127.0.0.1:port"
+func NewControlServer(monitor *Monitor, address string) *ControlServer {
+	s := &ControlServer{monitor: monitor, address: address}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/leases", s.listLeases)
+	mux.HandleFunc("POST /v1/leases", s.acquireLease)
+	mux.HandleFunc("POST /v1/leases/{id}/renew", s.renewLease)
+	mux.HandleFunc("DELETE /v1/leases/{id}", s.releaseLease)
+	mux.HandleFunc("GET /v1/status", s.status)
+
+	s.server = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	return s
+}
+
+// Start ouvre l'écoute et sert l'API en arrière-plan
+func (s *ControlServer) Start() error {
+	var err error
+	if path, ok := strings.CutPrefix(s.address, unixAddressPrefix); ok {
+		// Supprimer une socket laissée par une exécution précédente
+		os.Remove(path)
+		s.listener, err = net.Listen("unix", path)
+		if err == nil {
+			err = os.Chmod(path, 0o660)
+		}
+	} else {
+		s.listener, err = net.Listen("tcp", s.address)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.address, err)
+	}
+
+	go func() {
+		if err := s.server.Serve(s.listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Error serving control API: %v", err)
+		}
+	}()
+	log.Printf("Control API listening on %s", s.address)
+	return nil
+}
+
+// Addr retourne l'adresse d'écoute effective
+func (s *ControlServer) Addr() string {
+	if s.listener == nil {
+		return ""
+	}
+	return s.listener.Addr().String()
+}
+
+// Stop arrête le serveur de contrôle
+func (s *ControlServer) Stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	s.server.Shutdown(ctx)
+}
+
+// listLeases retourne les baux actifs
+func (s *ControlServer) listLeases(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.monitor.Leases().Active())
+}
+
+// acquireLease crée un bail
+func (s *ControlServer) acquireLease(w http.ResponseWriter, r *http.Request) {
+	request, ttl, ok := decodeLeaseRequest(w, r)
+	if !ok {
+		return
+	}
+
+	lease, err := s.monitor.Leases().Acquire(ttl, request.Reason, request.Holder)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	log.Printf("Activity lease %s acquired for %v: %s", lease.ID, lease.TTL, lease.Reason)
+	writeJSON(w, http.StatusCreated, lease)
+}
+
+// renewLease prolonge un bail
+func (s *ControlServer) renewLease(w http.ResponseWriter, r *http.Request) {
+	_, ttl, ok := decodeLeaseRequest(w, r)
+	if !ok {
+		return
+	}
+
+	lease, err := s.monitor.Leases().Renew(r.PathValue("id"), ttl)
+	switch {
+	case errors.Is(err, ErrLeaseNotFound):
+		writeError(w, http.StatusNotFound, err)
+	case err != nil:
+		writeError(w, http.StatusBadRequest, err)
+	default:
+		writeJSON(w, http.StatusOK, lease)
+	}
+}
+
+// releaseLease libère un bail
+func (s *ControlServer) releaseLease(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := s.monitor.Leases().Release(id); err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	log.Printf("Activity lease %s released", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// status retourne l'état des agents et des baux
+func (s *ControlServer) status(w http.ResponseWriter, r *http.Request) {
+	states, err := s.monitor.GetAgentStates()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	hasActive, err := s.monitor.HasActiveAgents()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	status := Status{
+		HasActiveAgents: hasActive,
+		Agents:          []AgentStatus{},
+		Leases:          s.monitor.Leases().Active(),
+		Holds:           append([]ActivityHold{}, s.monitor.ActivityHolds()...),
+		Unavailable:     s.monitor.UnavailableCapabilities(),
+	}
+	now := time.Now()
+	for _, state := range states {
+		var busySince *time.Time
+		if !state.BusySince.IsZero() {
+			busySince = &state.BusySince
+		}
+		status.Agents = append(status.Agents, AgentStatus{
+			ContainerID:   state.ContainerID,
+			ContainerName: state.ContainerName,
+			Image:         state.ImageName,
+			Endpoint:      state.Endpoint,
+			Busy:          state.Busy,
+			Reason:        state.Reason,
+			Execs:         s.monitor.ExecSessions(state.ContainerID),
+			BusySince:     busySince,
+			JobDuration:   int64(state.JobDuration(now).Seconds()),
+			Overdue:       state.Overdue,
+			Released:      state.Released,
+		})
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+// decodeLeaseRequest lit le corps d'une requête de bail (corps vide accepté)
+func decodeLeaseRequest(w http.ResponseWriter, r *http.Request) (leaseRequest, time.Duration, bool) {
+	var request leaseRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024)).Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+			return request, 0, false
+		}
+	}
+
+	var ttl time.Duration
+	if request.TTL != "" {
+		var err error
+		if ttl, err = time.ParseDuration(request.TTL); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid ttl: %w", err))
+			return request, 0, false
+		}
+	}
+	return request, ttl, true
+}
+
+// writeJSON écrit une réponse JSON
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// writeError écrit une erreur au format JSON
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,116 @@
+package ecsazrlc
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// controlClient retourne un client HTTP et l'URL de base pour une adresse de l'API de contrôle
+func controlClient(server *ControlServer, address string) (*http.Client, string) {
+	if path, ok := strings.CutPrefix(address, unixAddressPrefix); ok {
+		return &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", path)
+			},
+		}}, "http://unix"
+	}
+	return http.DefaultClient, "http://" + server.Addr()
+}
+
+// TestControlServerLeases vérifie l'API des baux et leur prise en compte dans HasActiveAgents
+func TestControlServerLeases(t *testing.T) {
+	for _, address := range []string{"127.0.0.1:0", unixAddressPrefix + filepath.Join(t.TempDir(), "ecsazrlc.sock")} {
+		t.Run(address, func(t *testing.T) {
+			monitor := newFakeDocker(t).monitor(t, MonitorConfig{})
+			server := NewControlServer(monitor, address)
+			if err := server.Start(); err != nil {
+				t.Fatalf("Start() error: %v", err)
+			}
+			defer server.Stop()
+			client, base := controlClient(server, address)
+
+			if active, _ := monitor.HasActiveAgents(); active {
+				t.Fatal("No agent and no lease: instance should be inactive")
+			}
+
+			resp, err := client.Post(base+"/v1/leases", "application/json", strings.NewReader(`{"ttl":"30m","reason":"waiting for approval","holder":"deploy"}`))
+			if err != nil {
+				t.Fatalf("POST /v1/leases failed: %v", err)
+			}
+			var lease Lease
+			json.NewDecoder(resp.Body).Decode(&lease)
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusCreated || lease.ID == "" || lease.Reason != "waiting for approval" {
+				t.Fatalf("Unexpected lease response %d: %+v", resp.StatusCode, lease)
+			}
+
+			if active, _ := monitor.HasActiveAgents(); !active {
+				t.Error("An active lease should keep the instance active")
+			}
+
+			resp, err = client.Post(base+"/v1/leases/"+lease.ID+"/renew", "application/json", nil)
+			if err != nil || resp.StatusCode != http.StatusOK {
+				t.Fatalf("Renew failed: %v (status %v)", err, resp)
+			}
+			resp.Body.Close()
+
+			resp, err = client.Get(base + "/v1/status")
+			if err != nil {
+				t.Fatalf("GET /v1/status failed: %v", err)
+			}
+			var status Status
+			json.NewDecoder(resp.Body).Decode(&status)
+			resp.Body.Close()
+			if !status.HasActiveAgents || len(status.Leases) != 1 || status.Leases[0].ID != lease.ID {
+				t.Errorf("Unexpected status: %+v", status)
+			}
+
+			req, _ := http.NewRequest(http.MethodDelete, base+"/v1/leases/"+lease.ID, nil)
+			resp, err = client.Do(req)
+			if err != nil || resp.StatusCode != http.StatusNoContent {
+				t.Fatalf("Release failed: %v (status %v)", err, resp)
+			}
+			resp.Body.Close()
+
+			if active, _ := monitor.HasActiveAgents(); active {
+				t.Error("Released lease should not keep the instance active")
+			}
+		})
+	}
+}
+
+// TestControlServerErrors vérifie les réponses d'erreur de l'API
+func TestControlServerErrors(t *testing.T) {
+	monitor := newFakeDocker(t).monitor(t, MonitorConfig{})
+	server := NewControlServer(monitor, "127.0.0.1:0")
+	if err := server.Start(); err != nil {
+		t.Fatalf("Start() error: %v", err)
+	}
+	defer server.Stop()
+	base := "http://" + server.Addr()
+
+	for _, tc := range []struct {
+		method, path, body string
+		status             int
+	}{
+		{http.MethodPost, "/v1/leases", `{"ttl":"soon","reason":"x"}`, http.StatusBadRequest},
+		{http.MethodPost, "/v1/leases", `{"ttl":"10m"}`, http.StatusBadRequest},
+		{http.MethodPost, "/v1/leases/unknown/renew", `{}`, http.StatusNotFound},
+		{http.MethodDelete, "/v1/leases/unknown", ``, http.StatusNotFound},
+	} {
+		req, _ := http.NewRequest(tc.method, base+tc.path, strings.NewReader(tc.body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s failed: %v", tc.method, tc.path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.status {
+			t.Errorf("%s %s: status %d, want %d", tc.method, tc.path, resp.StatusCode, tc.status)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package ecsazrlc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// fakeContainer décrit un conteneur servi par le faux démon Docker
+type fakeContainer struct {
+	ID        string
+	Name      string
+	Image     string
+	Env       []string
+	Labels    map[string]string
+	Processes []string                // Lignes de commande retournées par /top
+	Logs      []string                // Lignes retournées par /logs (horodatage Docker inclus)
+	Networks  []string                // Réseaux auxquels le conteneur est connecté
+	Stats     container.StatsResponse // Réponse de /stats
+	Paused    bool                    // Conteneur en pause
+	ExecIDs   []string                // Sessions exec retournées par l'inspection
+	Health    []string                // Commande du healthcheck (Test de la configuration)
+	StartedAt time.Time               // Démarrage de l'exécution en cours (zéro = inconnu)
+}
+
+// networks retourne les réseaux du conteneur au format de l'API
+func (c *fakeContainer) networks() map[string]*network.EndpointSettings {
+	networks := map[string]*network.EndpointSettings{}
+	for _, name := range c.Networks {
+		networks[name] = &network.EndpointSettings{NetworkID: name}
+	}
+	return networks
+}
+
+// healthcheck retourne la configuration du healthcheck d'un faux conteneur
+func healthcheck(test []string) *container.HealthConfig {
+	if len(test) == 0 {
+		return nil
+	}
+	return &container.HealthConfig{Test: test}
+}
+
+// fakeDocker simule le sous-ensemble de l'API Docker utilisé par le moniteur
+type fakeDocker struct {
+	mu         sync.Mutex
+	server     *httptest.Server
+	containers []*fakeContainer
+	routes     map[string]http.HandlerFunc // Routes supplémentaires par motif "METHOD /chemin"
+	lists      int                         // Listes des conteneurs demandées
+}
+
+var apiVersionPrefix = regexp.MustCompile(`^/v[0-9.]+`)
+
+// newFakeDocker démarre un faux démon Docker
+func newFakeDocker(t *testing.T, containers ...*fakeContainer) *fakeDocker {
+	t.Helper()
+	f := &fakeDocker{containers: containers, routes: map[string]http.HandlerFunc{}}
+	f.server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+// route ajoute un gestionnaire pour une méthode et un préfixe de chemin
+func (f *fakeDocker) route(pattern string, handler http.HandlerFunc) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.routes[pattern] = handler
+}
+
+// listCalls retourne le nombre de listes des conteneurs demandées
+func (f *fakeDocker) listCalls() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.lists
+}
+
+// find retourne le conteneur correspondant à un ID (ou préfixe) ou à un nom
+func (f *fakeDocker) find(ref string) *fakeContainer {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, c := range f.containers {
+		if strings.HasPrefix(c.ID, ref) || c.Name == ref {
+			return c
+		}
+	}
+	return nil
+}
+
+func (f *fakeDocker) serve(w http.ResponseWriter, r *http.Request) {
+	path := apiVersionPrefix.ReplaceAllString(r.URL.Path, "")
+
+	f.mu.Lock()
+	for pattern, handler := range f.routes {
+		method, prefix, _ := strings.Cut(pattern, " ")
+		if r.Method == method && strings.HasPrefix(path, prefix) {
+			f.mu.Unlock()
+			handler(w, r)
+			return
+		}
+	}
+	f.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case path == "/_ping":
+		w.Write([]byte("OK"))
+
+	case path == "/containers/json":
+		f.mu.Lock()
+		f.lists++
+		var list []container.Summary
+		for _, c := range f.containers {
+			state := container.StateRunning
+			if c.Paused {
+				state = container.StatePaused
+			}
+			list = append(list, container.Summary{
+				ID: c.ID, Names: []string{"/" + c.Name}, Image: c.Image, Labels: c.Labels, State: state,
+				NetworkSettings: &container.NetworkSettingsSummary{Networks: c.networks()},
+			})
+		}
+		f.mu.Unlock()
+		json.NewEncoder(w).Encode(list)
+
+	case strings.HasPrefix(path, "/containers/") && strings.HasSuffix(path, "/json"):
+		c := f.find(strings.TrimSuffix(strings.TrimPrefix(path, "/containers/"), "/json"))
+		if c == nil {
+			http.Error(w, `{"message":"No such container"}`, http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(container.InspectResponse{
+			ContainerJSONBase: &container.ContainerJSONBase{
+				ID:      c.ID,
+				Name:    "/" + c.Name,
+				State:   &container.State{Running: true, Status: "running", StartedAt: c.StartedAt.UTC().Format(time.RFC3339Nano)},
+				ExecIDs: c.ExecIDs,
+			},
+			Config:          &container.Config{Image: c.Image, Env: c.Env, Labels: c.Labels, Hostname: shortID(c.ID), Healthcheck: healthcheck(c.Health)},
+			NetworkSettings: &container.NetworkSettings{Networks: c.networks()},
+		})
+
+	case strings.HasPrefix(path, "/containers/") && strings.HasSuffix(path, "/top"):
+		c := f.find(strings.TrimSuffix(strings.TrimPrefix(path, "/containers/"), "/top"))
+		if c == nil {
+			http.Error(w, `{"message":"No such container"}`, http.StatusNotFound)
+			return
+		}
+		top := container.TopResponse{Titles: []string{"UID", "PID", "CMD"}}
+		for i, cmd := range c.Processes {
+			top.Processes = append(top.Processes, []string{"root", string(rune('1' + i)), cmd})
+		}
+		json.NewEncoder(w).Encode(top)
+
+	case strings.HasPrefix(path, "/containers/") && strings.HasSuffix(path, "/stats"):
+		c := f.find(strings.TrimSuffix(strings.TrimPrefix(path, "/containers/"), "/stats"))
+		if c == nil {
+			http.Error(w, `{"message":"No such container"}`, http.StatusNotFound)
+			return
+		}
+		f.mu.Lock()
+		stats := c.Stats
+		f.mu.Unlock()
+		json.NewEncoder(w).Encode(stats)
+
+	case strings.HasPrefix(path, "/containers/") && strings.HasSuffix(path, "/logs"):
+		c := f.find(strings.TrimSuffix(strings.TrimPrefix(path, "/containers/"), "/logs"))
+		if c == nil {
+			http.Error(w, `{"message":"No such container"}`, http.StatusNotFound)
+			return
+		}
+		// Flux multiplexé stdout/stderr (conteneur sans TTY)
+		w.Header().Set("Content-Type", "application/vnd.docker.multiplexed-stream")
+		stdout := stdcopy.NewStdWriter(w, stdcopy.Stdout)
+		for _, line := range filterLogs(c.Logs, r.URL.Query()) {
+			stdout.Write([]byte(line + "\n"))
+		}
+
+	default:
+		http.Error(w, `{"message":"not implemented"}`, http.StatusNotFound)
+	}
+}
+
+// client retourne un client Docker pointant vers le faux démon
+func (f *fakeDocker) client(t *testing.T) *client.Client {
+	t.Helper()
+	cli, err := client.NewClientWithOpts(
+		client.WithHost("tcp://"+strings.TrimPrefix(f.server.URL, "http://")),
+		client.WithVersion("1.47"),
+		client.WithHTTPClient(f.server.Client()),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create Docker client: %v", err)
+	}
+	return cli
+}
+
+// monitor crée un moniteur connecté au faux démon
+func (f *fakeDocker) monitor(t *testing.T, config MonitorConfig) *Monitor {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	m := newMonitor(ctx, cancel, newDockerRuntime(f.client(t), false), config)
+	t.Cleanup(cancel)
+	return m
+}
+
+// filterLogs applique les options since et tail de /logs
+func filterLogs(lines []string, query url.Values) []string {
+	if since := query.Get("since"); since != "" {
+		secondsPart, nanosPart, _ := strings.Cut(since, ".")
+		seconds, _ := strconv.ParseInt(secondsPart, 10, 64)
+		nanos, _ := strconv.ParseInt(nanosPart, 10, 64)
+		from := time.Unix(seconds, nanos)
+		var kept []string
+		for _, line := range lines {
+			if timestamp, _ := splitLogTimestamp(line); !timestamp.Before(from) {
+				kept = append(kept, line)
+			}
+		}
+		lines = kept
+	}
+	if tail, err := strconv.Atoi(query.Get("tail")); err == nil && tail < len(lines) {
+		lines = lines[len(lines)-tail:]
+	}
+	return lines
+}
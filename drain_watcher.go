@@ -0,0 +1,348 @@
+package ecsazrlc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/docker/docker/api/types/container"
+)
+
+// Attributs ECS décrivant la progression d'un drain
+const (
+	attrDrain     = "azure-agent-drain"      // in-progress ou complete
+	attrDrainBusy = "azure-agent-drain-busy" // Nombre d'agents encore occupés
+)
+
+// DrainAction est l'action appliquée aux agents lorsque l'instance passe en DRAINING
+type DrainAction string
+
+const (
+	DrainActionNone         DrainAction = "none"           // Émettre l'événement et suivre la progression uniquement
+	DrainActionStopAfterJob DrainAction = "stop-after-job" // Arrêter chaque conteneur agent dès qu'il est inactif
+	DrainActionHook         DrainAction = "hook"           // Exécuter une commande externe
+)
+
+// ParseDrainAction valide le nom d'une action de drain
+func ParseDrainAction(value string) (DrainAction, error) {
+	switch action := DrainAction(value); action {
+	case DrainActionNone, DrainActionStopAfterJob, DrainActionHook:
+		return action, nil
+	default:
+		return "", fmt.Errorf("unknown drain action %q (none, stop-after-job or hook)", value)
+	}
+}
+
+// DrainWatcherConfig contient la configuration du suivi du statut ECS
+type DrainWatcherConfig struct {
+	Interval    time.Duration // Intervalle d'interrogation de DescribeContainerInstances
+	Action      DrainAction
+	HookCommand string        // Commande shell exécutée avec l'action "hook"
+	StopTimeout time.Duration // Délai laissé à un conteneur pour s'arrêter
+}
+
+// DrainWatcher détecte le passage en DRAINING de notre instance, y compris lorsqu'il
+// est décidé hors d'ecsazrlc (capacity provider, opérateur)
+type DrainWatcher struct {
+	notifier *ECSNotifier
+	monitor  *Monitor
+	config   DrainWatcherConfig
+	mu       sync.Mutex
+	draining bool
+	complete bool
+	// Annule la préparation du drain externe en cours lorsque l'instance redevient ACTIVE
+	prepareCancel context.CancelFunc
+	prepareDone   chan struct{} // Fermé à la fin de la préparation en arrière-plan
+	checkNow      chan struct{}
+	stopChan      chan struct{}
+	done          chan struct{}
+}
+
+// NewDrainWatcher crée un suivi du statut de l'instance
+func NewDrainWatcher(notifier *ECSNotifier, monitor *Monitor, config DrainWatcherConfig) *DrainWatcher {
+	if config.Action == "" {
+		config.Action = DrainActionNone
+	}
+	if config.StopTimeout <= 0 {
+		config.StopTimeout = 30 * time.Second
+	}
+	return &DrainWatcher{
+		notifier: notifier,
+		monitor:  monitor,
+		config:   config,
+		checkNow: make(chan struct{}, 1),
+		stopChan: make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start interroge périodiquement le statut de l'instance (bloquant jusqu'à Stop)
+func (w *DrainWatcher) Start() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.config.Interval)
+	defer ticker.Stop()
+
+	w.check()
+	for {
+		select {
+		case <-ticker.C:
+			w.check()
+		case <-w.checkNow:
+			w.check()
+		case <-w.stopChan:
+			return
+		}
+	}
+}
+
+// Stop arrête le suivi
+func (w *DrainWatcher) Stop() {
+	close(w.stopChan)
+	<-w.done
+}
+
+// Draining indique si l'instance est actuellement en DRAINING
+func (w *DrainWatcher) Draining() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.draining
+}
+
+// check relève le statut ECS de l'instance et traite les changements
+func (w *DrainWatcher) check() {
+	status, err := w.notifier.ContainerInstanceStatus(w.notifier.ctx)
+	if err != nil {
+		log.Printf("Error checking container instance status: %v", err)
+		return
+	}
+
+	w.mu.Lock()
+	wasDraining := w.draining
+	w.draining = status == string(types.ContainerInstanceStatusDraining)
+	draining := w.draining
+	w.mu.Unlock()
+
+	switch {
+	case draining && !wasDraining:
+		w.startDrain()
+	case !draining && wasDraining:
+		w.cancelDrain()
+	}
+	if draining {
+		w.progress()
+	}
+}
+
+// startDrain réagit au passage en DRAINING
+func (w *DrainWatcher) startDrain() {
+	w.complete = false
+	ctx := w.notifier.ctx
+
+	if w.notifier.DrainRequested() {
+		// Drain décidé par ecsazrlc : l'événement a été émis et les étapes exécutées par Drain
+		log.Println("Container instance is DRAINING (requested by ecsazrlc)")
+	} else {
+		log.Println("Container instance set to DRAINING externally")
+		w.notifier.emit(StateTransition{
+			Type:   TransitionInstanceDraining,
+			Reason: "instance set to DRAINING externally",
+		})
+
+		// Empêcher les agents de prendre de nouveaux jobs ; l'attente des jobs se fait
+		// en arrière-plan pour ne pas bloquer le suivi
+		prepareCtx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		w.prepareCancel = cancel
+		w.prepareDone = done
+		go func() {
+			defer close(done)
+			for _, hook := range w.notifier.drainHooks {
+				if err := hook.PrepareDrain(prepareCtx); err != nil {
+					log.Printf("Error preparing external drain: %v", err)
+				}
+			}
+		}()
+	}
+
+	if w.config.Action == DrainActionHook && w.config.HookCommand != "" {
+		w.runHook(ctx)
+	}
+}
+
+// cancelDrain réagit au retour en ACTIVE de l'instance
+func (w *DrainWatcher) cancelDrain() {
+	log.Println("Container instance is ACTIVE again, drain cancelled")
+	if w.prepareCancel != nil {
+		// La préparation doit être terminée avant d'être annulée : une désactivation
+		// d'agent encore en vol serait sinon appliquée après la réactivation
+		w.prepareCancel()
+		<-w.prepareDone
+		w.prepareCancel = nil
+		w.prepareDone = nil
+	}
+	w.notifier.cancelDrainHooks(w.notifier.ctx, w.notifier.drainHooks)
+	if err := w.notifier.putInstanceAttributes(map[string]string{attrDrain: "cancelled", attrDrainBusy: "0"}); err != nil {
+		log.Printf("Error reporting drain progress: %v", err)
+	}
+}
+
+// progress applique l'action de drain et publie la progression dans les attributs ECS
+func (w *DrainWatcher) progress() {
+	states, err := w.monitor.GetAgentStates()
+	if err != nil {
+		log.Printf("Error checking agent states during drain: %v", err)
+		return
+	}
+
+	busy := 0
+	for _, state := range states {
+		if state.Busy {
+			busy++
+			continue
+		}
+		if w.config.Action == DrainActionStopAfterJob {
+			w.stopAgent(state)
+		}
+	}
+
+	status := "in-progress"
+	if busy == 0 {
+		status = "complete"
+	}
+	if w.complete && busy == 0 {
+		return
+	}
+	w.complete = busy == 0
+
+	if err := w.notifier.putInstanceAttributes(map[string]string{attrDrain: status, attrDrainBusy: strconv.Itoa(busy)}); err != nil {
+		log.Printf("Error reporting drain progress: %v", err)
+		return
+	}
+	log.Printf("Drain progress: %s (%d busy agent(s))", status, busy)
+}
+
+// stopAgent arrête un conteneur agent inactif
+func (w *DrainWatcher) stopAgent(state AgentState) {
+	if state.HostPID != 0 {
+		// Un agent de l'hôte est géré par son service système, pas par ecsazrlc
+		return
+	}
+	if err := w.monitor.stopAgent(state, w.config.StopTimeout); err != nil {
+		log.Printf("Error stopping idle agent %s: %v", state.ContainerName, err)
+		return
+	}
+	log.Printf("Idle agent %s stopped for drain", state.ContainerName)
+}
+
+// stopAgent arrête le conteneur d'un agent en lui laissant timeout pour s'arrêter proprement
+func (m *Monitor) stopAgent(state AgentState, timeout time.Duration) error {
+	if state.HostPID != 0 {
+		return fmt.Errorf("host agent %s is managed by its system service", state.ContainerName)
+	}
+	cli := m.dockerClientFor(state.ContainerID)
+	if cli == nil {
+		return fmt.Errorf("stopping agents is not supported with %s", m.runtime.Name())
+	}
+	seconds := int(timeout.Seconds())
+	return m.dockerCall(state.ContainerID, CapabilityStop, func() error {
+		return cli.ContainerStop(m.ctx, state.ContainerID, container.StopOptions{Timeout: &seconds})
+	})
+}
+
+// runHook exécute la commande de drain avec le contexte de l'instance en variables d'environnement
+func (w *DrainWatcher) runHook(ctx context.Context) {
+	output, err := w.notifier.runInstanceHook(ctx, w.config.HookCommand)
+	if err != nil {
+		log.Printf("Error running drain hook: %v (output: %s)", err, output)
+		return
+	}
+	log.Printf("Drain hook completed: %s", output)
+}
+
+// runInstanceHook exécute une commande shell avec le contexte de l'instance en variables d'environnement
+func (n *ECSNotifier) runInstanceHook(ctx context.Context, command string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Env = append(os.Environ(),
+		"ECSAZRLC_CLUSTER="+n.clusterName,
+		"ECSAZRLC_CONTAINER_INSTANCE_ARN="+n.containerInstanceARN,
+		"ECSAZRLC_INSTANCE_ID="+n.instanceID,
+	)
+	return cmd.CombinedOutput()
+}
+
+// ecsStateChangeEvent est le sous-ensemble utile d'un événement
+// "ECS Container Instance State Change" transmis par EventBridge
+type ecsStateChangeEvent struct {
+	DetailType string `json:"detail-type"`
+	Detail     struct {
+		ContainerInstanceArn string `json:"containerInstanceArn"`
+		Status               string `json:"status"`
+	} `json:"detail"`
+}
+
+// ServeHTTP reçoit les événements ECS (destination d'API EventBridge) et déclenche
+// une vérification immédiate lorsqu'ils concernent notre instance
+func (w *DrainWatcher) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var event ecsStateChangeEvent
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&event); err != nil {
+		http.Error(rw, "invalid event", http.StatusBadRequest)
+		return
+	}
+
+	if event.Detail.ContainerInstanceArn == w.notifier.containerInstanceARN {
+		log.Printf("ECS event received: %s (%s)", event.DetailType, event.Detail.Status)
+		select {
+		case w.checkNow <- struct{}{}:
+		default:
+		}
+	}
+	rw.WriteHeader(http.StatusAccepted)
+}
+
+// ContainerInstanceStatus retourne le statut ECS (ACTIVE, DRAINING...) de notre instance
+func (n *ECSNotifier) ContainerInstanceStatus(ctx context.Context) (string, error) {
+	instance, err := n.describeContainerInstance(ctx)
+	if err != nil {
+		return "", err
+	}
+	if instance.Status == nil {
+		return "", fmt.Errorf("container instance %s has no status", n.containerInstanceARN)
+	}
+	return *instance.Status, nil
+}
+
+// describeContainerInstance retourne la description ECS de notre instance
+func (n *ECSNotifier) describeContainerInstance(ctx context.Context) (types.ContainerInstance, error) {
+	if n.containerInstanceARN == "" {
+		return types.ContainerInstance{}, fmt.Errorf("container instance ARN not set")
+	}
+
+	result, err := n.ecsClient.DescribeContainerInstances(ctx, &ecs.DescribeContainerInstancesInput{
+		Cluster:            aws.String(n.clusterName),
+		ContainerInstances: []string{n.containerInstanceARN},
+	})
+	if err != nil {
+		return types.ContainerInstance{}, fmt.Errorf("failed to describe container instance: %w", err)
+	}
+	if len(result.ContainerInstances) == 0 {
+		return types.ContainerInstance{}, fmt.Errorf("container instance %s not found", n.containerInstanceARN)
+	}
+	return result.ContainerInstances[0], nil
+}
@@ -0,0 +1,256 @@
+package ecsazrlc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// drainFixture regroupe les faux services utilisés par les tests du suivi de drain
+type drainFixture struct {
+	ecs      *fakeECS
+	docker   *fakeDocker
+	notifier *ECSNotifier
+	sink     *recordingSink
+	mu       sync.Mutex
+	status   string
+	stopped  []string
+}
+
+// newDrainFixture crée une instance avec un agent occupé et un agent inactif
+func newDrainFixture(t *testing.T) *drainFixture {
+	t.Helper()
+	f := &drainFixture{ecs: newFakeECS(t), sink: &recordingSink{}, status: "ACTIVE"}
+	f.ecs.handle("DescribeContainerInstances", func(body map[string]interface{}) interface{} {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		return map[string]interface{}{
+			"containerInstances": []interface{}{fakeInstance("arn:instance", "i-123", f.status, nil)},
+		}
+	})
+
+	f.docker = newFakeDocker(t,
+		&fakeContainer{ID: "aaaaaaaaaaaa0001", Name: "agent-busy", Image: "azp-agent:latest", Processes: []string{"Agent.Listener", "Agent.Worker"}},
+		&fakeContainer{ID: "bbbbbbbbbbbb0002", Name: "agent-idle", Image: "azp-agent:latest", Processes: []string{"Agent.Listener"}},
+	)
+	f.docker.route("POST /containers/", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		f.stopped = append(f.stopped, strings.Split(r.URL.Path, "/")[3])
+		f.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	f.notifier = newTestNotifier(t, f.ecs)
+	f.notifier.SetTransitionSink(f.sink)
+	return f
+}
+
+// stoppedContainers retourne les conteneurs arrêtés
+func (f *drainFixture) stoppedContainers() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.stopped...)
+}
+
+// setStatus change le statut ECS renvoyé pour l'instance
+func (f *drainFixture) setStatus(status string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.status = status
+}
+
+// lastAttributes retourne les attributs du dernier appel PutAttributes
+func (f *drainFixture) lastAttributes(t *testing.T) map[string]string {
+	t.Helper()
+	calls := f.ecs.callsTo("PutAttributes")
+	if len(calls) == 0 {
+		t.Fatal("Expected PutAttributes to be called")
+	}
+	values := map[string]string{}
+	for _, attr := range calls[len(calls)-1].Body["attributes"].([]interface{}) {
+		attribute := attr.(map[string]interface{})
+		values[attribute["name"].(string)] = attribute["value"].(string)
+	}
+	return values
+}
+
+// TestDrainWatcherExternalDrain vérifie la réaction à un DRAINING décidé hors d'ecsazrlc
+func TestDrainWatcherExternalDrain(t *testing.T) {
+	f := newDrainFixture(t)
+	journal := &hookJournal{}
+	hook := &orderedHook{name: "azdo", journal: journal}
+	f.notifier.AddDrainHook(hook)
+
+	watcher := NewDrainWatcher(f.notifier, f.docker.monitor(t, MonitorConfig{}), DrainWatcherConfig{
+		Interval: time.Minute,
+		Action:   DrainActionStopAfterJob,
+	})
+
+	watcher.check()
+	if watcher.Draining() || len(f.sink.types()) != 0 {
+		t.Fatal("Nothing should happen while the instance is ACTIVE")
+	}
+
+	f.setStatus("DRAINING")
+	watcher.check()
+	if !watcher.Draining() {
+		t.Fatal("Watcher should report the instance as draining")
+	}
+	if types := f.sink.types(); len(types) != 1 || types[0] != TransitionInstanceDraining {
+		t.Errorf("Expected an InstanceDraining transition, got %v", types)
+	}
+	if stopped := f.stoppedContainers(); len(stopped) != 1 || !strings.HasPrefix("bbbbbbbbbbbb0002", stopped[0]) {
+		t.Errorf("Only the idle agent should be stopped, got %v", stopped)
+	}
+	attributes := f.lastAttributes(t)
+	if attributes[attrDrain] != "in-progress" || attributes[attrDrainBusy] != "1" {
+		t.Errorf("Unexpected drain progress attributes: %v", attributes)
+	}
+
+	f.setStatus("ACTIVE")
+	watcher.check()
+	if watcher.Draining() {
+		t.Error("Watcher should report the instance as active again")
+	}
+	if f.lastAttributes(t)[attrDrain] != "cancelled" {
+		t.Error("Expected drain to be reported as cancelled")
+	}
+
+	// La préparation s'exécute en arrière-plan ; l'annulation doit avoir été demandée
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) && !containsString(journal.list(), "cancel azdo") {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !containsString(journal.list(), "cancel azdo") {
+		t.Errorf("Expected drain hooks to be cancelled, got %v", journal.list())
+	}
+}
+
+// TestDrainWatcherCancelDuringPrepare vérifie qu'un agent désactivé pendant l'annulation du drain est réactivé
+func TestDrainWatcherCancelDuringPrepare(t *testing.T) {
+	azdo := newFakeAzureDevOps(t)
+	azdo.pools["Linux"] = 3
+	azdo.agents[3] = []PoolAgent{{ID: 10, Name: "agent-a", Enabled: true}, {ID: 11, Name: "agent-b", Enabled: true}}
+	azdo.patchDelay = 100 * time.Millisecond
+
+	f := newDrainFixture(t)
+	f.docker.containers[0].Env = []string{"AZP_AGENT_NAME=agent-a", "AZP_POOL=Linux"}
+	f.docker.containers[1].Env = []string{"AZP_AGENT_NAME=agent-b", "AZP_POOL=Linux"}
+	monitor := f.docker.monitor(t, MonitorConfig{})
+	f.notifier.AddDrainHook(NewAgentDrainer(monitor, NewAzureDevOpsClient(azdo.server.URL, "pat"), "", 0))
+	watcher := NewDrainWatcher(f.notifier, monitor, DrainWatcherConfig{Interval: time.Minute})
+
+	// Le drain est annulé pendant la désactivation de l'agent
+	f.setStatus("DRAINING")
+	watcher.check()
+	deadline := time.Now().Add(2 * time.Second)
+	for azdo.receivedPatches() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	f.setStatus("ACTIVE")
+	watcher.check()
+
+	// Attendre le traitement des requêtes en cours par le serveur
+	time.Sleep(3 * azdo.patchDelay)
+	if !azdo.agent(3, "agent-a").Enabled || !azdo.agent(3, "agent-b").Enabled {
+		t.Error("Agents disabled while the drain was cancelled should be re-enabled")
+	}
+}
+
+// TestDrainWatcherRequestedDrain vérifie qu'un drain demandé par ecsazrlc n'est pas signalé deux fois
+func TestDrainWatcherRequestedDrain(t *testing.T) {
+	f := newDrainFixture(t)
+	if err := f.notifier.SetProtectionEnabled(false); err != nil {
+		t.Fatalf("SetProtectionEnabled() error: %v", err)
+	}
+
+	watcher := NewDrainWatcher(f.notifier, f.docker.monitor(t, MonitorConfig{}), DrainWatcherConfig{Interval: time.Minute})
+	f.setStatus("DRAINING")
+	watcher.check()
+
+	if types := f.sink.types(); len(types) != 1 {
+		t.Errorf("Expected a single InstanceDraining transition, got %v", types)
+	}
+	if len(f.stoppedContainers()) != 0 {
+		t.Error("No container should be stopped with the default action")
+	}
+}
+
+// TestDrainWatcherHook vérifie l'exécution de la commande de drain
+func TestDrainWatcherHook(t *testing.T) {
+	f := newDrainFixture(t)
+	output := filepath.Join(t.TempDir(), "hook.out")
+
+	watcher := NewDrainWatcher(f.notifier, f.docker.monitor(t, MonitorConfig{}), DrainWatcherConfig{
+		Interval:    time.Minute,
+		Action:      DrainActionHook,
+		HookCommand: `echo "$ECSAZRLC_CLUSTER $ECSAZRLC_CONTAINER_INSTANCE_ARN" > ` + output,
+	})
+	f.setStatus("DRAINING")
+	watcher.check()
+
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatalf("Hook was not run: %v", err)
+	}
+	if strings.TrimSpace(string(data)) != "test-cluster arn:instance" {
+		t.Errorf("Unexpected hook environment: %q", data)
+	}
+}
+
+// TestDrainWatcherECSEvent vérifie qu'un événement ECS déclenche une vérification immédiate
+func TestDrainWatcherECSEvent(t *testing.T) {
+	f := newDrainFixture(t)
+	watcher := NewDrainWatcher(f.notifier, f.docker.monitor(t, MonitorConfig{}), DrainWatcherConfig{Interval: time.Hour})
+	go watcher.Start()
+	defer watcher.Stop()
+
+	server := httptest.NewServer(watcher)
+	defer server.Close()
+
+	f.setStatus("DRAINING")
+	event := `{"detail-type":"ECS Container Instance State Change","detail":{"containerInstanceArn":"arn:instance","status":"DRAINING"}}`
+	resp, err := http.Post(server.URL, "application/json", strings.NewReader(event))
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Errorf("Expected status 202, got %d", resp.StatusCode)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) && !watcher.Draining() {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !watcher.Draining() {
+		t.Error("ECS event should trigger an immediate status check")
+	}
+}
+
+// TestParseDrainAction vérifie la validation des actions de drain
+func TestParseDrainAction(t *testing.T) {
+	for _, value := range []string{"none", "stop-after-job", "hook"} {
+		if _, err := ParseDrainAction(value); err != nil {
+			t.Errorf("ParseDrainAction(%q) error: %v", value, err)
+		}
+	}
+	if _, err := ParseDrainAction("terminate"); err == nil {
+		t.Error("Expected an error for an unknown action")
+	}
+}
+
+// containsString indique si la liste contient la valeur
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"slices"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -14,6 +17,13 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
 )
 
+// Attributs ECS publiés sur l'instance de conteneur
+const (
+	attrActivity  = "azure-agent-activity"
+	attrLastCheck = "azure-agent-last-check"
+	attrBuildID   = "azure-agent-build-id"
+)
+
 // ECSNotifier gère la communication avec ECS pour signaler l'activité
 type ECSNotifier struct {
 	ecsClient            *ecs.Client
@@ -21,9 +31,32 @@ type ECSNotifier struct {
 	clusterName          string
 	taskARN              string
 	containerInstanceARN string
+	instanceID           string
 	heartbeatInterval    time.Duration
 	stopChan             chan struct{}
 	ctx                  context.Context
+	transitions          TransitionSink // Récepteur des transitions de l'instance (optionnel)
+	drainHooks           []DrainHook
+	mu                   sync.Mutex
+	drainRequested       bool           // DRAINING demandé par ecsazrlc (et non par un tiers)
+	publishBuildID       bool           // Publier le build en cours dans l'attribut azure-agent-build-id
+	runningBuilds        []runningBuild // Builds en cours par agent, du plus ancien au plus récent
+	protection           protectionCap  // Durée maximale d'activité continue signalée
+	warmPool             *WarmPool      // Maintien d'agents inactifs dans le cluster (optionnel)
+}
+
+// runningBuild est le build en cours d'un agent, publié dans l'attribut azure-agent-build-id
+type runningBuild struct {
+	containerID string
+	buildID     string
+}
+
+// DrainHook prépare l'instance avant qu'elle soit libérée (drain) et annule cette préparation
+type DrainHook interface {
+	// PrepareDrain est appelé avant le passage en DRAINING ; peut bloquer jusqu'à la fin des jobs
+	PrepareDrain(ctx context.Context) error
+	// CancelDrain annule la préparation lorsque le drain est abandonné
+	CancelDrain(ctx context.Context) error
 }
 
 // NewECSNotifier crée une nouvelle instance du notificateur ECS
@@ -31,9 +64,9 @@ func NewECSNotifier(clusterName string, heartbeatInterval time.Duration) (*ECSNo
 	ctx := context.Background()
 
 	// Charger la configuration AWS
-	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(getAWSRegion()))
+	cfg, err := loadAWSConfig(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+		return nil, err
 	}
 
 	ecsClient := ecs.NewFromConfig(cfg)
@@ -56,6 +89,15 @@ func NewECSNotifier(clusterName string, heartbeatInterval time.Duration) (*ECSNo
 	return notifier, nil
 }
 
+// loadAWSConfig charge la configuration AWS par défaut pour la région courante
+func loadAWSConfig(ctx context.Context) (aws.Config, error) {
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(getAWSRegion()))
+	if err != nil {
+		return aws.Config{}, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	return cfg, nil
+}
+
 // getAWSRegion retourne la région AWS depuis les variables d'environnement ou métadonnées
 func getAWSRegion() string {
 	if region := os.Getenv("AWS_REGION"); region != "" {
@@ -67,14 +109,13 @@ func getAWSRegion() string {
 	return "us-east-1" // Région par défaut
 }
 
-// fetchInstanceInfo récupère les informations de l'instance ECS
-func (n *ECSNotifier) fetchInstanceInfo() error {
-	// Récupérer l'instance ID depuis les métadonnées
-	instanceIDOutput, err := n.ec2MetadataClient.GetMetadata(n.ctx, &imds.GetMetadataInput{
+// fetchEC2InstanceID lit l'instance ID EC2 depuis les métadonnées
+func fetchEC2InstanceID(ctx context.Context, client *imds.Client) (string, error) {
+	instanceIDOutput, err := client.GetMetadata(ctx, &imds.GetMetadataInput{
 		Path: "instance-id",
 	})
 	if err != nil {
-		return fmt.Errorf("failed to get instance ID: %w", err)
+		return "", fmt.Errorf("failed to get instance ID: %w", err)
 	}
 
 	instanceID := instanceIDOutput.Content
@@ -84,9 +125,29 @@ func (n *ECSNotifier) fetchInstanceInfo() error {
 	buf := make([]byte, 256)
 	bytesRead, err := instanceID.Read(buf)
 	if err != nil {
-		return fmt.Errorf("failed to read instance ID: %w", err)
+		return "", fmt.Errorf("failed to read instance ID: %w", err)
 	}
-	instanceIDStr := string(buf[:bytesRead])
+	return string(buf[:bytesRead]), nil
+}
+
+// FetchInstanceID retourne l'instance ID EC2 de la machine courante
+func FetchInstanceID() (string, error) {
+	ctx := context.Background()
+	cfg, err := loadAWSConfig(ctx)
+	if err != nil {
+		return "", err
+	}
+	return fetchEC2InstanceID(ctx, imds.NewFromConfig(cfg))
+}
+
+// fetchInstanceInfo récupère les informations de l'instance ECS
+func (n *ECSNotifier) fetchInstanceInfo() error {
+	// Récupérer l'instance ID depuis les métadonnées
+	instanceIDStr, err := fetchEC2InstanceID(n.ctx, n.ec2MetadataClient)
+	if err != nil {
+		return err
+	}
+	n.instanceID = instanceIDStr
 
 	// Lister les instances du cluster pour trouver la nôtre
 	input := &ecs.ListContainerInstancesInput{
@@ -124,43 +185,114 @@ func (n *ECSNotifier) fetchInstanceInfo() error {
 	return fmt.Errorf("could not find container instance for EC2 instance %s", instanceIDStr)
 }
 
-// SendActivitySignal envoie un signal d'activité à ECS
+// SendActivitySignal envoie un signal d'activité à ECS. Au-delà de la durée maximale d'activité
+// continue (SetMaxProtection), l'instance est signalée inactive et l'attribut
+// azure-agent-protection-capped est publié, jusqu'au retour à l'inactivité.
 func (n *ECSNotifier) SendActivitySignal(hasActivity bool) error {
+	now := time.Now()
+	assert, changed := n.protection.observe(hasActivity, now)
+	cappedAt := n.protection.capped()
+	if changed {
+		n.reportProtectionCap(cappedAt, now)
+	}
+
 	if n.containerInstanceARN == "" {
 		log.Println("Container instance ARN not set, skipping ECS notification")
 		return nil
 	}
 
 	// Mettre à jour les attributs de l'instance pour signaler l'activité
-	timestamp := time.Now().Unix()
+	timestamp := now.Unix()
 	activityStatus := "inactive"
-	if hasActivity {
+	if assert {
 		activityStatus = "active"
 	}
 
-	input := &ecs.PutAttributesInput{
-		Cluster: aws.String(n.clusterName),
-		Attributes: []types.Attribute{
-			{
-				Name:  aws.String("azure-agent-activity"),
-				Value: aws.String(activityStatus),
-			},
-			{
-				Name:  aws.String("azure-agent-last-check"),
-				Value: aws.String(fmt.Sprintf("%d", timestamp)),
-			},
-		},
-	}
-
-	_, err := n.ecsClient.PutAttributes(n.ctx, input)
-	if err != nil {
-		return fmt.Errorf("failed to put attributes: %w", err)
+	values := map[string]string{
+		attrActivity:  activityStatus,
+		attrLastCheck: fmt.Sprintf("%d", timestamp),
+	}
+	if n.warmPool != nil {
+		values[attrIdleAgents] = fmt.Sprintf("%d", n.warmPool.IdleAgents())
+	}
+	if !cappedAt.IsZero() {
+		values[attrProtectionCapped] = fmt.Sprintf("%d", cappedAt.Unix())
+	}
+	if err := n.putInstanceAttributes(values); err != nil {
+		return err
+	}
+	if !cappedAt.IsZero() {
+		n.protection.setAttributePublished(true)
+	} else if n.protection.attributePublished() {
+		// Retiré à chaque signal jusqu'à ce que la suppression aboutisse
+		if err := n.deleteInstanceAttribute(attrProtectionCapped); err != nil {
+			return err
+		}
+		n.protection.setAttributePublished(false)
 	}
 
 	log.Printf("Activity signal sent to ECS: %s (timestamp: %d)", activityStatus, timestamp)
 	return nil
 }
 
+// SetMaxProtection définit la durée maximale pendant laquelle l'instance est signalée active
+// sans interruption, quelle que soit l'activité détectée (0 = sans limite)
+func (n *ECSNotifier) SetMaxProtection(max time.Duration) {
+	n.protection.setMax(max)
+}
+
+// ProtectionCapped indique si la durée maximale de protection est atteinte
+func (n *ECSNotifier) ProtectionCapped() bool {
+	return !n.protection.capped().IsZero()
+}
+
+// reportProtectionCap journalise et publie l'atteinte ou la levée du plafond de protection
+func (n *ECSNotifier) reportProtectionCap(cappedAt, now time.Time) {
+	if cappedAt.IsZero() {
+		log.Println("Instance idle again, protection cap lifted")
+		return
+	}
+	max := n.protection.maxDuration()
+	log.Printf("Warning: instance reported active for %s, protection is no longer asserted", max)
+	n.emit(StateTransition{
+		Type:      TransitionProtectionCapped,
+		Reason:    fmt.Sprintf("instance continuously active for %s, protection no longer asserted", max),
+		Timestamp: now,
+	})
+}
+
+// putInstanceAttributes publie des attributs sur notre instance de conteneur
+func (n *ECSNotifier) putInstanceAttributes(values map[string]string) error {
+	if n.containerInstanceARN == "" {
+		return fmt.Errorf("container instance ARN not set")
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	attributes := make([]types.Attribute, 0, len(names))
+	for _, name := range names {
+		attributes = append(attributes, types.Attribute{
+			Name:       aws.String(name),
+			Value:      aws.String(values[name]),
+			TargetType: types.TargetTypeContainerInstance,
+			TargetId:   aws.String(n.containerInstanceARN),
+		})
+	}
+
+	_, err := n.ecsClient.PutAttributes(n.ctx, &ecs.PutAttributesInput{
+		Cluster:    aws.String(n.clusterName),
+		Attributes: attributes,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put attributes: %w", err)
+	}
+	return nil
+}
+
 // StartHeartbeat démarre l'envoi périodique de signaux de vie
 func (n *ECSNotifier) StartHeartbeat(monitor *Monitor) {
 	ticker := time.NewTicker(n.heartbeatInterval)
@@ -171,7 +303,7 @@ func (n *ECSNotifier) StartHeartbeat(monitor *Monitor) {
 	for {
 		select {
 		case <-ticker.C:
-			hasActivity, err := monitor.HasActiveAgents()
+			hasActivity, err := n.instanceActivity(monitor)
 			if err != nil {
 				log.Printf("Error checking for active agents: %v", err)
 				continue
@@ -188,10 +320,90 @@ func (n *ECSNotifier) StartHeartbeat(monitor *Monitor) {
 	}
 }
 
+// instanceActivity indique l'activité à signaler : agents présents, ou décision du warm pool s'il est configuré
+func (n *ECSNotifier) instanceActivity(monitor *Monitor) (bool, error) {
+	if n.warmPool != nil {
+		return n.warmPool.Active()
+	}
+	return monitor.HasActiveAgents()
+}
+
+// SetWarmPool active le maintien d'agents inactifs dans le cluster : une instance dont les agents
+// sont inactifs n'est signalée inactive que si le warm pool l'autorise
+func (n *ECSNotifier) SetWarmPool(pool *WarmPool) {
+	n.warmPool = pool
+}
+
 // NotifyActivity envoie immédiatement une notification d'activité
 func (n *ECSNotifier) NotifyActivity(event ActivityEvent) error {
 	log.Printf("Notifying ECS of Azure Agent activity: %s - %s", event.Action, event.ContainerName)
-	return n.SendActivitySignal(true)
+	if err := n.SendActivitySignal(true); err != nil {
+		return err
+	}
+
+	if n.publishBuildID && event.Job != nil && event.Job.BuildID != "" && n.containerInstanceARN != "" {
+		n.mu.Lock()
+		n.runningBuilds = append(withoutBuildOf(n.runningBuilds, event.ContainerID), runningBuild{containerID: event.ContainerID, buildID: event.Job.BuildID})
+		n.mu.Unlock()
+		if err := n.putInstanceAttributes(map[string]string{attrBuildID: event.Job.BuildID}); err != nil {
+			return err
+		}
+		log.Printf("Current build ID published to ECS: %s", event.Job.BuildID)
+	}
+	return nil
+}
+
+// NotifyJobFinished retire le build terminé des attributs de l'instance ; si d'autres agents
+// exécutent encore un job, le build le plus récent parmi eux est publié à sa place
+func (n *ECSNotifier) NotifyJobFinished(event ActivityEvent) error {
+	if !n.publishBuildID || n.containerInstanceARN == "" {
+		return nil
+	}
+
+	n.mu.Lock()
+	n.runningBuilds = withoutBuildOf(n.runningBuilds, event.ContainerID)
+	var current string
+	if len(n.runningBuilds) > 0 {
+		current = n.runningBuilds[len(n.runningBuilds)-1].buildID
+	}
+	n.mu.Unlock()
+
+	if current == "" {
+		return n.deleteInstanceAttribute(attrBuildID)
+	}
+	if err := n.putInstanceAttributes(map[string]string{attrBuildID: current}); err != nil {
+		return err
+	}
+	log.Printf("Current build ID published to ECS: %s", current)
+	return nil
+}
+
+// withoutBuildOf retire le build en cours d'un agent
+func withoutBuildOf(builds []runningBuild, containerID string) []runningBuild {
+	return slices.DeleteFunc(builds, func(build runningBuild) bool {
+		return build.containerID == containerID
+	})
+}
+
+// deleteInstanceAttribute retire un attribut de notre instance de conteneur
+func (n *ECSNotifier) deleteInstanceAttribute(name string) error {
+	_, err := n.ecsClient.DeleteAttributes(n.ctx, &ecs.DeleteAttributesInput{
+		Cluster: aws.String(n.clusterName),
+		Attributes: []types.Attribute{{
+			Name:       aws.String(name),
+			TargetType: types.TargetTypeContainerInstance,
+			TargetId:   aws.String(n.containerInstanceARN),
+		}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete attributes: %w", err)
+	}
+	return nil
+}
+
+// SetPublishBuildID active la publication du build en cours dans un attribut ECS
+func (n *ECSNotifier) SetPublishBuildID(enabled bool) {
+	n.publishBuildID = enabled
 }
 
 // SetProtectionEnabled active/désactive la protection contre la terminaison
@@ -218,10 +430,86 @@ func (n *ECSNotifier) SetProtectionEnabled(enabled bool) error {
 		return fmt.Errorf("failed to update instance state: %w", err)
 	}
 
+	n.mu.Lock()
+	n.drainRequested = !enabled
+	n.mu.Unlock()
+
 	log.Printf("Instance protection set to: %v", enabled)
+	if !enabled {
+		n.emit(StateTransition{
+			Type:   TransitionInstanceDraining,
+			Reason: "instance set to DRAINING by ecsazrlc",
+		})
+	}
 	return nil
 }
 
+// DrainRequested indique si le passage en DRAINING a été demandé par ecsazrlc
+func (n *ECSNotifier) DrainRequested() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.drainRequested
+}
+
+// emit transmet une transition de l'instance au récepteur configuré
+func (n *ECSNotifier) emit(transition StateTransition) {
+	if n.transitions == nil {
+		return
+	}
+	if transition.Timestamp.IsZero() {
+		transition.Timestamp = time.Now()
+	}
+	n.transitions.HandleTransition(transition)
+}
+
+// AddDrainHook ajoute une étape exécutée avant chaque drain de l'instance
+func (n *ECSNotifier) AddDrainHook(hook DrainHook) {
+	n.drainHooks = append(n.drainHooks, hook)
+}
+
+// Drain prépare l'instance (hooks) puis la passe en DRAINING.
+// Si une étape échoue, les étapes déjà exécutées sont annulées.
+func (n *ECSNotifier) Drain(ctx context.Context) error {
+	for i, hook := range n.drainHooks {
+		if err := hook.PrepareDrain(ctx); err != nil {
+			n.cancelDrainHooks(ctx, n.drainHooks[:i+1])
+			return fmt.Errorf("failed to prepare drain: %w", err)
+		}
+	}
+
+	if err := n.SetProtectionEnabled(false); err != nil {
+		n.cancelDrainHooks(ctx, n.drainHooks)
+		return err
+	}
+	return nil
+}
+
+// CancelDrain repasse l'instance en ACTIVE et annule la préparation du drain
+func (n *ECSNotifier) CancelDrain(ctx context.Context) error {
+	err := n.SetProtectionEnabled(true)
+	n.cancelDrainHooks(ctx, n.drainHooks)
+	return err
+}
+
+// cancelDrainHooks annule les hooks donnés, dans l'ordre inverse
+func (n *ECSNotifier) cancelDrainHooks(ctx context.Context, hooks []DrainHook) {
+	for i := len(hooks) - 1; i >= 0; i-- {
+		if err := hooks[i].CancelDrain(ctx); err != nil {
+			log.Printf("Error cancelling drain step: %v", err)
+		}
+	}
+}
+
+// SetTransitionSink définit le récepteur des transitions émises par le notificateur
+func (n *ECSNotifier) SetTransitionSink(sink TransitionSink) {
+	n.transitions = sink
+}
+
+// InstanceID retourne l'instance ID EC2 détecté (vide si inconnu)
+func (n *ECSNotifier) InstanceID() string {
+	return n.instanceID
+}
+
 // Stop arrête le notificateur
 func (n *ECSNotifier) Stop() {
 	close(n.stopChan)
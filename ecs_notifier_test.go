@@ -262,3 +262,95 @@ func BenchmarkNotifyActivity(b *testing.B) {
 		notifier.NotifyActivity(event)
 	}
 }
+
+// TestSendActivitySignalTargetsInstance vérifie que les attributs ciblent l'instance de conteneur
+func TestSendActivitySignalTargetsInstance(t *testing.T) {
+	fake := newFakeECS(t)
+	notifier := newTestNotifier(t, fake)
+	notifier.containerInstanceARN = "arn:aws:ecs:us-east-1:123:container-instance/test/abc"
+
+	if err := notifier.SendActivitySignal(true); err != nil {
+		t.Fatalf("SendActivitySignal() error: %v", err)
+	}
+
+	calls := fake.callsTo("PutAttributes")
+	if len(calls) != 1 {
+		t.Fatalf("Expected 1 PutAttributes call, got %d", len(calls))
+	}
+	for _, raw := range calls[0].Body["attributes"].([]interface{}) {
+		attr := raw.(map[string]interface{})
+		if attr["targetId"] != notifier.containerInstanceARN {
+			t.Errorf("Attribute %v should target the container instance", attr["name"])
+		}
+	}
+}
+
+// TestPublishBuildID vérifie la publication et le retrait du build en cours
+func TestPublishBuildID(t *testing.T) {
+	fake := newFakeECS(t)
+	notifier := newTestNotifier(t, fake)
+	event := ActivityEvent{ContainerName: "agent-1", Action: ActionJobStarted, Job: &JobMetadata{BuildID: "1234"}}
+
+	// Désactivé par défaut
+	if err := notifier.NotifyActivity(event); err != nil {
+		t.Fatalf("NotifyActivity() error: %v", err)
+	}
+	if len(fake.callsTo("PutAttributes")) != 1 {
+		t.Fatal("Build ID should not be published unless enabled")
+	}
+
+	notifier.SetPublishBuildID(true)
+	if err := notifier.NotifyActivity(event); err != nil {
+		t.Fatalf("NotifyActivity() error: %v", err)
+	}
+	calls := fake.callsTo("PutAttributes")
+	attr := calls[len(calls)-1].Body["attributes"].([]interface{})[0].(map[string]interface{})
+	if attr["name"] != attrBuildID || attr["value"] != "1234" {
+		t.Errorf("Unexpected build ID attribute: %v", attr)
+	}
+
+	if err := notifier.NotifyJobFinished(event); err != nil {
+		t.Fatalf("NotifyJobFinished() error: %v", err)
+	}
+	deletes := fake.callsTo("DeleteAttributes")
+	if len(deletes) != 1 {
+		t.Fatalf("Expected 1 DeleteAttributes call, got %d", len(deletes))
+	}
+	if attr := deletes[0].Body["attributes"].([]interface{})[0].(map[string]interface{}); attr["name"] != attrBuildID {
+		t.Errorf("Unexpected deleted attribute: %v", attr)
+	}
+}
+
+// TestPublishBuildIDSeveralAgents vérifie que le build d'un agent encore occupé reste publié
+func TestPublishBuildIDSeveralAgents(t *testing.T) {
+	fake := newFakeECS(t)
+	notifier := newTestNotifier(t, fake)
+	notifier.SetPublishBuildID(true)
+	first := ActivityEvent{ContainerID: "aaaaaaaaaaaa", ContainerName: "agent-1", Action: ActionJobStarted, Job: &JobMetadata{BuildID: "1234"}}
+	second := ActivityEvent{ContainerID: "bbbbbbbbbbbb", ContainerName: "agent-2", Action: ActionJobStarted, Job: &JobMetadata{BuildID: "5678"}}
+	for _, event := range []ActivityEvent{first, second} {
+		if err := notifier.NotifyActivity(event); err != nil {
+			t.Fatalf("NotifyActivity() error: %v", err)
+		}
+	}
+
+	// agent-2 termine : le build d'agent-1 est republié
+	if err := notifier.NotifyJobFinished(second); err != nil {
+		t.Fatalf("NotifyJobFinished() error: %v", err)
+	}
+	if deletes := fake.callsTo("DeleteAttributes"); len(deletes) != 0 {
+		t.Fatalf("Build ID should not be deleted while agent-1 runs a job, got %d DeleteAttributes calls", len(deletes))
+	}
+	calls := fake.callsTo("PutAttributes")
+	if values := attributeValues(calls[len(calls)-1]); values[attrBuildID] != "1234" {
+		t.Errorf("Expected the build of agent-1 to be published, got %v", values)
+	}
+
+	// agent-1 termine à son tour : plus aucun build en cours
+	if err := notifier.NotifyJobFinished(first); err != nil {
+		t.Fatalf("NotifyJobFinished() error: %v", err)
+	}
+	if deletes := fake.callsTo("DeleteAttributes"); len(deletes) != 1 {
+		t.Errorf("Expected 1 DeleteAttributes call once no job runs, got %d", len(deletes))
+	}
+}
@@ -0,0 +1,129 @@
+package ecsazrlc
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+)
+
+// ecsCall enregistre un appel reçu par le faux serveur ECS
+type ecsCall struct {
+	Operation string
+	Body      map[string]interface{}
+}
+
+// fakeECS simule une API AWS au protocole JSON 1.1 (ECS, EventBridge) sur un serveur HTTP local
+type fakeECS struct {
+	mu       sync.Mutex
+	server   *httptest.Server
+	handlers map[string]func(body map[string]interface{}) interface{}
+	calls    []ecsCall
+}
+
+// newFakeECS démarre un faux serveur ECS
+func newFakeECS(t *testing.T) *fakeECS {
+	t.Helper()
+	f := &fakeECS{handlers: map[string]func(map[string]interface{}) interface{}{}}
+	f.server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+// newTestNotifier crée un notificateur de l'instance "arn:instance" (EC2 i-123) du cluster
+// "test-cluster", branché sur le faux ECS ; les tests ajustent ensuite les champs utiles
+func newTestNotifier(t *testing.T, fake *fakeECS) *ECSNotifier {
+	t.Helper()
+	return &ECSNotifier{
+		ecsClient:            fake.client(),
+		clusterName:          "test-cluster",
+		containerInstanceARN: "arn:instance",
+		instanceID:           "i-123",
+		ctx:                  context.Background(),
+	}
+}
+
+// handle enregistre la réponse d'une opération ECS
+func (f *fakeECS) handle(operation string, handler func(body map[string]interface{}) interface{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.handlers[operation] = handler
+}
+
+// callsTo retourne les appels reçus pour une opération
+func (f *fakeECS) callsTo(operation string) []ecsCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var calls []ecsCall
+	for _, call := range f.calls {
+		if call.Operation == operation {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+func (f *fakeECS) serve(w http.ResponseWriter, r *http.Request) {
+	target := r.Header.Get("X-Amz-Target")
+	operation := target[strings.LastIndex(target, ".")+1:]
+
+	data, _ := io.ReadAll(r.Body)
+	body := map[string]interface{}{}
+	json.Unmarshal(data, &body)
+
+	f.mu.Lock()
+	f.calls = append(f.calls, ecsCall{Operation: operation, Body: body})
+	handler := f.handlers[operation]
+	f.mu.Unlock()
+
+	var response interface{} = map[string]interface{}{}
+	if handler != nil {
+		response = handler(body)
+	}
+
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	if failure, ok := response.(ecsError); ok {
+		w.Header().Set("X-Amzn-ErrorType", failure.Type)
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"__type": failure.Type, "message": failure.Message})
+		return
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// ecsError est une réponse d'erreur de l'API ECS, retournée par un gestionnaire
+type ecsError struct {
+	Type    string
+	Message string
+}
+
+// client retourne un client ECS pointant vers le faux serveur
+func (f *fakeECS) client() *ecs.Client {
+	return ecs.New(ecs.Options{
+		Region:           "us-east-1",
+		BaseEndpoint:     aws.String(f.server.URL),
+		Credentials:      aws.AnonymousCredentials{},
+		RetryMaxAttempts: 1,
+	})
+}
+
+// fakeInstance construit une instance de conteneur au format de l'API ECS
+func fakeInstance(arn, ec2ID, status string, attributes map[string]string) map[string]interface{} {
+	var attrs []map[string]interface{}
+	for name, value := range attributes {
+		attrs = append(attrs, map[string]interface{}{"name": name, "value": value})
+	}
+	return map[string]interface{}{
+		"containerInstanceArn": arn,
+		"ec2InstanceId":        ec2ID,
+		"status":               status,
+		"attributes":           attrs,
+	}
+}
@@ -0,0 +1,87 @@
+package ecsazrlc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// EMFPublisher écrit les métriques d'activité au format CloudWatch Embedded Metric Format.
+// Chaque point est une ligne JSON ; le driver awslogs la convertit en métrique sans appel API.
+type EMFPublisher struct {
+	writer    io.Writer
+	namespace string
+	mu        sync.Mutex
+}
+
+// NewEMFPublisher crée un publieur EMF écrivant sur writer (en général la sortie standard)
+func NewEMFPublisher(writer io.Writer, namespace string) *EMFPublisher {
+	if namespace == "" {
+		namespace = DefaultMetricsNamespace
+	}
+	return &EMFPublisher{
+		writer:    writer,
+		namespace: namespace,
+	}
+}
+
+// emfMetricDefinition décrit une métrique dans le bloc _aws
+type emfMetricDefinition struct {
+	Name string `json:"Name"`
+	Unit string `json:"Unit"`
+}
+
+// emfDirective décrit un ensemble de métriques et leurs dimensions
+type emfDirective struct {
+	Namespace  string                `json:"Namespace"`
+	Dimensions [][]string            `json:"Dimensions"`
+	Metrics    []emfMetricDefinition `json:"Metrics"`
+}
+
+// emfMetadata est le bloc _aws d'un document EMF
+type emfMetadata struct {
+	Timestamp         int64          `json:"Timestamp"`
+	CloudWatchMetrics []emfDirective `json:"CloudWatchMetrics"`
+}
+
+// Publish écrit immédiatement une ligne EMF
+func (p *EMFPublisher) Publish(metrics ActivityMetrics) error {
+	directive := emfDirective{
+		Namespace:  p.namespace,
+		Dimensions: [][]string{{"ClusterName"}},
+	}
+	document := map[string]interface{}{
+		"ClusterName": metrics.ClusterName,
+	}
+	if metrics.InstanceID != "" {
+		directive.Dimensions = append([][]string{{"ClusterName", "InstanceId"}}, directive.Dimensions...)
+		document["InstanceId"] = metrics.InstanceID
+	}
+
+	for _, value := range metrics.values() {
+		directive.Metrics = append(directive.Metrics, emfMetricDefinition{Name: value.Name, Unit: value.Unit})
+		document[value.Name] = value.Value
+	}
+	document["_aws"] = emfMetadata{
+		Timestamp:         metrics.Timestamp.UnixMilli(),
+		CloudWatchMetrics: []emfDirective{directive},
+	}
+
+	line, err := json.Marshal(document)
+	if err != nil {
+		return fmt.Errorf("failed to encode EMF document: %w", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, err := p.writer.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write EMF document: %w", err)
+	}
+	return nil
+}
+
+// Flush ne fait rien : les lignes EMF sont écrites immédiatement
+func (p *EMFPublisher) Flush() error {
+	return nil
+}
@@ -0,0 +1,62 @@
+package ecsazrlc
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestEMFPublisher vérifie le format des lignes Embedded Metric Format
+func TestEMFPublisher(t *testing.T) {
+	var out bytes.Buffer
+	publisher := NewEMFPublisher(&out, "")
+
+	timestamp := time.UnixMilli(1_700_000_000_123)
+	metrics := ActivityMetrics{ClusterName: "test-cluster", InstanceID: "i-123", Timestamp: timestamp, BusyAgents: 1, IdleAgents: 2}
+	if err := publisher.Publish(metrics); err != nil {
+		t.Fatalf("Publish() error: %v", err)
+	}
+	if err := publisher.Publish(metrics); err != nil {
+		t.Fatalf("Publish() error: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected one JSON line per publish, got %d", len(lines))
+	}
+
+	var document struct {
+		AWS struct {
+			Timestamp         int64
+			CloudWatchMetrics []emfDirective
+		} `json:"_aws"`
+		ClusterName string
+		InstanceId  string
+		BusyAgents  float64
+		IdleAgents  float64
+		TotalAgents float64
+	}
+	if err := json.Unmarshal([]byte(lines[0]), &document); err != nil {
+		t.Fatalf("Invalid EMF line: %v", err)
+	}
+
+	if document.AWS.Timestamp != timestamp.UnixMilli() {
+		t.Errorf("Timestamp = %d, want %d", document.AWS.Timestamp, timestamp.UnixMilli())
+	}
+	if document.ClusterName != "test-cluster" || document.InstanceId != "i-123" {
+		t.Errorf("Unexpected dimension values: %+v", document)
+	}
+	if document.BusyAgents != 1 || document.IdleAgents != 2 || document.TotalAgents != 3 {
+		t.Errorf("Unexpected metric values: %+v", document)
+	}
+
+	directive := document.AWS.CloudWatchMetrics[0]
+	if directive.Namespace != DefaultMetricsNamespace || len(directive.Metrics) != len(metrics.values()) {
+		t.Errorf("Unexpected directive: %+v", directive)
+	}
+	if len(directive.Dimensions) != 2 || len(directive.Dimensions[0]) != 2 {
+		t.Errorf("Expected per-instance and per-cluster dimension sets, got %v", directive.Dimensions)
+	}
+}
@@ -0,0 +1,363 @@
+package ecsazrlc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/client"
+)
+
+// Délais de reconnexion au flux d'événements d'un endpoint
+const (
+	endpointRetryMin = time.Second
+	endpointRetryMax = 30 * time.Second
+)
+
+// EndpointConfig décrit un démon Docker à surveiller
+type EndpointConfig struct {
+	Name      string // Nom reporté dans ActivityEvent.Endpoint (Host si vide)
+	Host      string // unix:///chemin.sock, tcp://hôte:port ou ssh://utilisateur@hôte[:port]
+	TLSCACert string // Certificats TLS pour tcp:// (optionnels)
+	TLSCert   string
+	TLSKey    string
+}
+
+// ParseEndpoint lit un endpoint au format "[nom=]hôte[,tlscacert=...,tlscert=...,tlskey=...]"
+func ParseEndpoint(value string) (EndpointConfig, error) {
+	parts := strings.Split(value, ",")
+	var endpoint EndpointConfig
+	if name, host, ok := strings.Cut(parts[0], "="); ok && !strings.Contains(name, "://") {
+		endpoint.Name, endpoint.Host = name, host
+	} else {
+		endpoint.Host = parts[0]
+	}
+
+	for _, option := range parts[1:] {
+		key, val, _ := strings.Cut(option, "=")
+		switch key {
+		case "tlscacert":
+			endpoint.TLSCACert = val
+		case "tlscert":
+			endpoint.TLSCert = val
+		case "tlskey":
+			endpoint.TLSKey = val
+		default:
+			return EndpointConfig{}, fmt.Errorf("unknown endpoint option %q", key)
+		}
+	}
+
+	u, err := url.Parse(endpoint.Host)
+	if err != nil {
+		return EndpointConfig{}, fmt.Errorf("invalid endpoint host %q: %w", endpoint.Host, err)
+	}
+	switch u.Scheme {
+	case "unix", "tcp", "ssh":
+	default:
+		return EndpointConfig{}, fmt.Errorf("unsupported endpoint scheme %q (expected unix, tcp or ssh)", u.Scheme)
+	}
+	if (endpoint.TLSCert == "") != (endpoint.TLSKey == "") {
+		return EndpointConfig{}, errors.New("tlscert and tlskey must be set together")
+	}
+	if endpoint.Name == "" {
+		endpoint.Name = endpoint.Host
+	}
+	return endpoint, nil
+}
+
+// newEndpointClient crée le client Docker d'un endpoint
+func newEndpointClient(endpoint EndpointConfig) (*client.Client, error) {
+	opts := []client.Opt{client.WithAPIVersionNegotiation()}
+
+	u, err := url.Parse(endpoint.Host)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "ssh" {
+		// Tunnel via "docker system dial-stdio" sur l'hôte distant, comme le CLI Docker
+		opts = append(opts, client.WithHost("http://docker.example.com"), client.WithDialContext(sshDialer(u)))
+	} else {
+		opts = append(opts, client.WithHost(endpoint.Host))
+	}
+	if endpoint.TLSCACert != "" || endpoint.TLSCert != "" {
+		opts = append(opts, client.WithTLSClientConfig(endpoint.TLSCACert, endpoint.TLSCert, endpoint.TLSKey))
+	}
+	return client.NewClientWithOpts(opts...)
+}
+
+// sshDialer ouvre une connexion au démon distant à travers ssh
+func sshDialer(u *url.URL) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	args := []string{"-o", "ConnectTimeout=10"}
+	if u.Port() != "" {
+		args = append(args, "-p", u.Port())
+	}
+	target := u.Hostname()
+	if u.User != nil {
+		target = u.User.Username() + "@" + target
+	}
+	args = append(args, "--", target, "docker", "system", "dial-stdio")
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		cmd := exec.Command("ssh", args...)
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			return nil, err
+		}
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			return nil, err
+		}
+		if err := cmd.Start(); err != nil {
+			return nil, fmt.Errorf("failed to start ssh: %w", err)
+		}
+		return &commandConn{cmd: cmd, stdin: stdin, stdout: stdout, remote: u.Host}, nil
+	}
+}
+
+// commandConn présente l'entrée et la sortie d'une commande comme une connexion réseau
+type commandConn struct {
+	cmd       *exec.Cmd
+	stdin     io.WriteCloser
+	stdout    io.ReadCloser
+	remote    string
+	closeOnce sync.Once
+}
+
+func (c *commandConn) Read(p []byte) (int, error)  { return c.stdout.Read(p) }
+func (c *commandConn) Write(p []byte) (int, error) { return c.stdin.Write(p) }
+
+// Close ferme les flux et arrête la commande
+func (c *commandConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.stdin.Close()
+		c.cmd.Process.Kill()
+		c.cmd.Wait()
+	})
+	return nil
+}
+
+func (c *commandConn) LocalAddr() net.Addr                { return commandAddr("ssh") }
+func (c *commandConn) RemoteAddr() net.Addr               { return commandAddr(c.remote) }
+func (c *commandConn) SetDeadline(t time.Time) error      { return nil }
+func (c *commandConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *commandConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// commandAddr est l'adresse d'une commandConn
+type commandAddr string
+
+func (a commandAddr) Network() string { return "ssh" }
+func (a commandAddr) String() string  { return string(a) }
+
+// multiRuntime agrège plusieurs démons Docker ; chaque flux d'événements est surveillé
+// indépendamment et reconnecté en cas de coupure
+type multiRuntime struct {
+	endpoints []*dockerRuntime
+	mu        sync.Mutex
+	owners    map[string]*dockerRuntime // ID complet du conteneur -> endpoint
+	retryMin  time.Duration
+	retryMax  time.Duration
+}
+
+// newMultiRuntime crée les clients de tous les endpoints
+func newMultiRuntime(ctx context.Context, configs []EndpointConfig) (*multiRuntime, error) {
+	r := &multiRuntime{owners: map[string]*dockerRuntime{}, retryMin: endpointRetryMin, retryMax: endpointRetryMax}
+	for _, config := range configs {
+		cli, err := newEndpointClient(config)
+		if err != nil {
+			r.Close()
+			return nil, fmt.Errorf("endpoint %s: %w", config.Name, err)
+		}
+		endpoint := newDockerRuntime(cli, isPodmanServer(ctx, cli))
+		endpoint.endpoint = config.Name
+		r.endpoints = append(r.endpoints, endpoint)
+		log.Printf("Watching %s endpoint %s (%s)", endpoint.Name(), config.Name, config.Host)
+	}
+	return r, nil
+}
+
+// Name retourne le nom du runtime (tous les endpoints parlent l'API Docker)
+func (r *multiRuntime) Name() string {
+	return RuntimeDocker
+}
+
+// remember associe un conteneur à son endpoint
+func (r *multiRuntime) remember(containerID string, endpoint *dockerRuntime) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.owners[containerID] = endpoint
+}
+
+// forget oublie un conteneur supprimé
+func (r *multiRuntime) forget(containerID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.owners, containerID)
+}
+
+// owner retourne l'endpoint connu d'un conteneur, par ID complet ou préfixe
+func (r *multiRuntime) owner(containerID string) *dockerRuntime {
+	if containerID == "" {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if endpoint, ok := r.owners[containerID]; ok {
+		return endpoint
+	}
+	for id, endpoint := range r.owners {
+		if strings.HasPrefix(id, containerID) {
+			return endpoint
+		}
+	}
+	return nil
+}
+
+// List agrège les conteneurs de tous les endpoints joignables
+func (r *multiRuntime) List(ctx context.Context) ([]container.Summary, error) {
+	var all []container.Summary
+	var errs []error
+	for _, endpoint := range r.endpoints {
+		list, err := endpoint.List(ctx)
+		if err != nil {
+			// Un démon arrêté ne doit pas masquer les agents des autres
+			log.Printf("Warning: failed to list containers on endpoint %s: %v", endpoint.endpoint, err)
+			errs = append(errs, fmt.Errorf("%s: %w", endpoint.endpoint, err))
+			continue
+		}
+		for _, c := range list {
+			r.remember(c.ID, endpoint)
+		}
+		all = append(all, list...)
+	}
+	if len(errs) == len(r.endpoints) && len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return all, nil
+}
+
+// candidates retourne l'endpoint connu du conteneur, sinon tous les endpoints
+func (r *multiRuntime) candidates(containerID string) []*dockerRuntime {
+	if endpoint := r.owner(containerID); endpoint != nil {
+		return []*dockerRuntime{endpoint}
+	}
+	return r.endpoints
+}
+
+// Inspect interroge l'endpoint hébergeant le conteneur
+func (r *multiRuntime) Inspect(ctx context.Context, containerID string) (container.InspectResponse, error) {
+	err := fmt.Errorf("container %s not found on any endpoint", containerID)
+	for _, endpoint := range r.candidates(containerID) {
+		info, inspectErr := endpoint.Inspect(ctx, containerID)
+		if inspectErr == nil {
+			r.remember(info.ID, endpoint)
+			return info, nil
+		}
+		err = inspectErr
+	}
+	return container.InspectResponse{}, err
+}
+
+// Top interroge l'endpoint hébergeant le conteneur
+func (r *multiRuntime) Top(ctx context.Context, containerID string) (container.TopResponse, error) {
+	err := fmt.Errorf("container %s not found on any endpoint", containerID)
+	for _, endpoint := range r.candidates(containerID) {
+		top, topErr := endpoint.Top(ctx, containerID)
+		if topErr == nil {
+			return top, nil
+		}
+		err = topErr
+	}
+	return container.TopResponse{}, err
+}
+
+// Events fusionne les flux de tous les endpoints ; les erreurs sont gérées par endpoint
+func (r *multiRuntime) Events(ctx context.Context) (<-chan events.Message, <-chan error) {
+	merged := make(chan events.Message)
+	for _, endpoint := range r.endpoints {
+		go r.watch(ctx, endpoint, merged)
+	}
+	// Aucune erreur globale : chaque endpoint se reconnecte seul
+	return merged, make(chan error)
+}
+
+// watch relaie les événements d'un endpoint et se reconnecte après une coupure
+func (r *multiRuntime) watch(ctx context.Context, endpoint *dockerRuntime, out chan<- events.Message) {
+	delay := r.retryMin
+	for ctx.Err() == nil {
+		connectedAt := time.Now()
+		err := r.forward(ctx, endpoint, out)
+		if ctx.Err() != nil {
+			return
+		}
+
+		// Une connexion restée stable remet le délai à sa valeur minimale
+		if time.Since(connectedAt) > r.retryMax {
+			delay = r.retryMin
+		}
+		log.Printf("Events from endpoint %s interrupted: %v, reconnecting in %v", endpoint.endpoint, err, delay)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return
+		}
+		delay = min(delay*2, r.retryMax)
+	}
+}
+
+// forward relaie les événements d'un endpoint jusqu'à la première erreur
+func (r *multiRuntime) forward(ctx context.Context, endpoint *dockerRuntime, out chan<- events.Message) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	messages, errs := endpoint.Events(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-errs:
+			if err == nil {
+				err = io.EOF
+			}
+			return err
+		case message := <-messages:
+			if message.Type == events.ContainerEventType {
+				r.remember(message.Actor.ID, endpoint)
+			}
+			select {
+			case out <- message:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			if message.Action == events.ActionDestroy {
+				r.forget(message.Actor.ID)
+			}
+		}
+	}
+}
+
+// Endpoint retourne le nom de l'endpoint hébergeant le conteneur
+func (r *multiRuntime) Endpoint(containerID string) string {
+	if endpoint := r.owner(containerID); endpoint != nil {
+		return endpoint.endpoint
+	}
+	return ""
+}
+
+// Close ferme les clients de tous les endpoints
+func (r *multiRuntime) Close() error {
+	var errs []error
+	for _, endpoint := range r.endpoints {
+		errs = append(errs, endpoint.Close())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,153 @@
+package ecsazrlc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/events"
+)
+
+// TestParseEndpoint vérifie la lecture des endpoints passés en ligne de commande
+func TestParseEndpoint(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected EndpointConfig
+		wantErr  bool
+	}{
+		{value: "unix:///var/run/docker.sock", expected: EndpointConfig{Name: "unix:///var/run/docker.sock", Host: "unix:///var/run/docker.sock"}},
+		{value: "build=ssh://ci@build-01:2222", expected: EndpointConfig{Name: "build", Host: "ssh://ci@build-01:2222"}},
+		{
+			value:    "gpu=tcp://10.0.0.5:2376,tlscacert=/certs/ca.pem,tlscert=/certs/cert.pem,tlskey=/certs/key.pem",
+			expected: EndpointConfig{Name: "gpu", Host: "tcp://10.0.0.5:2376", TLSCACert: "/certs/ca.pem", TLSCert: "/certs/cert.pem", TLSKey: "/certs/key.pem"},
+		},
+		{value: "http://10.0.0.5:2375", wantErr: true},
+		{value: "tcp://10.0.0.5:2376,tlscert=/certs/cert.pem", wantErr: true},
+		{value: "tcp://10.0.0.5:2376,verify=false", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		endpoint, err := ParseEndpoint(tt.value)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseEndpoint(%q) should fail", tt.value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseEndpoint(%q) error: %v", tt.value, err)
+			continue
+		}
+		if endpoint != tt.expected {
+			t.Errorf("ParseEndpoint(%q) = %+v, expected %+v", tt.value, endpoint, tt.expected)
+		}
+	}
+}
+
+// newTestMultiRuntime crée un runtime multi-endpoints sur de faux démons
+func newTestMultiRuntime(t *testing.T, fakes map[string]*fakeDocker) *multiRuntime {
+	t.Helper()
+	r := &multiRuntime{owners: map[string]*dockerRuntime{}, retryMin: 10 * time.Millisecond, retryMax: 50 * time.Millisecond}
+	for _, name := range []string{"a", "b"} {
+		endpoint := newDockerRuntime(fakes[name].client(t), false)
+		endpoint.endpoint = name
+		r.endpoints = append(r.endpoints, endpoint)
+	}
+	return r
+}
+
+// TestMultiRuntime vérifie l'agrégation des agents et l'origine des événements
+func TestMultiRuntime(t *testing.T) {
+	agentA := &fakeContainer{ID: "aaaaaaaaaaaa0001", Name: "agent-a", Image: "azp-agent", Processes: []string{"Agent.Listener", "Agent.Worker"}}
+	agentB := &fakeContainer{ID: "bbbbbbbbbbbb0002", Name: "agent-b", Image: "azp-agent", Processes: []string{"Agent.Listener"}}
+	fakes := map[string]*fakeDocker{"a": newFakeDocker(t, agentA), "b": newFakeDocker(t, agentB)}
+
+	// Le flux de b est coupé à la première connexion puis rétabli
+	var connections atomic.Int32
+	fakes["b"].route("GET /events", func(w http.ResponseWriter, r *http.Request) {
+		if connections.Add(1) == 1 {
+			return
+		}
+		json.NewEncoder(w).Encode(events.Message{
+			Type:   events.ContainerEventType,
+			Action: events.ActionExecStart,
+			Actor:  events.Actor{ID: agentB.ID, Attributes: map[string]string{"name": agentB.Name, "image": agentB.Image}},
+		})
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	})
+	fakes["a"].route("GET /events", func(w http.ResponseWriter, r *http.Request) {
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	monitor := newMonitor(ctx, cancel, newTestMultiRuntime(t, fakes), MonitorConfig{})
+
+	agents, err := monitor.GetRunningAzureAgents()
+	if err != nil {
+		t.Fatalf("GetRunningAzureAgents() error: %v", err)
+	}
+	endpoints := map[string]string{}
+	for _, agent := range agents {
+		endpoints[agent.ContainerName] = agent.Endpoint
+	}
+	if len(agents) != 2 || endpoints["agent-a"] != "a" || endpoints["agent-b"] != "b" {
+		t.Fatalf("Expected one agent per endpoint, got %v", endpoints)
+	}
+
+	// Top est routé vers le démon hébergeant le conteneur
+	for _, agent := range agents {
+		state := monitor.probeAgent(agent)
+		if state.Busy != (agent.ContainerName == "agent-a") {
+			t.Errorf("%s busy = %v (%s)", agent.ContainerName, state.Busy, state.Reason)
+		}
+	}
+
+	if err := monitor.StartMonitoring(); err != nil {
+		t.Fatalf("StartMonitoring() error: %v", err)
+	}
+	deadline := time.After(2 * time.Second)
+	for {
+		select {
+		case event := <-monitor.GetActivityChannel():
+			if event.Action != "exec_start" {
+				continue
+			}
+			if event.ContainerName != "agent-b" || event.Endpoint != "b" {
+				t.Errorf("Unexpected event after reconnection: %+v", event)
+			}
+			if connections.Load() < 2 {
+				t.Error("Events should come from the second connection")
+			}
+			return
+		case <-deadline:
+			t.Fatalf("No event received after reconnection (%d connections)", connections.Load())
+		}
+	}
+}
+
+// TestMultiRuntimeUnreachableEndpoint vérifie qu'un démon injoignable ne masque pas les autres
+func TestMultiRuntimeUnreachableEndpoint(t *testing.T) {
+	agentA := &fakeContainer{ID: "aaaaaaaaaaaa0001", Name: "agent-a", Image: "azp-agent"}
+	fakes := map[string]*fakeDocker{"a": newFakeDocker(t, agentA), "b": newFakeDocker(t)}
+	fakes["b"].server.Close()
+	runtime := newTestMultiRuntime(t, fakes)
+
+	list, err := runtime.List(context.Background())
+	if err != nil || len(list) != 1 {
+		t.Fatalf("Expected the container of the reachable endpoint, got %d (%v)", len(list), err)
+	}
+	if runtime.Endpoint(agentA.ID[:12]) != "a" {
+		t.Errorf("Container should be attributed to endpoint a, got %q", runtime.Endpoint(agentA.ID[:12]))
+	}
+
+	fakes["a"].server.Close()
+	if _, err := runtime.List(context.Background()); err == nil {
+		t.Error("List should fail when no endpoint is reachable")
+	}
+}
@@ -0,0 +1,249 @@
+package ecsazrlc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	ebtypes "github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+)
+
+// EventSource est la source des événements publiés dans EventBridge
+const EventSource = "ecsazrlc"
+
+// Limites et valeurs par défaut de l'envoi des événements
+const (
+	maxEntriesPerPutEvents = 10
+	eventQueueSize         = 1000
+	defaultEventRetries    = 3
+	defaultEventBackoff    = time.Second
+)
+
+// eventDetailTypes associe chaque transition à son detail-type EventBridge
+var eventDetailTypes = map[TransitionType]string{
+	TransitionAgentBusy:           "Agent Busy",
+	TransitionAgentIdle:           "Agent Idle",
+	TransitionInstanceBusy:        "Instance Busy",
+	TransitionInstanceIdle:        "Instance Idle",
+	TransitionInstanceDraining:    "Instance Draining",
+	TransitionProtectionCapped:    "Protection Capped",
+	TransitionInstanceTerminating: "Instance Terminating",
+	TransitionAgentStarted:        "Agent Started",
+	TransitionAgentStopped:        "Agent Stopped",
+	TransitionAgentOOMKilled:      "Agent OOM Killed",
+	TransitionAgentRestarted:      "Agent Restarted",
+	TransitionJobLongRunning:      "Job Long Running",
+	TransitionJobOverdue:          "Job Overdue",
+	TransitionJobStarted:          "Job Started",
+	TransitionJobFinished:         "Job Finished",
+}
+
+// TransitionEventDetail est le champ detail des événements publiés (schéma version 1)
+type TransitionEventDetail struct {
+	Version       string    `json:"version"`
+	Transition    string    `json:"transition"`
+	ClusterName   string    `json:"clusterName"`
+	InstanceID    string    `json:"instanceId,omitempty"`
+	ContainerID   string    `json:"containerId,omitempty"`
+	ContainerName string    `json:"containerName,omitempty"`
+	Image         string    `json:"image,omitempty"`
+	Reason        string    `json:"reason,omitempty"`
+	JobName       string    `json:"jobName,omitempty"`
+	JobResult     string    `json:"jobResult,omitempty"`
+	BusyAgents    int       `json:"busyAgents"`
+	IdleAgents    int       `json:"idleAgents"`
+	Timestamp     time.Time `json:"timestamp"`
+}
+
+// newTransitionEventDetail construit le detail d'un événement à partir d'une transition
+func newTransitionEventDetail(transition StateTransition, clusterName, instanceID string) TransitionEventDetail {
+	return TransitionEventDetail{
+		Version:       "1",
+		Transition:    string(transition.Type),
+		ClusterName:   clusterName,
+		InstanceID:    instanceID,
+		ContainerID:   transition.ContainerID,
+		ContainerName: transition.ContainerName,
+		Image:         transition.ImageName,
+		Reason:        transition.Reason,
+		JobName:       transition.JobName,
+		JobResult:     transition.JobResult,
+		BusyAgents:    transition.BusyAgents,
+		IdleAgents:    transition.IdleAgents,
+		Timestamp:     transition.Timestamp.UTC(),
+	}
+}
+
+// transitionDetailType retourne le detail-type EventBridge d'une transition
+func transitionDetailType(transitionType TransitionType) string {
+	if detailType, ok := eventDetailTypes[transitionType]; ok {
+		return detailType
+	}
+	return string(transitionType)
+}
+
+// EventBridgeSink publie les transitions d'état dans EventBridge via PutEvents
+type EventBridgeSink struct {
+	client        *eventbridge.Client
+	eventBusName  string
+	clusterName   string
+	instanceID    string
+	batchInterval time.Duration
+	maxRetries    int
+	backoff       time.Duration
+	queue         chan StateTransition
+	stopChan      chan struct{}
+	done          chan struct{}
+	ctx           context.Context
+}
+
+// NewEventBridgeSink crée un récepteur EventBridge pour le bus donné ("" pour le bus par défaut)
+func NewEventBridgeSink(eventBusName, clusterName, instanceID string, batchInterval time.Duration) (*EventBridgeSink, error) {
+	ctx := context.Background()
+
+	cfg, err := loadAWSConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return newEventBridgeSinkWithClient(ctx, eventbridge.NewFromConfig(cfg), eventBusName, clusterName, instanceID, batchInterval), nil
+}
+
+// newEventBridgeSinkWithClient crée un récepteur avec un client EventBridge existant
+func newEventBridgeSinkWithClient(ctx context.Context, client *eventbridge.Client, eventBusName, clusterName, instanceID string, batchInterval time.Duration) *EventBridgeSink {
+	return &EventBridgeSink{
+		client:        client,
+		eventBusName:  eventBusName,
+		clusterName:   clusterName,
+		instanceID:    instanceID,
+		batchInterval: batchInterval,
+		maxRetries:    defaultEventRetries,
+		backoff:       defaultEventBackoff,
+		queue:         make(chan StateTransition, eventQueueSize),
+		stopChan:      make(chan struct{}),
+		done:          make(chan struct{}),
+		ctx:           ctx,
+	}
+}
+
+// HandleTransition met la transition en file d'envoi sans bloquer le moniteur
+func (s *EventBridgeSink) HandleTransition(transition StateTransition) {
+	select {
+	case s.queue <- transition:
+	default:
+		log.Printf("Warning: EventBridge queue full, dropping %s event", transition.Type)
+	}
+}
+
+// Start envoie les événements par lots (bloquant jusqu'à Stop)
+func (s *EventBridgeSink) Start() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.batchInterval)
+	defer ticker.Stop()
+
+	var batch []ebtypes.PutEventsRequestEntry
+	for {
+		select {
+		case transition := <-s.queue:
+			batch = append(batch, s.entry(transition))
+			if len(batch) >= maxEntriesPerPutEvents {
+				s.send(batch)
+				batch = nil
+			}
+
+		case <-ticker.C:
+			if len(batch) > 0 {
+				s.send(batch)
+				batch = nil
+			}
+
+		case <-s.stopChan:
+			// Vider la file avant de s'arrêter
+			for drained := false; !drained; {
+				select {
+				case transition := <-s.queue:
+					batch = append(batch, s.entry(transition))
+				default:
+					drained = true
+				}
+			}
+			for start := 0; start < len(batch); start += maxEntriesPerPutEvents {
+				s.send(batch[start:min(start+maxEntriesPerPutEvents, len(batch))])
+			}
+			return
+		}
+	}
+}
+
+// entry convertit une transition en entrée PutEvents
+func (s *EventBridgeSink) entry(transition StateTransition) ebtypes.PutEventsRequestEntry {
+	detail, _ := json.Marshal(newTransitionEventDetail(transition, s.clusterName, s.instanceID))
+
+	entry := ebtypes.PutEventsRequestEntry{
+		Source:     aws.String(EventSource),
+		DetailType: aws.String(transitionDetailType(transition.Type)),
+		Detail:     aws.String(string(detail)),
+		Time:       aws.Time(transition.Timestamp),
+	}
+	if s.eventBusName != "" {
+		entry.EventBusName = aws.String(s.eventBusName)
+	}
+	return entry
+}
+
+// send publie un lot en réessayant les entrées en échec avec un délai exponentiel
+func (s *EventBridgeSink) send(batch []ebtypes.PutEventsRequestEntry) {
+	pending := batch
+	backoff := s.backoff
+
+	for attempt := 0; ; attempt++ {
+		failed, err := s.put(pending)
+		if err == nil && len(failed) == 0 {
+			return
+		}
+		if err == nil {
+			pending = failed
+			err = fmt.Errorf("%d event(s) rejected", len(failed))
+		}
+
+		if attempt >= s.maxRetries {
+			log.Printf("Error publishing %d event(s) to EventBridge after %d attempt(s): %v", len(pending), attempt+1, err)
+			return
+		}
+
+		log.Printf("Retrying %d EventBridge event(s) in %v", len(pending), backoff)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// put envoie un lot et retourne les entrées rejetées
+func (s *EventBridgeSink) put(entries []ebtypes.PutEventsRequestEntry) ([]ebtypes.PutEventsRequestEntry, error) {
+	result, err := s.client.PutEvents(s.ctx, &eventbridge.PutEventsInput{Entries: entries})
+	if err != nil {
+		return nil, fmt.Errorf("failed to put events: %w", err)
+	}
+	if result.FailedEntryCount == 0 {
+		return nil, nil
+	}
+
+	// Les résultats sont dans le même ordre que les entrées
+	var failed []ebtypes.PutEventsRequestEntry
+	for i, entryResult := range result.Entries {
+		if entryResult.ErrorCode != nil && i < len(entries) {
+			failed = append(failed, entries[i])
+		}
+	}
+	return failed, nil
+}
+
+// Stop arrête le récepteur après avoir envoyé les événements en attente
+func (s *EventBridgeSink) Stop() {
+	close(s.stopChan)
+	<-s.done
+}
@@ -0,0 +1,107 @@
+package ecsazrlc
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+)
+
+// newTestEventBridgeSink crée un récepteur pointant vers un faux service JSON 1.1
+func newTestEventBridgeSink(t *testing.T, fake *fakeECS) *EventBridgeSink {
+	t.Helper()
+	client := eventbridge.New(eventbridge.Options{
+		Region:           "us-east-1",
+		BaseEndpoint:     aws.String(fake.server.URL),
+		Credentials:      aws.AnonymousCredentials{},
+		RetryMaxAttempts: 1,
+	})
+	sink := newEventBridgeSinkWithClient(context.Background(), client, "ci-bus", "test-cluster", "i-123", time.Hour)
+	sink.backoff = time.Millisecond
+	return sink
+}
+
+// TestEventBridgeSinkBatches vérifie le schéma des événements et le découpage par 10
+func TestEventBridgeSinkBatches(t *testing.T) {
+	fake := newFakeECS(t)
+	fake.handle("PutEvents", func(body map[string]interface{}) interface{} {
+		return map[string]interface{}{"FailedEntryCount": 0}
+	})
+	sink := newTestEventBridgeSink(t, fake)
+	go sink.Start()
+
+	for i := 0; i < 12; i++ {
+		sink.HandleTransition(StateTransition{
+			Type:          TransitionAgentBusy,
+			ContainerID:   "abc123",
+			ContainerName: "agent-1",
+			BusyAgents:    1,
+			Timestamp:     time.Now(),
+		})
+	}
+	sink.Stop()
+
+	calls := fake.callsTo("PutEvents")
+	if len(calls) != 2 {
+		t.Fatalf("Expected 2 PutEvents calls (10 + 2), got %d", len(calls))
+	}
+
+	entries := calls[0].Body["Entries"].([]interface{})
+	if len(entries) != maxEntriesPerPutEvents {
+		t.Errorf("Expected %d entries in first batch, got %d", maxEntriesPerPutEvents, len(entries))
+	}
+	entry := entries[0].(map[string]interface{})
+	if entry["Source"] != EventSource || entry["DetailType"] != "Agent Busy" || entry["EventBusName"] != "ci-bus" {
+		t.Errorf("Unexpected entry: %v", entry)
+	}
+
+	var detail TransitionEventDetail
+	if err := json.Unmarshal([]byte(entry["Detail"].(string)), &detail); err != nil {
+		t.Fatalf("Invalid detail: %v", err)
+	}
+	if detail.Version != "1" || detail.Transition != "AgentBusy" || detail.ClusterName != "test-cluster" || detail.InstanceID != "i-123" || detail.ContainerName != "agent-1" {
+		t.Errorf("Unexpected detail: %+v", detail)
+	}
+}
+
+// TestEventBridgeSinkRetriesFailedEntries vérifie que seules les entrées rejetées sont renvoyées
+func TestEventBridgeSinkRetriesFailedEntries(t *testing.T) {
+	fake := newFakeECS(t)
+	attempts := 0
+	fake.handle("PutEvents", func(body map[string]interface{}) interface{} {
+		attempts++
+		entries := body["Entries"].([]interface{})
+		if attempts == 1 {
+			return map[string]interface{}{
+				"FailedEntryCount": 1,
+				"Entries": []interface{}{
+					map[string]interface{}{"EventId": "1"},
+					map[string]interface{}{"ErrorCode": "ThrottlingException"},
+				},
+			}
+		}
+		results := make([]interface{}, len(entries))
+		for i := range results {
+			results[i] = map[string]interface{}{"EventId": "ok"}
+		}
+		return map[string]interface{}{"FailedEntryCount": 0, "Entries": results}
+	})
+	sink := newTestEventBridgeSink(t, fake)
+	go sink.Start()
+
+	sink.HandleTransition(StateTransition{Type: TransitionInstanceBusy, Timestamp: time.Now()})
+	sink.HandleTransition(StateTransition{Type: TransitionInstanceIdle, Timestamp: time.Now()})
+	sink.Stop()
+
+	calls := fake.callsTo("PutEvents")
+	if len(calls) != 2 {
+		t.Fatalf("Expected 2 PutEvents calls, got %d", len(calls))
+	}
+	retried := calls[1].Body["Entries"].([]interface{})
+	if len(retried) != 1 || retried[0].(map[string]interface{})["DetailType"] != "Instance Idle" {
+		t.Errorf("Expected only the rejected entry to be retried, got %v", retried)
+	}
+}
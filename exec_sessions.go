@@ -0,0 +1,256 @@
+package ecsazrlc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/containerd/errdefs"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+)
+
+// ExecSession est une session docker exec dans un conteneur agent
+type ExecSession struct {
+	ID        string        `json:"id"`
+	Command   string        `json:"command,omitempty"`
+	StartedAt time.Time     `json:"startedAt,omitempty"` // Inconnu pour une session terminée dont le début n'a pas été vu
+	Duration  time.Duration `json:"-"`                   // Durée écoulée, ou totale une fois la session terminée
+	ExitCode  *int          `json:"exitCode,omitempty"`  // Renseigné à la fin de la session
+}
+
+// MarshalJSON expose la durée en secondes
+func (s ExecSession) MarshalJSON() ([]byte, error) {
+	type session ExecSession
+	return json.Marshal(struct {
+		session
+		DurationSeconds int64 `json:"durationSeconds"`
+	}{session(s), int64(s.Duration.Seconds())})
+}
+
+// inspectExec retourne le détail d'une session exec (ErrCapabilityUnavailable hors API Docker)
+func (m *Monitor) inspectExec(ctx context.Context, containerID, execID string) (container.ExecInspect, error) {
+	cli := m.dockerClientFor(containerID)
+	if cli == nil {
+		return container.ExecInspect{}, fmt.Errorf("%w: %s", ErrCapabilityUnavailable, CapabilityExecInspect)
+	}
+	var inspect container.ExecInspect
+	err := m.dockerCall(containerID, CapabilityExecInspect, func() (err error) {
+		inspect, err = cli.ContainerExecInspect(ctx, execID)
+		return err
+	})
+	return inspect, err
+}
+
+// processCommand lit la ligne de commande d'un processus de l'hôte
+func processCommand(procRoot string, pid int) string {
+	data, err := os.ReadFile(filepath.Join(procRoot, strconv.Itoa(pid), "cmdline"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(strings.ReplaceAll(string(data), "\x00", " "))
+}
+
+// isHealthcheckExec indique si une session exec est le healthcheck du conteneur (exécuté par le démon)
+func isHealthcheckExec(config *container.Config, command string) bool {
+	if config == nil || config.Healthcheck == nil || len(config.Healthcheck.Test) < 2 {
+		return false
+	}
+	test := config.Healthcheck.Test
+	switch test[0] {
+	case "CMD-SHELL":
+		return command == "/bin/sh -c "+test[1] || command == "cmd /S /C "+test[1]
+	case "CMD":
+		return command == strings.Join(test[1:], " ")
+	}
+	return false
+}
+
+// openExec enregistre une session exec ouverte
+func (t *containerTracker) openExec(containerID string, session ExecSession) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if c, ok := t.containers[shortID(containerID)]; ok {
+		c.Execs[session.ID] = session
+	}
+}
+
+// ignoreExec enregistre une session exec du healthcheck, ignorée jusqu'à son exec_die
+func (t *containerTracker) ignoreExec(containerID, execID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if c, ok := t.containers[shortID(containerID)]; ok {
+		c.HealthExecs[execID] = true
+	}
+}
+
+// endIgnoredExec indique si une session exec terminée était ignorée, et l'oublie
+func (t *containerTracker) endIgnoredExec(containerID, execID string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c, ok := t.containers[shortID(containerID)]
+	if !ok || !c.HealthExecs[execID] {
+		return false
+	}
+	delete(c.HealthExecs, execID)
+	return true
+}
+
+// closeExec termine une session exec et retourne son état final
+func (t *containerTracker) closeExec(containerID, execID string, exitCode *int, at time.Time) (ExecSession, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c, ok := t.containers[shortID(containerID)]
+	if !ok {
+		return ExecSession{}, false
+	}
+	session, ok := c.Execs[execID]
+	if !ok {
+		return ExecSession{}, false
+	}
+	delete(c.Execs, execID)
+	session.ExitCode = exitCode
+	if !session.StartedAt.IsZero() && at.After(session.StartedAt) {
+		session.Duration = at.Sub(session.StartedAt)
+	}
+	return session, true
+}
+
+// handleExecEvent suit une session exec de son exec_start à son exec_die. Retourne la session et
+// les métadonnées de job de son environnement, ou healthcheck à vrai pour une session du healthcheck.
+func (m *Monitor) handleExecEvent(event events.Message, action events.Action, command string, config *container.Config) (session *ExecSession, job JobMetadata, healthcheck bool) {
+	execID := event.Actor.Attributes["execID"]
+	if execID == "" {
+		return nil, JobMetadata{}, false
+	}
+	at := time.Unix(event.Time, 0)
+	if event.TimeNano != 0 {
+		at = time.Unix(0, event.TimeNano)
+	}
+
+	inspect := func() container.ExecInspect {
+		inspect, err := m.inspectExec(m.ctx, event.Actor.ID, execID)
+		if err != nil && !errors.Is(err, ErrCapabilityUnavailable) {
+			log.Printf("Warning: failed to inspect exec session %s: %v", shortID(execID), err)
+		}
+		return inspect
+	}
+
+	if action == events.ActionExecDie {
+		if m.containers.endIgnoredExec(event.Actor.ID, execID) {
+			return nil, JobMetadata{}, true
+		}
+		// Code de sortie porté par l'événement depuis Docker 23, à défaut lu par ExecInspect
+		var exitCode *int
+		if code, err := strconv.Atoi(event.Actor.Attributes["exitCode"]); err == nil {
+			exitCode = &code
+		} else if inspected := inspect(); inspected.ExecID != "" && !inspected.Running {
+			exitCode = &inspected.ExitCode
+		}
+		closed, ok := m.containers.closeExec(event.Actor.ID, execID, exitCode, at)
+		if !ok {
+			// Début non observé (session antérieure au moniteur)
+			closed = ExecSession{ID: execID, ExitCode: exitCode}
+		}
+		return &closed, JobMetadata{}, false
+	}
+
+	inspected := inspect()
+	if command == "" {
+		command = processCommand(m.procRoot, inspected.Pid)
+	}
+	if isHealthcheckExec(config, command) {
+		m.containers.ignoreExec(event.Actor.ID, execID)
+		return nil, JobMetadata{}, true
+	}
+	opened := ExecSession{ID: execID, Command: command, StartedAt: at}
+	m.containers.openExec(event.Actor.ID, opened)
+
+	job, err := execJobMetadata(m.procRoot, inspected)
+	if err != nil {
+		log.Printf("Warning: no job metadata for exec %s: %v", shortID(execID), err)
+	}
+	return &opened, job, false
+}
+
+// ExecSessions retourne les sessions exec ouvertes d'un agent, de la plus ancienne à la plus récente
+func (m *Monitor) ExecSessions(containerID string) []ExecSession {
+	c, ok := m.containers.get(containerID)
+	if !ok {
+		return nil
+	}
+	now := time.Now()
+	sessions := make([]ExecSession, 0, len(c.Execs))
+	for _, session := range c.Execs {
+		session.Duration = now.Sub(session.StartedAt)
+		sessions = append(sessions, session)
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].StartedAt.Before(sessions[j].StartedAt) })
+	return sessions
+}
+
+// discoverExecs retrouve les sessions exec déjà ouvertes au démarrage du moniteur
+func (m *Monitor) discoverExecs(ctx context.Context, agent ActivityEvent) {
+	if m.dockerClientFor(agent.ContainerID) == nil {
+		return
+	}
+	info, err := m.runtime.Inspect(ctx, agent.ContainerID)
+	if err != nil {
+		return
+	}
+	for _, execID := range info.ExecIDs {
+		inspect, err := m.inspectExec(ctx, agent.ContainerID, execID)
+		if err != nil || !inspect.Running {
+			continue
+		}
+		command := processCommand(m.procRoot, inspect.Pid)
+		if isHealthcheckExec(info.Config, command) {
+			continue
+		}
+		// Début inconnu : la durée est comptée à partir du démarrage du moniteur
+		m.containers.openExec(agent.ContainerID, ExecSession{ID: execID, Command: command, StartedAt: time.Now()})
+		log.Printf("Exec session %s already running in %s: %s", shortID(execID), agent.ContainerName, command)
+	}
+}
+
+// execProbe considère occupé un agent ayant une session exec ouverte
+type execProbe struct {
+	monitor *Monitor
+}
+
+// Name retourne le nom de la sonde
+func (p *execProbe) Name() string {
+	return "exec"
+}
+
+// Probe vérifie les sessions exec ouvertes ; celles dont la fin a été manquée sont refermées
+func (p *execProbe) Probe(ctx context.Context, agent ActivityEvent) (ProbeResult, error) {
+	for _, session := range p.monitor.ExecSessions(agent.ContainerID) {
+		inspect, err := p.monitor.inspectExec(ctx, agent.ContainerID, session.ID)
+		switch {
+		case err == nil && !inspect.Running:
+			exitCode := inspect.ExitCode
+			p.monitor.containers.closeExec(agent.ContainerID, session.ID, &exitCode, time.Now())
+			continue
+		case errdefs.IsNotFound(err):
+			p.monitor.containers.closeExec(agent.ContainerID, session.ID, nil, time.Now())
+			continue
+		case err != nil && !errors.Is(err, ErrCapabilityUnavailable):
+			log.Printf("Warning: failed to inspect exec session %s: %v", shortID(session.ID), err)
+		}
+		reason := fmt.Sprintf("exec session %s running for %s", shortID(session.ID), session.Duration.Truncate(time.Second))
+		if session.Command != "" {
+			reason += ": " + session.Command
+		}
+		return ProbeResult{Known: true, Busy: true, Reason: reason}, nil
+	}
+	return ProbeResult{}, nil
+}
@@ -0,0 +1,171 @@
+package ecsazrlc
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+)
+
+// fakeExecs sert /exec/{id}/json à partir de l'état des sessions connues
+type fakeExecs struct {
+	mu       sync.Mutex
+	sessions map[string]container.ExecInspect
+}
+
+// set définit l'état d'une session exec
+func (f *fakeExecs) set(execID string, running bool, exitCode int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.sessions == nil {
+		f.sessions = map[string]container.ExecInspect{}
+	}
+	f.sessions[execID] = container.ExecInspect{ExecID: execID, Running: running, ExitCode: exitCode}
+}
+
+func (f *fakeExecs) serve(w http.ResponseWriter, r *http.Request) {
+	execID := strings.TrimSuffix(r.URL.Path[strings.Index(r.URL.Path, "/exec/")+len("/exec/"):], "/json")
+	f.mu.Lock()
+	session, ok := f.sessions[execID]
+	f.mu.Unlock()
+	if !ok {
+		http.Error(w, `{"message":"No such exec instance"}`, http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(session)
+}
+
+// execEvent construit un événement exec_start ou exec_die
+func execEvent(id, action, execID string, extra map[string]string) events.Message {
+	attributes := map[string]string{"name": "agent-1", "image": "azp-agent", "execID": execID}
+	for key, value := range extra {
+		attributes[key] = value
+	}
+	return containerEvent(id, events.Action(action), attributes)
+}
+
+// TestExecSessionLifecycle vérifie le suivi d'une session exec et l'état occupé de l'agent
+func TestExecSessionLifecycle(t *testing.T) {
+	const id = "aaaaaaaaaaaa0001"
+	fake := newFakeDocker(t, &fakeContainer{ID: id, Name: "agent-1", Image: "azp-agent", Processes: []string{"Agent.Listener"}})
+	execs := &fakeExecs{}
+	fake.route("GET /exec/", execs.serve)
+	monitor := fake.monitor(t, MonitorConfig{})
+	agent := ActivityEvent{ContainerID: id[:12]}
+
+	execs.set("exec-1", true, 0)
+	start := containerEvent(id, "exec_start: bash -c ./build.sh", map[string]string{"name": "agent-1", "image": "azp-agent", "execID": "exec-1"})
+	start.Time = time.Now().Add(-time.Minute).Unix()
+	monitor.handleDockerEvent(start)
+	event := nextActivity(t, monitor)
+	if event.Exec == nil || event.Exec.ID != "exec-1" || event.Exec.Command != "bash -c ./build.sh" {
+		t.Fatalf("Unexpected exec_start session: %+v", event.Exec)
+	}
+
+	sessions := monitor.ExecSessions(id)
+	if len(sessions) != 1 || sessions[0].Duration < time.Minute {
+		t.Fatalf("Expected one session open for a minute, got %+v", sessions)
+	}
+	if state := monitor.probeAgent(agent); !state.Busy || !strings.HasPrefix(state.Reason, "exec: exec session exec-1 running for 1m") || !strings.HasSuffix(state.Reason, ": bash -c ./build.sh") {
+		t.Errorf("An agent with an open exec session should be busy, got %+v", state)
+	}
+
+	monitor.handleDockerEvent(execEvent(id, "exec_die", "exec-1", map[string]string{"exitCode": "2"}))
+	event = nextActivity(t, monitor)
+	if event.Exec == nil || event.Exec.ExitCode == nil || *event.Exec.ExitCode != 2 || event.Exec.Duration < time.Minute {
+		t.Errorf("Unexpected exec_die session: %+v", event.Exec)
+	}
+	if sessions := monitor.ExecSessions(id); len(sessions) != 0 {
+		t.Errorf("Exec session should be closed, got %+v", sessions)
+	}
+	if state := monitor.probeAgent(agent); state.Busy {
+		t.Errorf("Agent should be idle once the exec session ended, got %+v", state)
+	}
+
+	data, err := json.Marshal(event.Exec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"durationSeconds":60`) || !strings.Contains(string(data), `"exitCode":2`) {
+		t.Errorf("Unexpected JSON encoding: %s", data)
+	}
+}
+
+// TestExecProbeClosesMissedSessions vérifie qu'une session dont la fin a été manquée est refermée
+func TestExecProbeClosesMissedSessions(t *testing.T) {
+	const id = "aaaaaaaaaaaa0001"
+	fake := newFakeDocker(t, &fakeContainer{ID: id, Name: "agent-1", Image: "azp-agent", Processes: []string{"Agent.Listener"}})
+	execs := &fakeExecs{}
+	fake.route("GET /exec/", execs.serve)
+	monitor := fake.monitor(t, MonitorConfig{})
+	agent := ActivityEvent{ContainerID: id[:12]}
+
+	execs.set("exec-1", true, 0)
+	execs.set("exec-2", true, 0)
+	monitor.handleDockerEvent(execEvent(id, "exec_start: make", "exec-1", nil))
+	monitor.handleDockerEvent(execEvent(id, "exec_start: make test", "exec-2", nil))
+	nextActivity(t, monitor)
+	nextActivity(t, monitor)
+
+	// exec-1 terminée, exec-2 supprimée par le démon
+	execs.set("exec-1", false, 0)
+	execs.mu.Lock()
+	delete(execs.sessions, "exec-2")
+	execs.mu.Unlock()
+
+	if state := monitor.probeAgent(agent); state.Busy {
+		t.Errorf("Finished exec sessions should not keep the agent busy, got %+v", state)
+	}
+	if sessions := monitor.ExecSessions(id); len(sessions) != 0 {
+		t.Errorf("Finished exec sessions should be closed, got %+v", sessions)
+	}
+}
+
+// TestHealthcheckExecIgnored vérifie que le healthcheck du conteneur n'est pas une activité
+func TestHealthcheckExecIgnored(t *testing.T) {
+	const id = "aaaaaaaaaaaa0001"
+	fake := newFakeDocker(t, &fakeContainer{ID: id, Name: "agent-1", Image: "azp-agent", Health: []string{"CMD-SHELL", "curl -f http://localhost/health"}})
+	execs := &fakeExecs{}
+	fake.route("GET /exec/", execs.serve)
+	monitor := fake.monitor(t, MonitorConfig{})
+
+	execs.set("exec-health", true, 0)
+	monitor.handleDockerEvent(execEvent(id, "exec_start: /bin/sh -c curl -f http://localhost/health", "exec-health", nil))
+	if sessions := monitor.ExecSessions(id); len(sessions) != 0 {
+		t.Errorf("Healthcheck exec should not be tracked, got %+v", sessions)
+	}
+	execs.set("exec-health", false, 0)
+	monitor.handleDockerEvent(execEvent(id, "exec_die", "exec-health", map[string]string{"exitCode": "0"}))
+
+	select {
+	case event := <-monitor.GetActivityChannel():
+		t.Errorf("Healthcheck exec should not emit activity, got %+v", event)
+	default:
+	}
+}
+
+// TestDiscoverExecs vérifie la reprise des sessions ouvertes avant le démarrage du moniteur
+func TestDiscoverExecs(t *testing.T) {
+	const id = "aaaaaaaaaaaa0001"
+	fake := newFakeDocker(t, &fakeContainer{ID: id, Name: "agent-1", Image: "azp-agent", ExecIDs: []string{"exec-running", "exec-done"}})
+	execs := &fakeExecs{}
+	fake.route("GET /exec/", execs.serve)
+	monitor := fake.monitor(t, MonitorConfig{})
+
+	execs.set("exec-running", true, 0)
+	execs.set("exec-done", false, 0)
+	agent := ActivityEvent{ContainerID: id[:12], ContainerName: "agent-1"}
+	monitor.containers.observe(id, "agent-1", "azp-agent", "", false)
+	monitor.discoverExecs(monitor.ctx, agent)
+
+	sessions := monitor.ExecSessions(id)
+	if len(sessions) != 1 || sessions[0].ID != "exec-running" {
+		t.Errorf("Expected the running exec session to be discovered, got %+v", sessions)
+	}
+}
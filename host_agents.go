@@ -0,0 +1,218 @@
+package ecsazrlc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Préfixe de l'identifiant des agents hors conteneur (suivi du PID de Agent.Listener)
+const hostAgentPrefix = "host-"
+
+// Endpoint des agents hors conteneur
+const hostAgentEndpoint = "host"
+
+// Motifs de /proc/<pid>/cgroup désignant un processus conteneurisé
+var containerCgroupMarkers = []string{"/docker", "docker-", "containerd", "libpod", "kubepods", "crio", "/lxc"}
+
+// hostProcess est un processus lu dans /proc
+type hostProcess struct {
+	PID     int
+	PPID    int
+	Cmdline []string
+}
+
+// agentBinary retourne le chemin de Agent.Listener ou Agent.Worker dans la ligne de commande
+// (exécutable natif ou dll lancée par dotnet), vide s'il ne s'agit pas d'un processus d'agent
+func (p hostProcess) agentBinary(process string) string {
+	for _, arg := range p.Cmdline {
+		base := filepath.Base(arg)
+		if base == process || base == process+".dll" {
+			return arg
+		}
+	}
+	return ""
+}
+
+// hostAgentScanner détecte les agents Azure lancés directement sur l'hôte (systemd...)
+type hostAgentScanner struct {
+	procRoot string // /proc de l'hôte, ou son point de montage dans le conteneur
+}
+
+// processes lit la table des processus
+func (s *hostAgentScanner) processes() (map[int]hostProcess, error) {
+	entries, err := os.ReadDir(s.procRoot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", s.procRoot, err)
+	}
+
+	processes := make(map[int]hostProcess)
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		// Le processus a pu se terminer pendant la lecture
+		stat, err := os.ReadFile(filepath.Join(s.procRoot, entry.Name(), "stat"))
+		if err != nil {
+			continue
+		}
+		cmdline, err := os.ReadFile(filepath.Join(s.procRoot, entry.Name(), "cmdline"))
+		if err != nil {
+			continue
+		}
+		processes[pid] = hostProcess{
+			PID:     pid,
+			PPID:    parseStatPPID(string(stat)),
+			Cmdline: strings.Split(strings.TrimRight(string(cmdline), "\x00"), "\x00"),
+		}
+	}
+	return processes, nil
+}
+
+// parseStatPPID extrait le PID parent de /proc/<pid>/stat ("pid (comm) state ppid ...")
+func parseStatPPID(stat string) int {
+	// Le nom du processus peut contenir des espaces et des parenthèses
+	end := strings.LastIndexByte(stat, ')')
+	if end < 0 {
+		return 0
+	}
+	fields := strings.Fields(stat[end+1:])
+	if len(fields) < 2 {
+		return 0
+	}
+	ppid, _ := strconv.Atoi(fields[1])
+	return ppid
+}
+
+// containerized indique si le processus tourne dans un conteneur (déjà suivi via Docker)
+func (s *hostAgentScanner) containerized(pid int) bool {
+	data, err := os.ReadFile(filepath.Join(s.procRoot, strconv.Itoa(pid), "cgroup"))
+	if err != nil {
+		return false
+	}
+	for _, marker := range containerCgroupMarkers {
+		if strings.Contains(string(data), marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// agents retourne un événement par processus Agent.Listener de l'hôte
+func (s *hostAgentScanner) agents() ([]ActivityEvent, error) {
+	processes, err := s.processes()
+	if err != nil {
+		return nil, err
+	}
+
+	var agents []ActivityEvent
+	for _, process := range processes {
+		binary := process.agentBinary(agentListenerProcess)
+		if binary == "" || s.containerized(process.PID) {
+			continue
+		}
+		root := s.agentRoot(process.PID, binary)
+		agents = append(agents, ActivityEvent{
+			ContainerID:   hostAgentPrefix + strconv.Itoa(process.PID),
+			ContainerName: s.agentName(process.PID, root),
+			ImageName:     root,
+			Action:        "running",
+			Timestamp:     time.Now(),
+			IsAzureAgent:  true,
+			HostPID:       process.PID,
+			Endpoint:      hostAgentEndpoint,
+		})
+	}
+	return agents, nil
+}
+
+// agentRoot retourne le répertoire d'installation de l'agent (parent de bin/)
+func (s *hostAgentScanner) agentRoot(pid int, binary string) string {
+	if !filepath.IsAbs(binary) {
+		cwd, err := os.Readlink(filepath.Join(s.procRoot, strconv.Itoa(pid), "cwd"))
+		if err != nil {
+			return ""
+		}
+		binary = filepath.Join(cwd, binary)
+	}
+	return filepath.Dir(filepath.Dir(binary))
+}
+
+// agentName lit le nom de l'agent dans son fichier .agent, à défaut celui du répertoire d'installation
+func (s *hostAgentScanner) agentName(pid int, root string) string {
+	if root != "" {
+		// Lecture via /proc/<pid>/root pour accéder au système de fichiers de l'hôte
+		data, err := os.ReadFile(filepath.Join(s.procRoot, strconv.Itoa(pid), "root", root, ".agent"))
+		if err == nil {
+			var settings struct {
+				AgentName string `json:"agentName"`
+			}
+			if json.Unmarshal(data, &settings) == nil && settings.AgentName != "" {
+				return settings.AgentName
+			}
+		}
+		if base := filepath.Base(root); base != "/" && base != "." {
+			return base
+		}
+	}
+	return "agent-" + strconv.Itoa(pid)
+}
+
+// hostProcessProbe applique aux agents de l'hôte la règle de processProbe :
+// un Agent.Worker descendant de Agent.Listener signifie un job en cours
+type hostProcessProbe struct {
+	scanner *hostAgentScanner
+}
+
+// Name retourne le nom de la sonde
+func (p *hostProcessProbe) Name() string {
+	return "host-process"
+}
+
+// Probe recherche un Agent.Worker parmi les descendants du Agent.Listener de l'agent
+func (p *hostProcessProbe) Probe(ctx context.Context, agent ActivityEvent) (ProbeResult, error) {
+	if agent.HostPID == 0 {
+		// Agent conteneurisé : laisser les autres sondes se prononcer
+		return ProbeResult{}, nil
+	}
+
+	processes, err := p.scanner.processes()
+	if err != nil {
+		return ProbeResult{}, err
+	}
+	if _, ok := processes[agent.HostPID]; !ok {
+		return ProbeResult{Known: true, Busy: false, Reason: agentListenerProcess + " process exited"}, nil
+	}
+
+	for _, process := range processes {
+		if process.agentBinary(agentWorkerProcess) == "" {
+			continue
+		}
+		if descendsFrom(processes, process, agent.HostPID) {
+			return ProbeResult{Known: true, Busy: true, Reason: fmt.Sprintf("%s process running (pid %d)", agentWorkerProcess, process.PID)}, nil
+		}
+	}
+	return ProbeResult{Known: true, Busy: false, Reason: "only " + agentListenerProcess + " running"}, nil
+}
+
+// descendsFrom indique si un processus a pour ancêtre le PID donné
+func descendsFrom(processes map[int]hostProcess, process hostProcess, ancestor int) bool {
+	// Borne de sécurité contre une table incohérente lue pendant des changements
+	for i := 0; i < 64 && process.PPID > 0; i++ {
+		if process.PPID == ancestor {
+			return true
+		}
+		parent, ok := processes[process.PPID]
+		if !ok {
+			return false
+		}
+		process = parent
+	}
+	return false
+}
@@ -0,0 +1,137 @@
+package ecsazrlc
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// fakeProc construit une table des processus dans un répertoire temporaire
+type fakeProc struct {
+	t    *testing.T
+	root string
+}
+
+// process ajoute un processus avec son parent, sa ligne de commande et son cgroup
+func (p *fakeProc) process(pid, ppid int, cgroup string, cmdline ...string) {
+	p.t.Helper()
+	dir := filepath.Join(p.root, strconv.Itoa(pid))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		p.t.Fatal(err)
+	}
+	name := filepath.Base(cmdline[0])
+	os.WriteFile(filepath.Join(dir, "stat"), []byte(strconv.Itoa(pid)+" ("+name+") S "+strconv.Itoa(ppid)+" 1 1 0 -1"), 0o644)
+	os.WriteFile(filepath.Join(dir, "cmdline"), []byte(strings.Join(cmdline, "\x00")+"\x00"), 0o644)
+	os.WriteFile(filepath.Join(dir, "cgroup"), []byte("0::"+cgroup+"\n"), 0o644)
+}
+
+// remove supprime un processus terminé
+func (p *fakeProc) remove(pid int) {
+	os.RemoveAll(filepath.Join(p.root, strconv.Itoa(pid)))
+}
+
+// agentSettings écrit le fichier .agent visible depuis /proc/<pid>/root
+func (p *fakeProc) agentSettings(pid int, agentRoot, content string) {
+	p.t.Helper()
+	dir := filepath.Join(p.root, strconv.Itoa(pid), "root", agentRoot)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		p.t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(dir, ".agent"), []byte(content), 0o644)
+}
+
+// TestParseStatPPID vérifie la lecture du PID parent, y compris avec un nom de processus inhabituel
+func TestParseStatPPID(t *testing.T) {
+	if ppid := parseStatPPID("4242 (Agent.Worker) S 4100 4100 4100 0 -1"); ppid != 4100 {
+		t.Errorf("Expected ppid 4100, got %d", ppid)
+	}
+	if ppid := parseStatPPID("12 (weird) name) R 7 12 12"); ppid != 7 {
+		t.Errorf("Expected ppid 7, got %d", ppid)
+	}
+	if ppid := parseStatPPID("garbage"); ppid != 0 {
+		t.Errorf("Expected ppid 0 for an invalid stat, got %d", ppid)
+	}
+}
+
+// TestHostAgents vérifie la détection des agents de l'hôte et leur fusion avec les agents conteneurisés
+func TestHostAgents(t *testing.T) {
+	proc := &fakeProc{t: t, root: t.TempDir()}
+	proc.process(1, 0, "/init.scope", "/sbin/init")
+	proc.process(100, 1, "/system.slice/vsts.agent.org.Linux.build-01.service", "/opt/agent/bin/Agent.Listener", "run", "--startuptype", "service")
+	proc.agentSettings(100, "/opt/agent", `{"agentName":"build-01","poolName":"Linux"}`)
+	proc.process(200, 1, "/system.slice/vsts.agent.org.Linux.build-02.service", "/usr/bin/dotnet", "/srv/agent2/bin/Agent.Listener.dll", "run")
+	proc.process(300, 1, "/system.slice/docker-0123456789ab.scope", "/azp/bin/Agent.Listener", "run")
+	proc.process(400, 1, "/user.slice", "/bin/bash")
+
+	fake := newFakeDocker(t, idleAgent("aaaaaaaaaaaa0001", "docker-agent"))
+	monitor := fake.monitor(t, MonitorConfig{HostProcRoot: proc.root})
+
+	agents, err := monitor.GetRunningAzureAgents()
+	if err != nil {
+		t.Fatalf("GetRunningAzureAgents() error: %v", err)
+	}
+	if len(agents) != 3 {
+		t.Fatalf("Expected the container agent and 2 host agents (containerized processes ignored), got %+v", agents)
+	}
+
+	states, err := monitor.GetAgentStates()
+	if err != nil {
+		t.Fatalf("GetAgentStates() error: %v", err)
+	}
+	host := stateOf(t, states, "build-01")
+	if host.ContainerID != "host-100" || host.HostPID != 100 || host.ImageName != "/opt/agent" {
+		t.Errorf("Unexpected host agent: %+v", host.ActivityEvent)
+	}
+	if host.Busy || !strings.HasPrefix(host.Reason, "host-process:") {
+		t.Errorf("build-01 should be idle, got %+v", host)
+	}
+	// Sans fichier .agent lisible, le nom vient du répertoire d'installation
+	if agent2 := stateOf(t, states, "agent2"); agent2.Busy {
+		t.Errorf("agent2 should be idle, got %+v", agent2)
+	}
+	if docker := stateOf(t, states, "docker-agent"); docker.Busy || !strings.HasPrefix(docker.Reason, "process:") {
+		t.Errorf("Container agent should still use the container probes, got %+v", docker)
+	}
+
+	// Agent.Worker lancé par le Listener (via un processus intermédiaire)
+	proc.process(110, 100, "/system.slice/vsts.agent.org.Linux.build-01.service", "/bin/sh", "-c", "worker")
+	proc.process(111, 110, "/system.slice/vsts.agent.org.Linux.build-01.service", "/opt/agent/bin/Agent.Worker", "spawnclient", "3", "4")
+	states, _ = monitor.GetAgentStates()
+	if busy := stateOf(t, states, "build-01"); !busy.Busy {
+		t.Errorf("build-01 should be busy while Agent.Worker runs, got %+v", busy)
+	}
+	if idle := stateOf(t, states, "agent2"); idle.Busy {
+		t.Errorf("Another agent's worker should not make agent2 busy, got %+v", idle)
+	}
+	if active, _ := monitor.HasActiveAgents(); !active {
+		t.Error("A busy host agent should keep the instance active")
+	}
+
+	proc.remove(111)
+	states, _ = monitor.GetAgentStates()
+	if idle := stateOf(t, states, "build-01"); idle.Busy {
+		t.Errorf("build-01 should be idle again after the job, got %+v", idle)
+	}
+}
+
+// TestHostAgentsExcluded vérifie que les règles d'exclusion s'appliquent aux agents de l'hôte
+func TestHostAgentsExcluded(t *testing.T) {
+	proc := &fakeProc{t: t, root: t.TempDir()}
+	proc.process(100, 1, "/system.slice/agent.service", "/opt/agent/bin/Agent.Listener", "run")
+	proc.process(200, 1, "/system.slice/agent2.service", "/opt/legacy/bin/Agent.Listener", "run")
+
+	monitor := newFakeDocker(t).monitor(t, MonitorConfig{
+		HostProcRoot:      proc.root,
+		ExcludeContainers: []string{"host-100"},
+		ExcludeImages:     []string{"/opt/legacy"},
+	})
+	agents, err := monitor.GetRunningAzureAgents()
+	if err != nil {
+		t.Fatalf("GetRunningAzureAgents() error: %v", err)
+	}
+	if len(agents) != 0 {
+		t.Errorf("Excluded host agents should be ignored, got %+v", agents)
+	}
+}
@@ -0,0 +1,189 @@
+package ecsazrlc
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// Préfixe des labels appliqués par Azure Pipelines aux conteneurs de job et de service
+const pipelinesLabelPrefix = "com.azure.dev.pipelines."
+
+// DefaultJobOwnerLabel est le label désignant l'agent propriétaire d'un conteneur de job
+// (nom ou ID du conteneur agent, ou nom de l'agent dans le pool)
+const DefaultJobOwnerLabel = "ecsazrlc.agent"
+
+// Réseaux Docker prédéfinis, partagés par des conteneurs sans lien entre eux
+var defaultNetworks = map[string]bool{"bridge": true, "host": true, "none": true}
+
+// isJobContainer indique si les labels désignent un conteneur de job (et non un agent)
+func isJobContainer(labels map[string]string, ownerLabel string) bool {
+	if _, ok := labels[ownerLabel]; ok && ownerLabel != "" {
+		return true
+	}
+	for key := range labels {
+		if strings.HasPrefix(key, pipelinesLabelPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// jobContainerProbe considère un agent occupé tant qu'un conteneur de job qu'il a lancé
+// (job `container:`, conteneur de service) est en cours d'exécution
+type jobContainerProbe struct {
+	monitor     *Monitor
+	ownerLabel  string
+	useNetworks bool // Attribuer les conteneurs partageant un réseau utilisateur avec l'agent
+}
+
+// newJobContainerProbe crée la sonde des conteneurs de job
+func newJobContainerProbe(m *Monitor, ownerLabel string, useNetworks bool) *jobContainerProbe {
+	if ownerLabel == "" {
+		ownerLabel = DefaultJobOwnerLabel
+	}
+	return &jobContainerProbe{monitor: m, ownerLabel: ownerLabel, useNetworks: useNetworks}
+}
+
+// Name retourne le nom de la sonde
+func (p *jobContainerProbe) Name() string {
+	return "job-containers"
+}
+
+// Probe recherche un conteneur de job vivant appartenant à l'agent, parmi les conteneurs du relevé en cours
+func (p *jobContainerProbe) Probe(ctx context.Context, agent ActivityEvent) (ProbeResult, error) {
+	pass, err := p.monitor.samplingPassOf(ctx)
+	if err != nil {
+		return ProbeResult{}, err
+	}
+
+	var owner *agentOwner
+	for _, c := range pass.containers {
+		if strings.HasPrefix(c.ID, agent.ContainerID) || !p.candidate(c) {
+			continue
+		}
+		name := strings.TrimPrefix(firstName(c.Names), "/")
+		if p.monitor.isExcluded(c.ID, name, c.Image) {
+			continue
+		}
+
+		// L'agent n'est inspecté qu'en présence d'un conteneur candidat
+		if owner == nil {
+			if owner, err = p.monitor.agentOwner(ctx, agent); err != nil {
+				return ProbeResult{}, err
+			}
+		}
+
+		owned, how, err := p.owns(ctx, pass, owner, c)
+		if err != nil {
+			log.Printf("Warning: failed to attribute container %s: %v", name, err)
+			continue
+		}
+		if owned {
+			return ProbeResult{Known: true, Busy: true, Reason: fmt.Sprintf("job container %s running (%s)", name, how)}, nil
+		}
+	}
+
+	// Aucun conteneur de job : laisser les autres sondes se prononcer
+	return ProbeResult{}, nil
+}
+
+// candidate indique si un conteneur peut être un conteneur de job
+func (p *jobContainerProbe) candidate(c container.Summary) bool {
+	if isJobContainer(c.Labels, p.ownerLabel) {
+		return true
+	}
+	if p.useNetworks && c.NetworkSettings != nil {
+		for network := range c.NetworkSettings.Networks {
+			if !defaultNetworks[network] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// owns indique si le conteneur appartient à l'agent, et par quel moyen
+func (p *jobContainerProbe) owns(ctx context.Context, pass *samplingPass, owner *agentOwner, c container.Summary) (bool, string, error) {
+	// 1. Label propriétaire explicite
+	if value, ok := c.Labels[p.ownerLabel]; ok {
+		return owner.matches(value), "label " + p.ownerLabel, nil
+	}
+
+	// 2. Réseau utilisateur partagé avec l'agent
+	if p.useNetworks && c.NetworkSettings != nil {
+		for network := range c.NetworkSettings.Networks {
+			if owner.networks[network] {
+				// Un autre agent sur le même réseau n'est pas un conteneur de job
+				info, err := p.monitor.runtime.Inspect(ctx, c.ID)
+				err = p.monitor.api.check(p.monitor.runtime.Endpoint(c.ID), CapabilityInspect, err)
+				if err != nil {
+					return false, "", err
+				}
+				if !p.monitor.IsAzureAgentContainer(info) {
+					return true, "network " + network, nil
+				}
+			}
+		}
+	}
+
+	// 3. Conteneur Azure Pipelines sans propriétaire connu : attribué à l'agent s'il est seul sur l'hôte
+	if isJobContainer(c.Labels, "") {
+		if len(pass.agents) == 1 && pass.agents[0].ContainerID == owner.containerID {
+			return true, "only agent on host", nil
+		}
+	}
+	return false, "", nil
+}
+
+// agentOwner regroupe ce qui permet de reconnaître un agent comme propriétaire d'un conteneur
+type agentOwner struct {
+	containerID   string
+	containerName string
+	agentName     string
+	networks      map[string]bool // Réseaux utilisateur de l'agent
+}
+
+// matches indique si la valeur d'un label désigne cet agent
+func (o *agentOwner) matches(value string) bool {
+	if value == "" {
+		return false
+	}
+	return value == o.containerName || value == o.agentName ||
+		(o.containerID != "" && strings.HasPrefix(value, o.containerID))
+}
+
+// agentOwner inspecte un agent pour connaître son nom et ses réseaux
+func (m *Monitor) agentOwner(ctx context.Context, agent ActivityEvent) (*agentOwner, error) {
+	info, err := m.runtime.Inspect(ctx, agent.ContainerID)
+	err = m.api.check(m.runtime.Endpoint(agent.ContainerID), CapabilityInspect, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect agent container: %w", err)
+	}
+
+	owner := &agentOwner{
+		containerID:   agent.ContainerID,
+		containerName: agent.ContainerName,
+		agentName:     agentIdentity(info, "").AgentName,
+		networks:      map[string]bool{},
+	}
+	if info.NetworkSettings != nil {
+		for network := range info.NetworkSettings.Networks {
+			if !defaultNetworks[network] {
+				owner.networks[network] = true
+			}
+		}
+	}
+	return owner, nil
+}
+
+// firstName retourne le premier nom d'un conteneur (vide s'il n'en a pas)
+func firstName(names []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	return names[0]
+}
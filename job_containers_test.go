@@ -0,0 +1,142 @@
+package ecsazrlc
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// idleAgent construit un agent dont seul Agent.Listener tourne
+func idleAgent(id, name string, env ...string) *fakeContainer {
+	return &fakeContainer{ID: id, Name: name, Image: "azp-agent:latest", Env: env, Processes: []string{"Agent.Listener"}}
+}
+
+// stateOf retourne l'état d'un agent dans un relevé
+func stateOf(t *testing.T, states []AgentState, name string) AgentState {
+	t.Helper()
+	for _, state := range states {
+		if state.ContainerName == name {
+			return state
+		}
+	}
+	t.Fatalf("Agent %s not found in %+v", name, states)
+	return AgentState{}
+}
+
+// TestJobContainerOwnerLabel vérifie l'attribution par label propriétaire
+func TestJobContainerOwnerLabel(t *testing.T) {
+	fake := newFakeDocker(t,
+		idleAgent("aaaaaaaaaaaa0001", "agent-1", "AZP_AGENT_NAME=linux-01"),
+		idleAgent("bbbbbbbbbbbb0002", "agent-2"),
+		&fakeContainer{ID: "cccccccccccc0003", Name: "job-node", Image: "node:20", Labels: map[string]string{DefaultJobOwnerLabel: "linux-01"}},
+	)
+	states, err := fake.monitor(t, MonitorConfig{}).GetAgentStates()
+	if err != nil {
+		t.Fatalf("GetAgentStates() error: %v", err)
+	}
+
+	if len(states) != 2 {
+		t.Fatalf("Job containers must not be detected as agents, got %d agents", len(states))
+	}
+	busy := stateOf(t, states, "agent-1")
+	if !busy.Busy || !strings.HasPrefix(busy.Reason, "job-containers:") {
+		t.Errorf("agent-1 should be busy because of its job container, got %+v", busy)
+	}
+	if idle := stateOf(t, states, "agent-2"); idle.Busy {
+		t.Errorf("agent-2 should stay idle, got %+v", idle)
+	}
+}
+
+// TestJobContainerPipelinesLabel vérifie l'attribution d'un conteneur Azure Pipelines à l'agent unique
+func TestJobContainerPipelinesLabel(t *testing.T) {
+	fake := newFakeDocker(t,
+		idleAgent("aaaaaaaaaaaa0001", "agent-1"),
+		&fakeContainer{ID: "cccccccccccc0003", Name: "job-container", Image: "ubuntu:22.04", Labels: map[string]string{"com.azure.dev.pipelines.agent.handler.node.path": "/__a/externals/node/bin/node"}},
+	)
+	states, err := fake.monitor(t, MonitorConfig{}).GetAgentStates()
+	if err != nil {
+		t.Fatalf("GetAgentStates() error: %v", err)
+	}
+	if len(states) != 1 || !states[0].Busy {
+		t.Errorf("The only agent should own the pipeline container, got %+v", states)
+	}
+
+	// Avec deux agents, le propriétaire est inconnu
+	fake.containers = append(fake.containers, idleAgent("bbbbbbbbbbbb0002", "agent-2"))
+	states, _ = fake.monitor(t, MonitorConfig{}).GetAgentStates()
+	for _, state := range states {
+		if state.Busy {
+			t.Errorf("Unattributed pipeline container should not make %s busy", state.ContainerName)
+		}
+	}
+}
+
+// TestJobContainerNetwork vérifie l'attribution par réseau partagé (optionnelle)
+func TestJobContainerNetwork(t *testing.T) {
+	agent := idleAgent("aaaaaaaaaaaa0001", "agent-1")
+	agent.Networks = []string{"bridge", "vsts_network_1"}
+	other := idleAgent("bbbbbbbbbbbb0002", "agent-2")
+	other.Networks = []string{"bridge", "vsts_network_1"}
+	fake := newFakeDocker(t, agent, other,
+		&fakeContainer{ID: "cccccccccccc0003", Name: "postgres", Image: "postgres:16", Networks: []string{"vsts_network_1"}},
+		&fakeContainer{ID: "dddddddddddd0004", Name: "unrelated", Image: "nginx", Networks: []string{"bridge"}},
+	)
+
+	states, _ := fake.monitor(t, MonitorConfig{}).GetAgentStates()
+	for _, state := range states {
+		if state.Busy {
+			t.Errorf("Network attribution is disabled by default, %s should be idle", state.ContainerName)
+		}
+	}
+
+	states, _ = fake.monitor(t, MonitorConfig{JobContainerNetwork: true}).GetAgentStates()
+	for _, state := range states {
+		if !state.Busy || !strings.Contains(state.Reason, "postgres") {
+			t.Errorf("%s should be busy because of the service container, got %+v", state.ContainerName, state)
+		}
+	}
+}
+
+// TestJobContainerSingleList vérifie que les conteneurs ne sont listés qu'une fois par relevé
+func TestJobContainerSingleList(t *testing.T) {
+	pipelines := map[string]string{"com.azure.dev.pipelines.agent.handler.node.path": "/__a/externals/node/bin/node"}
+	fake := newFakeDocker(t,
+		idleAgent("aaaaaaaaaaaa0001", "agent-1"),
+		idleAgent("bbbbbbbbbbbb0002", "agent-2"),
+		idleAgent("cccccccccccc0003", "agent-3"),
+		&fakeContainer{ID: "dddddddddddd0004", Name: "job-1", Image: "ubuntu:22.04", Labels: pipelines},
+		&fakeContainer{ID: "eeeeeeeeeeee0005", Name: "job-2", Image: "ubuntu:22.04", Labels: pipelines},
+	)
+	monitor := fake.monitor(t, MonitorConfig{})
+	before := fake.listCalls()
+
+	states, err := monitor.GetAgentStates()
+	if err != nil {
+		t.Fatalf("GetAgentStates() error: %v", err)
+	}
+	if len(states) != 3 {
+		t.Fatalf("Expected 3 agents, got %+v", states)
+	}
+	if calls := fake.listCalls() - before; calls != 1 {
+		t.Errorf("Expected 1 container list per sampling pass, got %d", calls)
+	}
+}
+
+// TestIsJobContainer vérifie la reconnaissance des conteneurs de job
+func TestIsJobContainer(t *testing.T) {
+	monitor := &Monitor{jobOwnerLabel: DefaultJobOwnerLabel}
+	job := container.InspectResponse{Config: &container.Config{
+		Image:  "mcr.microsoft.com/azure-pipelines/agent-job",
+		Labels: map[string]string{"com.azure.dev.pipelines.agent": "1"},
+	}}
+	if monitor.IsAzureAgentContainer(job) {
+		t.Error("Pipeline job containers must not be detected as agents")
+	}
+	if !isJobContainer(map[string]string{DefaultJobOwnerLabel: "agent-1"}, DefaultJobOwnerLabel) {
+		t.Error("Owner label should mark a job container")
+	}
+	if isJobContainer(map[string]string{"app": "web"}, DefaultJobOwnerLabel) {
+		t.Error("Unrelated labels should not mark a job container")
+	}
+}
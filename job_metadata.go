@@ -0,0 +1,146 @@
+package ecsazrlc
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// Actions des événements d'activité produits par le suivi des logs
+const (
+	ActionJobStarted  = "job_started"
+	ActionJobFinished = "job_finished"
+)
+
+// DefaultProcRoot est le /proc lu pour les processus des conteneurs lorsque HostProcRoot est vide
+const DefaultProcRoot = "/proc"
+
+// procRootPath retourne le /proc à lire pour les processus des conteneurs
+func procRootPath(hostProcRoot string) string {
+	if hostProcRoot == "" {
+		return DefaultProcRoot
+	}
+	return hostProcRoot
+}
+
+// JobMetadata décrit le contexte du pipeline associé à une activité
+type JobMetadata struct {
+	BuildID        string `json:"buildId,omitempty"`
+	DefinitionName string `json:"definitionName,omitempty"`
+	JobName        string `json:"jobName,omitempty"`
+	Repository     string `json:"repository,omitempty"`
+	RequestedFor   string `json:"requestedFor,omitempty"`
+	AgentPool      string `json:"agentPool,omitempty"`
+}
+
+// jobMetadataEnv associe les variables d'environnement du pipeline aux champs des métadonnées
+var jobMetadataEnv = map[string]func(*JobMetadata) *string{
+	"BUILD_BUILDID":         func(j *JobMetadata) *string { return &j.BuildID },
+	"BUILD_DEFINITIONNAME":  func(j *JobMetadata) *string { return &j.DefinitionName },
+	"SYSTEM_JOBDISPLAYNAME": func(j *JobMetadata) *string { return &j.JobName },
+	"AGENT_JOBNAME":         func(j *JobMetadata) *string { return &j.JobName },
+	"BUILD_REPOSITORY_NAME": func(j *JobMetadata) *string { return &j.Repository },
+	"BUILD_REQUESTEDFOR":    func(j *JobMetadata) *string { return &j.RequestedFor },
+	"AZP_POOL":              func(j *JobMetadata) *string { return &j.AgentPool },
+}
+
+// jobMetadataLabels associe les labels de conteneur aux champs des métadonnées
+var jobMetadataLabels = map[string]func(*JobMetadata) *string{
+	"ecsazrlc.build-id":      func(j *JobMetadata) *string { return &j.BuildID },
+	"ecsazrlc.definition":    func(j *JobMetadata) *string { return &j.DefinitionName },
+	"ecsazrlc.job":           func(j *JobMetadata) *string { return &j.JobName },
+	"ecsazrlc.repository":    func(j *JobMetadata) *string { return &j.Repository },
+	"ecsazrlc.requested-for": func(j *JobMetadata) *string { return &j.RequestedFor },
+	"ecsazrlc.pool":          func(j *JobMetadata) *string { return &j.AgentPool },
+}
+
+// jobMetadataGroups associe les groupes nommés des motifs de log aux champs des métadonnées
+var jobMetadataGroups = map[string]func(*JobMetadata) *string{
+	"job":          func(j *JobMetadata) *string { return &j.JobName },
+	"build":        func(j *JobMetadata) *string { return &j.BuildID },
+	"definition":   func(j *JobMetadata) *string { return &j.DefinitionName },
+	"repository":   func(j *JobMetadata) *string { return &j.Repository },
+	"requestedfor": func(j *JobMetadata) *string { return &j.RequestedFor },
+}
+
+// IsZero indique si aucune métadonnée n'est connue
+func (j JobMetadata) IsZero() bool {
+	return j == JobMetadata{}
+}
+
+// Merge complète les métadonnées avec les champs non vides de other (other l'emporte)
+func (j JobMetadata) Merge(other JobMetadata) JobMetadata {
+	for _, field := range []struct{ dst, src *string }{
+		{&j.BuildID, &other.BuildID},
+		{&j.DefinitionName, &other.DefinitionName},
+		{&j.JobName, &other.JobName},
+		{&j.Repository, &other.Repository},
+		{&j.RequestedFor, &other.RequestedFor},
+		{&j.AgentPool, &other.AgentPool},
+	} {
+		if *field.src != "" {
+			*field.dst = *field.src
+		}
+	}
+	return j
+}
+
+// jobMetadataFromEnv extrait les métadonnées des variables d'environnement et des labels
+func jobMetadataFromEnv(env []string, labels map[string]string) JobMetadata {
+	var job JobMetadata
+	for _, entry := range env {
+		name, value, _ := strings.Cut(entry, "=")
+		if field, ok := jobMetadataEnv[name]; ok && value != "" {
+			*field(&job) = value
+		}
+	}
+	for name, value := range labels {
+		if field, ok := jobMetadataLabels[name]; ok && value != "" {
+			*field(&job) = value
+		}
+	}
+	return job
+}
+
+// readProcessEnv lit les variables d'environnement d'un processus de l'hôte
+func readProcessEnv(procRoot string, pid int) ([]string, error) {
+	data, err := os.ReadFile(filepath.Join(procRoot, strconv.Itoa(pid), "environ"))
+	if err != nil {
+		return nil, err
+	}
+
+	var env []string
+	for _, entry := range bytes.Split(data, []byte{0}) {
+		if len(entry) > 0 {
+			env = append(env, string(entry))
+		}
+	}
+	return env, nil
+}
+
+// execJobMetadata lit les métadonnées depuis l'environnement d'une session exec.
+// Nécessite l'accès au /proc de l'hôte (pid: host) ; retourne des métadonnées vides sinon.
+func execJobMetadata(procRoot string, inspect container.ExecInspect) (JobMetadata, error) {
+	if inspect.Pid == 0 {
+		return JobMetadata{}, nil
+	}
+
+	env, err := readProcessEnv(procRoot, inspect.Pid)
+	if err != nil {
+		return JobMetadata{}, fmt.Errorf("failed to read exec environment: %w", err)
+	}
+	return jobMetadataFromEnv(env, nil), nil
+}
+
+// jobPointer retourne nil pour des métadonnées vides
+func jobPointer(job JobMetadata) *JobMetadata {
+	if job.IsZero() {
+		return nil
+	}
+	return &job
+}
@@ -0,0 +1,80 @@
+package ecsazrlc
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+)
+
+// TestJobMetadataFromEnv vérifie l'extraction depuis l'environnement et les labels
+func TestJobMetadataFromEnv(t *testing.T) {
+	job := jobMetadataFromEnv(
+		[]string{"BUILD_BUILDID=42", "BUILD_DEFINITIONNAME=ci", "AGENT_JOBNAME=Build", "AZP_POOL=Linux", "PATH=/usr/bin"},
+		map[string]string{"ecsazrlc.repository": "org/repo", "ecsazrlc.pool": "Docker"},
+	)
+
+	expected := JobMetadata{BuildID: "42", DefinitionName: "ci", JobName: "Build", Repository: "org/repo", AgentPool: "Docker"}
+	if job != expected {
+		t.Errorf("jobMetadataFromEnv() = %+v, want %+v", job, expected)
+	}
+
+	if !jobMetadataFromEnv([]string{"PATH=/usr/bin"}, nil).IsZero() {
+		t.Error("Unrelated variables should not produce metadata")
+	}
+	if jobPointer(JobMetadata{}) != nil {
+		t.Error("Empty metadata should be nil")
+	}
+}
+
+// TestJobMetadataMerge vérifie que les champs non vides l'emportent
+func TestJobMetadataMerge(t *testing.T) {
+	base := JobMetadata{BuildID: "1", AgentPool: "Linux"}
+	merged := base.Merge(JobMetadata{BuildID: "2", JobName: "Test"})
+
+	expected := JobMetadata{BuildID: "2", JobName: "Test", AgentPool: "Linux"}
+	if merged != expected {
+		t.Errorf("Merge() = %+v, want %+v", merged, expected)
+	}
+}
+
+// TestExecJobMetadata vérifie l'enrichissement d'un exec_start avec l'environnement de la session
+func TestExecJobMetadata(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "4242"), 0o755)
+	os.WriteFile(filepath.Join(root, "4242", "environ"), []byte("BUILD_BUILDID=77\x00BUILD_REQUESTEDFOR=Jane Doe\x00"), 0o644)
+
+	fake := newFakeDocker(t, &fakeContainer{ID: "aaaaaaaaaaaa0001", Name: "agent-1", Image: "azp-agent", Env: []string{"AZP_POOL=Linux"}})
+	fake.route("GET /exec/", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(container.ExecInspect{ExecID: "exec-1", ContainerID: "aaaaaaaaaaaa0001", Running: true, Pid: 4242})
+	})
+	monitor := fake.monitor(t, MonitorConfig{HostProcRoot: root})
+
+	monitor.handleDockerEvent(events.Message{
+		Type:   events.ContainerEventType,
+		Action: "exec_start: bash -c ./build.sh",
+		Actor: events.Actor{
+			ID:         "aaaaaaaaaaaa0001",
+			Attributes: map[string]string{"name": "agent-1", "image": "azp-agent", "execID": "exec-1"},
+		},
+		Time: time.Now().Unix(),
+	})
+
+	select {
+	case event := <-monitor.GetActivityChannel():
+		if event.Action != "exec_start" {
+			t.Errorf("Expected exec_start action, got %q", event.Action)
+		}
+		expected := JobMetadata{BuildID: "77", RequestedFor: "Jane Doe", AgentPool: "Linux"}
+		if event.Job == nil || *event.Job != expected {
+			t.Errorf("Unexpected job metadata: %+v", event.Job)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected an activity event")
+	}
+}
@@ -0,0 +1,142 @@
+package ecsazrlc
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Durée maximale d'un bail, pour qu'un bail oublié ne bloque pas l'instance indéfiniment
+const DefaultMaxLeaseTTL = 12 * time.Hour
+
+// Lease est un bail d'activité : tant qu'il est actif, l'instance est considérée occupée
+type Lease struct {
+	ID         string        `json:"id"`
+	Reason     string        `json:"reason"`
+	Holder     string        `json:"holder,omitempty"`
+	TTL        time.Duration `json:"-"`
+	AcquiredAt time.Time     `json:"acquiredAt"`
+	ExpiresAt  time.Time     `json:"expiresAt"`
+}
+
+// ErrLeaseNotFound est retournée pour un bail inconnu ou expiré
+var ErrLeaseNotFound = fmt.Errorf("lease not found")
+
+// LeaseStore conserve les baux d'activité en mémoire
+type LeaseStore struct {
+	mu     sync.Mutex
+	leases map[string]*Lease
+	maxTTL time.Duration
+	now    func() time.Time
+}
+
+// NewLeaseStore crée un magasin de baux vide
+func NewLeaseStore(maxTTL time.Duration) *LeaseStore {
+	if maxTTL <= 0 {
+		maxTTL = DefaultMaxLeaseTTL
+	}
+	return &LeaseStore{leases: map[string]*Lease{}, maxTTL: maxTTL, now: time.Now}
+}
+
+// Acquire crée un bail pour la durée donnée (plafonnée à la durée maximale)
+func (s *LeaseStore) Acquire(ttl time.Duration, reason, holder string) (Lease, error) {
+	ttl, err := s.checkTTL(ttl)
+	if err != nil {
+		return Lease{}, err
+	}
+	if reason == "" {
+		return Lease{}, fmt.Errorf("lease reason is required")
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return Lease{}, fmt.Errorf("failed to generate lease ID: %w", err)
+	}
+
+	now := s.now()
+	lease := &Lease{
+		ID:         hex.EncodeToString(id),
+		Reason:     reason,
+		Holder:     holder,
+		TTL:        ttl,
+		AcquiredAt: now,
+		ExpiresAt:  now.Add(ttl),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire(now)
+	s.leases[lease.ID] = lease
+	return *lease, nil
+}
+
+// Renew prolonge un bail actif ; sans durée, la durée initiale est reprise
+func (s *LeaseStore) Renew(id string, ttl time.Duration) (Lease, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.expire(now)
+	lease, ok := s.leases[id]
+	if !ok {
+		return Lease{}, ErrLeaseNotFound
+	}
+
+	if ttl == 0 {
+		ttl = lease.TTL
+	}
+	ttl, err := s.checkTTL(ttl)
+	if err != nil {
+		return Lease{}, err
+	}
+	lease.TTL = ttl
+	lease.ExpiresAt = now.Add(ttl)
+	return *lease, nil
+}
+
+// Release libère un bail
+func (s *LeaseStore) Release(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.expire(s.now())
+	if _, ok := s.leases[id]; !ok {
+		return ErrLeaseNotFound
+	}
+	delete(s.leases, id)
+	return nil
+}
+
+// Active retourne les baux non expirés, du plus ancien au plus récent
+func (s *LeaseStore) Active() []Lease {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.expire(s.now())
+	leases := make([]Lease, 0, len(s.leases))
+	for _, lease := range s.leases {
+		leases = append(leases, *lease)
+	}
+	sort.Slice(leases, func(i, j int) bool { return leases[i].AcquiredAt.Before(leases[j].AcquiredAt) })
+	return leases
+}
+
+// checkTTL valide et plafonne une durée de bail
+func (s *LeaseStore) checkTTL(ttl time.Duration) (time.Duration, error) {
+	if ttl <= 0 {
+		return 0, fmt.Errorf("lease TTL must be positive")
+	}
+	return min(ttl, s.maxTTL), nil
+}
+
+// expire supprime les baux échus (appelé avec le verrou)
+func (s *LeaseStore) expire(now time.Time) {
+	for id, lease := range s.leases {
+		if !now.Before(lease.ExpiresAt) {
+			delete(s.leases, id)
+		}
+	}
+}
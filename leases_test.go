@@ -0,0 +1,72 @@
+package ecsazrlc
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestLeaseStore vérifie le cycle de vie d'un bail
+func TestLeaseStore(t *testing.T) {
+	now := time.Unix(1000, 0)
+	store := NewLeaseStore(time.Hour)
+	store.now = func() time.Time { return now }
+
+	lease, err := store.Acquire(10*time.Minute, "waiting for approval", "release-pipeline")
+	if err != nil {
+		t.Fatalf("Acquire() error: %v", err)
+	}
+	if lease.ID == "" || !lease.ExpiresAt.Equal(now.Add(10*time.Minute)) {
+		t.Errorf("Unexpected lease: %+v", lease)
+	}
+
+	// Renouvellement sans durée : reprise de la durée initiale
+	now = now.Add(5 * time.Minute)
+	renewed, err := store.Renew(lease.ID, 0)
+	if err != nil {
+		t.Fatalf("Renew() error: %v", err)
+	}
+	if !renewed.ExpiresAt.Equal(now.Add(10 * time.Minute)) {
+		t.Errorf("Renewed lease should expire 10m from now, got %v", renewed.ExpiresAt)
+	}
+
+	if active := store.Active(); len(active) != 1 {
+		t.Fatalf("Expected 1 active lease, got %d", len(active))
+	}
+
+	// Expiration
+	now = now.Add(10 * time.Minute)
+	if len(store.Active()) != 0 {
+		t.Error("Expired lease should not be active")
+	}
+	if _, err := store.Renew(lease.ID, time.Minute); !errors.Is(err, ErrLeaseNotFound) {
+		t.Errorf("Renewing an expired lease should fail with ErrLeaseNotFound, got %v", err)
+	}
+}
+
+// TestLeaseStoreValidation vérifie la validation et le plafonnement des baux
+func TestLeaseStoreValidation(t *testing.T) {
+	store := NewLeaseStore(time.Hour)
+
+	if _, err := store.Acquire(0, "reason", ""); err == nil {
+		t.Error("Expected an error for a zero TTL")
+	}
+	if _, err := store.Acquire(time.Minute, "", ""); err == nil {
+		t.Error("Expected an error for a missing reason")
+	}
+
+	lease, err := store.Acquire(48*time.Hour, "long test run", "")
+	if err != nil {
+		t.Fatalf("Acquire() error: %v", err)
+	}
+	if lease.TTL != time.Hour {
+		t.Errorf("TTL should be capped to 1h, got %v", lease.TTL)
+	}
+
+	if err := store.Release(lease.ID); err != nil {
+		t.Errorf("Release() error: %v", err)
+	}
+	if err := store.Release(lease.ID); !errors.Is(err, ErrLeaseNotFound) {
+		t.Errorf("Releasing twice should fail with ErrLeaseNotFound, got %v", err)
+	}
+}
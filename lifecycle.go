@@ -0,0 +1,159 @@
+package ecsazrlc
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/docker/docker/api/types/events"
+)
+
+// Actions du cycle de vie des conteneurs traitées par le moniteur
+var lifecycleActions = map[events.Action]bool{
+	events.ActionCreate:       true,
+	events.ActionStart:        true,
+	events.ActionRestart:      true,
+	events.ActionStop:         true,
+	events.ActionKill:         true,
+	events.ActionDie:          true,
+	events.ActionOOM:          true,
+	events.ActionPause:        true,
+	events.ActionUnPause:      true,
+	events.ActionRename:       true,
+	events.ActionDestroy:      true,
+	events.ActionHealthStatus: true,
+	events.ActionExecStart:    true,
+	events.ActionExecDie:      true,
+}
+
+// trackedContainer est l'état d'un conteneur agent reconstitué à partir des événements
+type trackedContainer struct {
+	Name     string
+	Image    string
+	Endpoint string
+	Paused   bool
+	Health   string                 // Dernier état de santé (healthy, unhealthy...)
+	Execs    map[string]ExecSession // Sessions exec ouvertes par ID
+	// Sessions exec du healthcheck en cours, ignorées jusqu'à leur exec_die
+	HealthExecs map[string]bool
+}
+
+// containerTracker suit les conteneurs agents par ID court
+type containerTracker struct {
+	mu         sync.Mutex
+	containers map[string]*trackedContainer
+}
+
+// newContainerTracker crée un suivi vide
+func newContainerTracker() *containerTracker {
+	return &containerTracker{containers: map[string]*trackedContainer{}}
+}
+
+// track enregistre ou met à jour un conteneur agent et retourne son état
+func (t *containerTracker) track(containerID, name, image, endpoint string) *trackedContainer {
+	id := shortID(containerID)
+	c, ok := t.containers[id]
+	if !ok {
+		c = &trackedContainer{Execs: map[string]ExecSession{}, HealthExecs: map[string]bool{}}
+		t.containers[id] = c
+	}
+	if name != "" {
+		c.Name = name
+	}
+	if image != "" {
+		c.Image = image
+	}
+	if endpoint != "" {
+		c.Endpoint = endpoint
+	}
+	return c
+}
+
+// observe met à jour un conteneur listé par le runtime (état initial, relevés périodiques)
+func (t *containerTracker) observe(containerID, name, image, endpoint string, paused bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.track(containerID, name, image, endpoint).Paused = paused
+}
+
+// get retourne une copie de l'état d'un conteneur suivi
+func (t *containerTracker) get(containerID string) (trackedContainer, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c, ok := t.containers[shortID(containerID)]
+	if !ok {
+		return trackedContainer{}, false
+	}
+	copied := *c
+	copied.Execs = make(map[string]ExecSession, len(c.Execs))
+	for id, session := range c.Execs {
+		copied.Execs[id] = session
+	}
+	copied.HealthExecs = make(map[string]bool, len(c.HealthExecs))
+	for id := range c.HealthExecs {
+		copied.HealthExecs[id] = true
+	}
+	return copied, true
+}
+
+// name retourne le nom à jour d'un conteneur suivi, à défaut celui donné
+func (t *containerTracker) name(containerID, fallback string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if c, ok := t.containers[shortID(containerID)]; ok && c.Name != "" {
+		return c.Name
+	}
+	return fallback
+}
+
+// apply met à jour l'état d'un conteneur agent selon un événement (action et complément séparés)
+func (t *containerTracker) apply(event events.Message, action events.Action, detail, endpoint string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if action == events.ActionDestroy {
+		delete(t.containers, shortID(event.Actor.ID))
+		return
+	}
+
+	attributes := event.Actor.Attributes
+	c := t.track(event.Actor.ID, attributes["name"], attributes["image"], endpoint)
+	switch action {
+	case events.ActionStart, events.ActionRestart, events.ActionUnPause:
+		c.Paused = false
+	case events.ActionPause:
+		c.Paused = true
+	case events.ActionDie:
+		// Les sessions exec ne survivent pas à l'arrêt du processus principal
+		c.Paused = false
+		c.Execs = map[string]ExecSession{}
+		c.HealthExecs = map[string]bool{}
+	case events.ActionHealthStatus:
+		c.Health = detail
+	}
+}
+
+// splitAction sépare l'action de son complément ("exec_start: bash -c ...", "health_status: healthy")
+func splitAction(action events.Action) (events.Action, string) {
+	base, detail, _ := strings.Cut(string(action), ":")
+	return events.Action(base), strings.TrimSpace(detail)
+}
+
+// lifecycleProbe se prononce d'après l'état suivi du conteneur : un agent en pause n'exécute rien
+type lifecycleProbe struct {
+	containers *containerTracker
+}
+
+// Name retourne le nom de la sonde
+func (p *lifecycleProbe) Name() string {
+	return "lifecycle"
+}
+
+// Probe déclare inactif un agent dont le conteneur est en pause
+func (p *lifecycleProbe) Probe(ctx context.Context, agent ActivityEvent) (ProbeResult, error) {
+	c, ok := p.containers.get(agent.ContainerID)
+	if ok && c.Paused {
+		return ProbeResult{Known: true, Busy: false, Reason: "container paused"}, nil
+	}
+	return ProbeResult{}, nil
+}
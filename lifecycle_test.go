@@ -0,0 +1,150 @@
+package ecsazrlc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/events"
+)
+
+// containerEvent construit un événement Docker d'un conteneur
+func containerEvent(id string, action events.Action, attributes map[string]string) events.Message {
+	return events.Message{
+		Type:   events.ContainerEventType,
+		Action: action,
+		Actor:  events.Actor{ID: id, Attributes: attributes},
+		Time:   time.Now().Unix(),
+	}
+}
+
+// nextActivity retourne le prochain événement d'activité du moniteur
+func nextActivity(t *testing.T, monitor *Monitor) ActivityEvent {
+	t.Helper()
+	select {
+	case event := <-monitor.GetActivityChannel():
+		return event
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected an activity event")
+		return ActivityEvent{}
+	}
+}
+
+// TestLifecycleEvents vérifie le traitement de l'ensemble du cycle de vie d'un agent
+func TestLifecycleEvents(t *testing.T) {
+	const id = "aaaaaaaaaaaa0001"
+	agent := &fakeContainer{ID: id, Name: "agent-1", Image: "azp-agent", Processes: []string{"Agent.Listener", "Agent.Worker"}}
+	fake := newFakeDocker(t, agent)
+	monitor := fake.monitor(t, MonitorConfig{})
+	sink := &recordingSink{}
+	monitor.AddTransitionSink(sink)
+	attributes := map[string]string{"name": "agent-1", "image": "azp-agent"}
+
+	// Pause : l'agent n'est plus occupé malgré son Agent.Worker
+	monitor.handleDockerEvent(containerEvent(id, events.ActionPause, attributes))
+	if event := nextActivity(t, monitor); event.Action != "pause" {
+		t.Errorf("Expected pause, got %q", event.Action)
+	}
+	if state := monitor.probeAgent(ActivityEvent{ContainerID: id[:12]}); state.Busy || state.Reason != "lifecycle: container paused" {
+		t.Errorf("A paused agent should be idle, got %+v", state)
+	}
+	monitor.handleDockerEvent(containerEvent(id, events.ActionUnPause, attributes))
+	nextActivity(t, monitor)
+	if state := monitor.probeAgent(ActivityEvent{ContainerID: id[:12]}); !state.Busy {
+		t.Errorf("An unpaused agent should be probed again, got %+v", state)
+	}
+
+	// Sessions exec suivies du début à la fin
+	monitor.handleDockerEvent(containerEvent(id, "exec_start: bash -c ./build.sh", map[string]string{"name": "agent-1", "image": "azp-agent", "execID": "exec-1"}))
+	if event := nextActivity(t, monitor); event.Action != "exec_start" || event.Detail != "exec-1" {
+		t.Errorf("Unexpected exec_start event: %+v", event)
+	}
+	if tracked, _ := monitor.containers.get(id); len(tracked.Execs) != 1 {
+		t.Errorf("Expected one open exec session, got %v", tracked.Execs)
+	}
+	monitor.handleDockerEvent(containerEvent(id, events.ActionExecDie, map[string]string{"name": "agent-1", "image": "azp-agent", "execID": "exec-1", "exitCode": "0"}))
+	nextActivity(t, monitor)
+	if tracked, _ := monitor.containers.get(id); len(tracked.Execs) != 0 {
+		t.Errorf("Exec session should be closed, got %v", tracked.Execs)
+	}
+
+	// État de santé
+	monitor.handleDockerEvent(containerEvent(id, events.ActionHealthStatusUnhealthy, attributes))
+	if event := nextActivity(t, monitor); event.Action != "health_status" || event.Detail != "unhealthy" {
+		t.Errorf("Unexpected health event: %+v", event)
+	}
+
+	// Renommage
+	agent.Name = "agent-renamed"
+	monitor.handleDockerEvent(containerEvent(id, events.ActionRename, map[string]string{"name": "agent-renamed", "image": "azp-agent", "oldName": "/agent-1"}))
+	if event := nextActivity(t, monitor); event.ContainerName != "agent-renamed" || event.Detail != "agent-1" {
+		t.Errorf("Unexpected rename event: %+v", event)
+	}
+	if name := monitor.containers.name(id, ""); name != "agent-renamed" {
+		t.Errorf("Tracked name should be updated, got %q", name)
+	}
+
+	// OOM et redémarrage produisent des transitions distinctes
+	monitor.handleDockerEvent(containerEvent(id, events.ActionOOM, map[string]string{"name": "agent-renamed", "image": "azp-agent"}))
+	monitor.handleDockerEvent(containerEvent(id, events.ActionDie, map[string]string{"name": "agent-renamed", "image": "azp-agent", "exitCode": "137"}))
+	monitor.handleDockerEvent(containerEvent(id, events.ActionStart, map[string]string{"name": "agent-renamed", "image": "azp-agent"}))
+	monitor.handleDockerEvent(containerEvent(id, events.ActionRestart, map[string]string{"name": "agent-renamed", "image": "azp-agent"}))
+	for _, expected := range []string{"oom", "die", "start", "restart"} {
+		if event := nextActivity(t, monitor); event.Action != expected {
+			t.Errorf("Expected %s, got %q", expected, event.Action)
+		}
+	}
+
+	// Suppression : le conteneur n'existe plus mais l'agent suivi est signalé
+	fake.mu.Lock()
+	fake.containers = nil
+	fake.mu.Unlock()
+	monitor.handleDockerEvent(containerEvent(id, events.ActionDestroy, map[string]string{"name": "agent-renamed", "image": "azp-agent"}))
+	if event := nextActivity(t, monitor); event.Action != "destroy" || event.ContainerName != "agent-renamed" {
+		t.Errorf("Unexpected destroy event: %+v", event)
+	}
+	if _, ok := monitor.containers.get(id); ok {
+		t.Error("Destroyed container should no longer be tracked")
+	}
+
+	expected := []TransitionType{TransitionAgentOOMKilled, TransitionAgentStopped, TransitionAgentStarted, TransitionAgentRestarted}
+	types := sink.types()
+	if len(types) != len(expected) {
+		t.Fatalf("Expected transitions %v, got %v", expected, types)
+	}
+	for i := range expected {
+		if types[i] != expected[i] {
+			t.Errorf("Expected transitions %v, got %v", expected, types)
+		}
+	}
+	if reason := sink.transitions[1].Reason; reason != "container exited with code 137" {
+		t.Errorf("Unexpected stop reason: %q", reason)
+	}
+}
+
+// TestLifecycleIgnoresOtherContainers vérifie qu'un conteneur inconnu supprimé est ignoré
+func TestLifecycleIgnoresOtherContainers(t *testing.T) {
+	fake := newFakeDocker(t, &fakeContainer{ID: "dddddddddddd0004", Name: "nginx", Image: "nginx:latest"})
+	monitor := fake.monitor(t, MonitorConfig{})
+
+	monitor.handleDockerEvent(containerEvent("dddddddddddd0004", events.ActionPause, map[string]string{"name": "nginx", "image": "nginx:latest"}))
+	monitor.handleDockerEvent(containerEvent("eeeeeeeeeeee0005", events.ActionDestroy, map[string]string{"name": "gone"}))
+	select {
+	case event := <-monitor.GetActivityChannel():
+		t.Errorf("Unexpected event: %+v", event)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// TestPausedAgentFromList vérifie qu'un agent déjà en pause au démarrage est inactif
+func TestPausedAgentFromList(t *testing.T) {
+	fake := newFakeDocker(t, &fakeContainer{ID: "aaaaaaaaaaaa0001", Name: "agent-1", Image: "azp-agent", Processes: []string{"Agent.Worker"}, Paused: true})
+	monitor := fake.monitor(t, MonitorConfig{})
+
+	states, err := monitor.GetAgentStates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(states) != 1 || states[0].Busy {
+		t.Errorf("A paused agent should be idle, got %+v", states)
+	}
+}
@@ -0,0 +1,325 @@
+package ecsazrlc
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// Motifs par défaut des lignes de log de l'agent Azure DevOps
+const (
+	DefaultJobStartedPattern  = `Running job: (?P<job>.+)$`
+	DefaultJobFinishedPattern = `Job (?P<job>.+) completed with result: (?P<result>\w+)`
+)
+
+// Nombre de lignes relues lorsqu'un agent déjà démarré est suivi
+const initialLogTail = "500"
+
+// LogPatterns contient les expressions reconnaissant le début et la fin d'un job.
+// Les groupes nommés "job" et "result" fournissent le nom du job et son résultat.
+type LogPatterns struct {
+	JobStarted  *regexp.Regexp
+	JobFinished *regexp.Regexp
+}
+
+// NewLogPatterns compile les motifs de début et de fin de job (motifs par défaut si vides)
+func NewLogPatterns(started, finished string) (*LogPatterns, error) {
+	if started == "" {
+		started = DefaultJobStartedPattern
+	}
+	if finished == "" {
+		finished = DefaultJobFinishedPattern
+	}
+
+	startedRe, err := regexp.Compile(started)
+	if err != nil {
+		return nil, fmt.Errorf("invalid job started pattern: %w", err)
+	}
+	finishedRe, err := regexp.Compile(finished)
+	if err != nil {
+		return nil, fmt.Errorf("invalid job finished pattern: %w", err)
+	}
+	return &LogPatterns{JobStarted: startedRe, JobFinished: finishedRe}, nil
+}
+
+// namedGroup retourne la valeur d'un groupe nommé d'une correspondance
+func namedGroup(re *regexp.Regexp, match []string, name string) string {
+	if index := re.SubexpIndex(name); index > 0 && index < len(match) {
+		return strings.TrimSpace(match[index])
+	}
+	return ""
+}
+
+// jobState est l'état du job d'un agent tel que déduit de ses logs
+type jobState struct {
+	Running bool
+	Job     JobMetadata // Métadonnées du job en cours
+	Since   time.Time
+	Base    JobMetadata // Métadonnées issues de l'environnement et des labels du conteneur
+}
+
+// logWatcher suit les logs des conteneurs agents pour détecter le début et la fin des jobs.
+// C'est à la fois une sonde d'occupation et un récepteur des transitions AgentStarted/AgentStopped.
+type logWatcher struct {
+	monitor  *Monitor
+	patterns *LogPatterns
+	mu       sync.Mutex
+	followed map[string]context.CancelFunc // Conteneurs dont les logs sont suivis
+	jobs     map[string]*jobState
+}
+
+// newLogWatcher crée un suivi des logs pour le moniteur
+func newLogWatcher(m *Monitor, patterns *LogPatterns) *logWatcher {
+	return &logWatcher{
+		monitor:  m,
+		patterns: patterns,
+		followed: map[string]context.CancelFunc{},
+		jobs:     map[string]*jobState{},
+	}
+}
+
+// Name retourne le nom de la sonde
+func (w *logWatcher) Name() string {
+	return "logs"
+}
+
+// Probe retourne l'état du job déduit des logs de l'agent
+func (w *logWatcher) Probe(ctx context.Context, agent ActivityEvent) (ProbeResult, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	job, ok := w.jobs[agent.ContainerID]
+	if !ok {
+		return ProbeResult{}, nil
+	}
+	if job.Running {
+		return ProbeResult{Known: true, Busy: true, Reason: fmt.Sprintf("job %s running since %s", job.Job.JobName, job.Since.Format(time.RFC3339))}, nil
+	}
+	return ProbeResult{Known: true, Busy: false, Reason: "no job running"}, nil
+}
+
+// HandleTransition commence ou arrête le suivi lorsqu'un agent démarre ou s'arrête
+func (w *logWatcher) HandleTransition(transition StateTransition) {
+	switch transition.Type {
+	case TransitionAgentStarted:
+		w.follow(transition.ContainerID, transition.ContainerName, transition.ImageName, false)
+	case TransitionAgentStopped:
+		w.forget(transition.ContainerID)
+	}
+}
+
+// followRunning suit les logs des agents déjà en cours d'exécution
+func (w *logWatcher) followRunning(agents []ActivityEvent) {
+	for _, agent := range agents {
+		// Les agents de l'hôte écrivent dans leurs fichiers _diag, pas dans des logs Docker
+		if agent.HostPID != 0 {
+			continue
+		}
+		w.follow(agent.ContainerID, agent.ContainerName, agent.ImageName, true)
+	}
+}
+
+// follow démarre la lecture des logs d'un conteneur s'il n'est pas déjà suivi
+func (w *logWatcher) follow(containerID, containerName, imageName string, existing bool) {
+	w.mu.Lock()
+	if _, ok := w.followed[containerID]; ok {
+		w.mu.Unlock()
+		return
+	}
+	ctx, cancel := context.WithCancel(w.monitor.ctx)
+	w.followed[containerID] = cancel
+	if _, ok := w.jobs[containerID]; !ok {
+		w.jobs[containerID] = &jobState{}
+	}
+	w.mu.Unlock()
+
+	go func() {
+		defer func() {
+			w.mu.Lock()
+			delete(w.followed, containerID)
+			w.mu.Unlock()
+			cancel()
+		}()
+
+		agent := ActivityEvent{ContainerID: containerID, ContainerName: containerName, ImageName: imageName}
+		// Un refus d'accès est signalé une seule fois par dockerCall
+		if err := w.read(ctx, agent, existing); err != nil && ctx.Err() == nil && !errors.Is(err, ErrCapabilityUnavailable) {
+			log.Printf("Error following logs of %s: %v", containerName, err)
+		}
+	}()
+}
+
+// forget arrête le suivi d'un conteneur et oublie son état
+func (w *logWatcher) forget(containerID string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if cancel, ok := w.followed[containerID]; ok {
+		cancel()
+		delete(w.followed, containerID)
+	}
+	delete(w.jobs, containerID)
+}
+
+// read lit le flux de logs d'un agent et traite chaque ligne
+func (w *logWatcher) read(ctx context.Context, agent ActivityEvent, existing bool) error {
+	cli := w.monitor.dockerClientFor(agent.ContainerID)
+	if cli == nil {
+		return fmt.Errorf("no Docker API endpoint for container %s", agent.ContainerID)
+	}
+	var info container.InspectResponse
+	err := w.monitor.dockerCall(agent.ContainerID, CapabilityInspect, func() (err error) {
+		info, err = cli.ContainerInspect(ctx, agent.ContainerID)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to inspect container: %w", err)
+	}
+	if info.Config != nil {
+		w.mu.Lock()
+		if job, ok := w.jobs[agent.ContainerID]; ok {
+			job.Base = jobMetadataFromEnv(info.Config.Env, info.Config.Labels)
+		}
+		w.mu.Unlock()
+	}
+
+	options := container.LogsOptions{ShowStdout: true, ShowStderr: true, Follow: true, Timestamps: true}
+	var startedAt time.Time
+	if existing {
+		// Relire la fin de l'historique pour retrouver un job déjà en cours
+		options.Tail = initialLogTail
+	} else if startedAt = runStartedAt(info); !startedAt.IsZero() {
+		// Un conteneur redémarré conserve ses logs : ne lire que ceux de l'exécution en cours
+		options.Since = fmt.Sprintf("%d.%09d", startedAt.Unix(), startedAt.Nanosecond())
+	} else {
+		options.Tail = "0"
+	}
+	followedAt := time.Now()
+
+	var logs io.ReadCloser
+	err = w.monitor.dockerCall(agent.ContainerID, CapabilityLogs, func() (err error) {
+		logs, err = cli.ContainerLogs(ctx, agent.ContainerID, options)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read logs: %w", err)
+	}
+	defer logs.Close()
+
+	// Sans TTY, stdout et stderr sont multiplexés dans le flux
+	var reader io.Reader = logs
+	if info.Config == nil || !info.Config.Tty {
+		pr, pw := io.Pipe()
+		go func() {
+			_, err := stdcopy.StdCopy(pw, pw, logs)
+			pw.CloseWithError(err)
+		}()
+		defer pr.Close()
+		reader = pr
+	}
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		timestamp, line := splitLogTimestamp(scanner.Text())
+		if timestamp.Before(startedAt) {
+			continue
+		}
+		// Le conteneur a pu être renommé depuis le début du suivi
+		agent.ContainerName = w.monitor.containers.name(agent.ContainerID, agent.ContainerName)
+		// Les lignes relues de l'historique mettent l'état à jour sans émettre d'événement
+		emit := !existing || !timestamp.Before(followedAt)
+		if transition, activity, ok := w.parseLine(agent, line, timestamp, emit); ok {
+			w.monitor.HandleTransition(transition)
+			w.monitor.emitActivity(activity)
+		}
+	}
+	return scanner.Err()
+}
+
+// runStartedAt retourne le démarrage de l'exécution en cours d'un conteneur (zéro si inconnu)
+func runStartedAt(info container.InspectResponse) time.Time {
+	if info.ContainerJSONBase == nil || info.State == nil {
+		return time.Time{}
+	}
+	startedAt, err := time.Parse(time.RFC3339Nano, info.State.StartedAt)
+	if err != nil || startedAt.Year() <= 1 {
+		return time.Time{}
+	}
+	return startedAt
+}
+
+// splitLogTimestamp sépare l'horodatage Docker (option Timestamps) du contenu de la ligne
+func splitLogTimestamp(line string) (time.Time, string) {
+	prefix, rest, found := strings.Cut(line, " ")
+	if !found {
+		return time.Now(), line
+	}
+	timestamp, err := time.Parse(time.RFC3339Nano, prefix)
+	if err != nil {
+		return time.Now(), line
+	}
+	return timestamp, rest
+}
+
+// parseLine met à jour l'état du job selon une ligne de log et retourne la transition
+// et l'événement d'activité à émettre
+func (w *logWatcher) parseLine(agent ActivityEvent, line string, timestamp time.Time, emit bool) (StateTransition, ActivityEvent, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	job, ok := w.jobs[agent.ContainerID]
+	if !ok {
+		return StateTransition{}, ActivityEvent{}, false
+	}
+
+	if match := w.patterns.JobFinished.FindStringSubmatch(line); match != nil {
+		metadata := job.Base.Merge(job.Job).Merge(logJobMetadata(w.patterns.JobFinished, match))
+		*job = jobState{Base: job.Base}
+
+		transition := agentTransition(TransitionJobFinished, AgentState{ActivityEvent: agent}, "job finished", timestamp)
+		transition.JobName = metadata.JobName
+		transition.JobResult = namedGroup(w.patterns.JobFinished, match, "result")
+		return transition, jobActivity(agent, ActionJobFinished, metadata, timestamp), emit
+	}
+
+	if match := w.patterns.JobStarted.FindStringSubmatch(line); match != nil {
+		metadata := job.Base.Merge(logJobMetadata(w.patterns.JobStarted, match))
+		*job = jobState{Running: true, Job: metadata, Since: timestamp, Base: job.Base}
+
+		transition := agentTransition(TransitionJobStarted, AgentState{ActivityEvent: agent}, "job started", timestamp)
+		transition.JobName = metadata.JobName
+		return transition, jobActivity(agent, ActionJobStarted, metadata, timestamp), emit
+	}
+
+	return StateTransition{}, ActivityEvent{}, false
+}
+
+// logJobMetadata extrait les métadonnées des groupes nommés d'une ligne de log
+func logJobMetadata(re *regexp.Regexp, match []string) JobMetadata {
+	var job JobMetadata
+	for group, field := range jobMetadataGroups {
+		if value := namedGroup(re, match, group); value != "" {
+			*field(&job) = value
+		}
+	}
+	return job
+}
+
+// jobActivity construit l'événement d'activité d'un début ou d'une fin de job
+func jobActivity(agent ActivityEvent, action string, job JobMetadata, timestamp time.Time) ActivityEvent {
+	agent.Action = action
+	agent.Timestamp = timestamp
+	agent.IsAzureAgent = true
+	agent.Job = jobPointer(job)
+	return agent
+}
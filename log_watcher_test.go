@@ -0,0 +1,201 @@
+package ecsazrlc
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// logLine construit une ligne de log horodatée comme avec l'option Timestamps de Docker
+func logLine(at time.Time, text string) string {
+	return at.UTC().Format(time.RFC3339Nano) + " " + text
+}
+
+// waitForTransitions attend que le récepteur ait reçu au moins n transitions
+func waitForTransitions(t *testing.T, sink *recordingSink, n int) []StateTransition {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		sink.mu.Lock()
+		transitions := append([]StateTransition(nil), sink.transitions...)
+		sink.mu.Unlock()
+		if len(transitions) >= n {
+			return transitions
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Expected %d transition(s), got %v", n, sink.types())
+	return nil
+}
+
+// TestNewLogPatterns vérifie la compilation des motifs
+func TestNewLogPatterns(t *testing.T) {
+	patterns, err := NewLogPatterns("", "")
+	if err != nil {
+		t.Fatalf("NewLogPatterns() error: %v", err)
+	}
+	if patterns.JobStarted.String() != DefaultJobStartedPattern || patterns.JobFinished.String() != DefaultJobFinishedPattern {
+		t.Error("Empty patterns should fall back to the defaults")
+	}
+	if _, err := NewLogPatterns("(", ""); err == nil {
+		t.Error("Expected an error for an invalid pattern")
+	}
+}
+
+// TestLogWatcherJobEvents vérifie la détection des jobs dans les logs d'un agent qui démarre
+func TestLogWatcherJobEvents(t *testing.T) {
+	now := time.Now()
+	fake := newFakeDocker(t, &fakeContainer{
+		ID:        "aaaaaaaaaaaa0001",
+		Name:      "agent-1",
+		Image:     "azp-agent:latest",
+		StartedAt: now.Add(-time.Second),
+		Logs: []string{
+			logLine(now, "Listening for Jobs"),
+			logLine(now, "Running job: Build Linux"),
+			logLine(now, "Job Build Linux completed with result: Succeeded"),
+			logLine(now, "Running job: Deploy"),
+		},
+	})
+
+	patterns, _ := NewLogPatterns("", "")
+	monitor := fake.monitor(t, MonitorConfig{JobLogPatterns: patterns})
+	sink := &recordingSink{}
+	monitor.AddTransitionSink(sink)
+
+	monitor.HandleTransition(StateTransition{Type: TransitionAgentStarted, ContainerID: "aaaaaaaaaaaa", ContainerName: "agent-1"})
+	// Le suivi des logs démarre avant que le récepteur de test ne reçoive AgentStarted
+	var transitions []StateTransition
+	for _, transition := range waitForTransitions(t, sink, 4) {
+		if transition.Type != TransitionAgentStarted {
+			transitions = append(transitions, transition)
+		}
+	}
+	if len(transitions) != 3 {
+		t.Fatalf("Expected 3 job transitions, got %+v", transitions)
+	}
+
+	started, finished := transitions[0], transitions[1]
+	if started.Type != TransitionJobStarted || started.JobName != "Build Linux" {
+		t.Errorf("Unexpected job started transition: %+v", started)
+	}
+	if finished.Type != TransitionJobFinished || finished.JobName != "Build Linux" || finished.JobResult != "Succeeded" {
+		t.Errorf("Unexpected job finished transition: %+v", finished)
+	}
+	if transitions[2].Type != TransitionJobStarted || transitions[2].JobName != "Deploy" {
+		t.Errorf("Unexpected last transition: %+v", transitions[2])
+	}
+
+	state := monitor.probeAgent(ActivityEvent{ContainerID: "aaaaaaaaaaaa", ContainerName: "agent-1"})
+	if !state.Busy || !strings.HasPrefix(state.Reason, "logs:") {
+		t.Errorf("Expected agent to be busy according to logs, got %+v", state)
+	}
+
+	monitor.HandleTransition(StateTransition{Type: TransitionAgentStopped, ContainerID: "aaaaaaaaaaaa", ContainerName: "agent-1"})
+	if result, _ := monitor.logWatcher.Probe(monitor.ctx, ActivityEvent{ContainerID: "aaaaaaaaaaaa"}); result.Known {
+		t.Error("Stopped agents should be forgotten")
+	}
+}
+
+// TestLogWatcherExistingAgent vérifie que l'historique met à jour l'état sans émettre d'événements
+func TestLogWatcherExistingAgent(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	fake := newFakeDocker(t, &fakeContainer{
+		ID:    "aaaaaaaaaaaa0001",
+		Name:  "agent-1",
+		Image: "azp-agent:latest",
+		Logs: []string{
+			logLine(past, "Running job: Build"),
+			logLine(past, "Job Build completed with result: Failed"),
+		},
+	})
+
+	patterns, _ := NewLogPatterns("", "")
+	monitor := fake.monitor(t, MonitorConfig{JobLogPatterns: patterns})
+	sink := &recordingSink{}
+	monitor.AddTransitionSink(sink)
+
+	monitor.logWatcher.followRunning([]ActivityEvent{{ContainerID: "aaaaaaaaaaaa", ContainerName: "agent-1"}})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		monitor.logWatcher.mu.Lock()
+		_, following := monitor.logWatcher.followed["aaaaaaaaaaaa"]
+		monitor.logWatcher.mu.Unlock()
+		if !following {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if len(sink.types()) != 0 {
+		t.Errorf("History should not produce events, got %v", sink.types())
+	}
+	result, _ := monitor.logWatcher.Probe(monitor.ctx, ActivityEvent{ContainerID: "aaaaaaaaaaaa"})
+	if !result.Known || result.Busy {
+		t.Errorf("Expected agent to be known idle, got %+v", result)
+	}
+}
+
+// TestLogWatcherRestartedAgent vérifie qu'un agent redémarré ne rejoue pas les jobs de ses exécutions précédentes
+func TestLogWatcherRestartedAgent(t *testing.T) {
+	started := time.Now().Add(-time.Minute)
+	fake := newFakeDocker(t, &fakeContainer{
+		ID:        "aaaaaaaaaaaa0001",
+		Name:      "agent-1",
+		Image:     "azp-agent:latest",
+		StartedAt: started,
+		Logs: []string{
+			logLine(started.Add(-2*time.Hour), "Running job: Old Build"),
+			logLine(started.Add(-time.Hour), "Job Old Build completed with result: Succeeded"),
+			logLine(started.Add(-time.Hour), "Running job: Interrupted"),
+			logLine(started.Add(time.Second), "Listening for Jobs"),
+			logLine(started.Add(2*time.Second), "Running job: New Build"),
+		},
+	})
+
+	patterns, _ := NewLogPatterns("", "")
+	monitor := fake.monitor(t, MonitorConfig{JobLogPatterns: patterns})
+	sink := &recordingSink{}
+	monitor.AddTransitionSink(sink)
+
+	monitor.HandleTransition(StateTransition{Type: TransitionAgentStarted, ContainerID: "aaaaaaaaaaaa", ContainerName: "agent-1"})
+	waitForTransitions(t, sink, 2)
+	time.Sleep(50 * time.Millisecond)
+
+	var jobs []string
+	for _, transition := range waitForTransitions(t, sink, 2) {
+		if transition.Type != TransitionAgentStarted {
+			jobs = append(jobs, string(transition.Type)+" "+transition.JobName)
+		}
+	}
+	if len(jobs) != 1 || jobs[0] != string(TransitionJobStarted)+" New Build" {
+		t.Errorf("Only the job of the current run should be reported, got %v", jobs)
+	}
+}
+
+// TestLogWatcherJobMetadata vérifie l'enrichissement des événements d'activité issus des logs
+func TestLogWatcherJobMetadata(t *testing.T) {
+	fake := newFakeDocker(t, &fakeContainer{
+		ID:        "aaaaaaaaaaaa0001",
+		Name:      "agent-1",
+		Image:     "azp-agent:latest",
+		Env:       []string{"AZP_POOL=Linux"},
+		Logs:      []string{logLine(time.Now(), "Running job: Build (build 991)")},
+		StartedAt: time.Now().Add(-time.Second),
+	})
+
+	patterns, _ := NewLogPatterns(`Running job: (?P<job>\S+) \(build (?P<build>\d+)\)`, "")
+	monitor := fake.monitor(t, MonitorConfig{JobLogPatterns: patterns})
+	monitor.HandleTransition(StateTransition{Type: TransitionAgentStarted, ContainerID: "aaaaaaaaaaaa", ContainerName: "agent-1"})
+
+	select {
+	case event := <-monitor.GetActivityChannel():
+		expected := JobMetadata{BuildID: "991", JobName: "Build", AgentPool: "Linux"}
+		if event.Action != ActionJobStarted || event.Job == nil || *event.Job != expected {
+			t.Errorf("Unexpected activity event: %+v (job %+v)", event, event.Job)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected a job_started activity event")
+	}
+}
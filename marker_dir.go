@@ -0,0 +1,178 @@
+package ecsazrlc
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultMarkerDir est le répertoire de fichiers marqueurs suggéré
+const DefaultMarkerDir = "/var/lib/ecsazrlc/busy.d"
+
+// markerHold est un fichier marqueur lu depuis le répertoire
+type markerHold struct {
+	Name      string
+	Reason    string
+	ExpiresAt time.Time
+}
+
+// MarkerDirSource considère chaque fichier d'un répertoire comme un maintien d'activité.
+// La première ligne du fichier peut fixer l'expiration : date RFC 3339, timestamp Unix,
+// ou durée Go comptée depuis la dernière modification ; le reste du fichier est la raison.
+type MarkerDirSource struct {
+	dir    string
+	maxAge time.Duration // Expiration par défaut depuis la dernière modification (0 = aucune)
+	mu     sync.Mutex
+	holds  []markerHold
+	now    func() time.Time
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewMarkerDirSource crée la source et le répertoire s'il n'existe pas
+func NewMarkerDirSource(dir string, maxAge time.Duration) (*MarkerDirSource, error) {
+	if err := os.MkdirAll(dir, 0o775); err != nil {
+		return nil, fmt.Errorf("failed to create marker directory: %w", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &MarkerDirSource{dir: dir, maxAge: maxAge, now: time.Now, ctx: ctx, cancel: cancel, done: make(chan struct{})}
+	if err := s.rescan(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Name retourne le nom de la source
+func (s *MarkerDirSource) Name() string {
+	return "marker-files"
+}
+
+// Holds retourne les fichiers marqueurs non expirés
+func (s *MarkerDirSource) Holds() ([]ActivityHold, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	var holds []ActivityHold
+	for _, marker := range s.holds {
+		if !marker.ExpiresAt.IsZero() && !now.Before(marker.ExpiresAt) {
+			continue
+		}
+		holds = append(holds, ActivityHold{Source: s.Name(), ID: marker.Name, Reason: marker.Reason, ExpiresAt: marker.ExpiresAt})
+	}
+	return holds, nil
+}
+
+// Start surveille le répertoire jusqu'à l'appel de Stop
+func (s *MarkerDirSource) Start() {
+	defer close(s.done)
+	if err := s.watch(s.ctx); err != nil {
+		log.Printf("Error watching marker directory %s: %v", s.dir, err)
+	}
+}
+
+// Stop arrête la surveillance du répertoire
+func (s *MarkerDirSource) Stop() {
+	s.cancel()
+	<-s.done
+}
+
+// rescan relit le contenu du répertoire
+func (s *MarkerDirSource) rescan() error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read marker directory: %w", err)
+	}
+
+	var holds []markerHold
+	for _, entry := range entries {
+		// Ignorer les sous-répertoires et les fichiers cachés (fichiers temporaires d'éditeurs)
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		hold, err := s.readMarker(entry.Name())
+		if err != nil {
+			// Le fichier a pu être supprimé entre-temps
+			continue
+		}
+		holds = append(holds, hold)
+	}
+
+	s.mu.Lock()
+	previous := len(s.holds)
+	s.holds = holds
+	s.mu.Unlock()
+
+	if len(holds) != previous {
+		log.Printf("Marker directory %s: %d activity hold(s)", s.dir, len(holds))
+	}
+	return nil
+}
+
+// readMarker lit un fichier marqueur
+func (s *MarkerDirSource) readMarker(name string) (markerHold, error) {
+	path := filepath.Join(s.dir, name)
+	info, err := os.Stat(path)
+	if err != nil {
+		return markerHold{}, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return markerHold{}, err
+	}
+	return parseMarker(name, string(data), info.ModTime(), s.maxAge), nil
+}
+
+// parseMarker interprète le contenu d'un fichier marqueur
+func parseMarker(name, content string, modTime time.Time, maxAge time.Duration) markerHold {
+	hold := markerHold{Name: name}
+
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	var lines []string
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	if len(lines) > 0 {
+		if expiresAt, ok := parseMarkerExpiry(lines[0], modTime); ok {
+			hold.ExpiresAt = expiresAt
+			lines = lines[1:]
+		}
+	}
+	hold.Reason = strings.Join(lines, " ")
+	if hold.Reason == "" {
+		hold.Reason = "marker file " + name
+	}
+
+	if hold.ExpiresAt.IsZero() && maxAge > 0 {
+		hold.ExpiresAt = modTime.Add(maxAge)
+	}
+	return hold
+}
+
+// parseMarkerExpiry interprète une ligne d'expiration (RFC 3339, timestamp Unix ou durée).
+// Un nombre n'est un timestamp que s'il est postérieur à l'écriture du fichier : sinon c'est
+// une raison (numéro de build...) et non une échéance déjà passée.
+func parseMarkerExpiry(line string, modTime time.Time) (time.Time, bool) {
+	if expiresAt, err := time.Parse(time.RFC3339, line); err == nil {
+		return expiresAt, true
+	}
+	if seconds, err := strconv.ParseInt(line, 10, 64); err == nil {
+		expiresAt := time.Unix(seconds, 0)
+		return expiresAt, expiresAt.After(modTime)
+	}
+	if duration, err := time.ParseDuration(line); err == nil {
+		return modTime.Add(duration), true
+	}
+	return time.Time{}, false
+}
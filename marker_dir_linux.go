@@ -0,0 +1,54 @@
+package ecsazrlc
+
+import (
+	"context"
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// Événements inotify qui modifient l'ensemble des fichiers marqueurs
+const markerWatchMask = unix.IN_CREATE | unix.IN_DELETE | unix.IN_CLOSE_WRITE | unix.IN_MODIFY |
+	unix.IN_MOVED_TO | unix.IN_MOVED_FROM | unix.IN_ATTRIB
+
+// watch relit le répertoire à chaque événement inotify
+func (s *MarkerDirSource) watch(ctx context.Context) error {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return fmt.Errorf("inotify init failed: %w", err)
+	}
+	defer unix.Close(fd)
+
+	if _, err := unix.InotifyAddWatch(fd, s.dir, markerWatchMask); err != nil {
+		return fmt.Errorf("inotify watch failed: %w", err)
+	}
+	// Des fichiers ont pu apparaître avant la mise en place de la surveillance
+	s.rescan()
+
+	buf := make([]byte, 64*1024)
+	fds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}
+	for ctx.Err() == nil {
+		// Attente bornée pour vérifier régulièrement l'annulation du contexte
+		n, err := unix.Poll(fds, 1000)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("inotify poll failed: %w", err)
+		}
+		if n == 0 {
+			continue
+		}
+
+		// Vider les événements en attente ; leur détail importe peu, le répertoire est relu
+		for {
+			if _, err := unix.Read(fd, buf); err != nil {
+				break
+			}
+		}
+		if err := s.rescan(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
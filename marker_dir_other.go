@@ -0,0 +1,29 @@
+//go:build !linux
+
+package ecsazrlc
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Intervalle de relecture du répertoire sans inotify
+const markerPollInterval = 5 * time.Second
+
+// watch relit périodiquement le répertoire (inotify n'existe que sous Linux)
+func (s *MarkerDirSource) watch(ctx context.Context) error {
+	ticker := time.NewTicker(markerPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.rescan(); err != nil {
+				log.Printf("Error reading marker directory: %v", err)
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package ecsazrlc
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestParseMarker vérifie l'interprétation du contenu des fichiers marqueurs
+func TestParseMarker(t *testing.T) {
+	modTime := time.Date(2026, 1, 31, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		content   string
+		maxAge    time.Duration
+		reason    string
+		expiresAt time.Time
+	}{
+		{"empty", "", 0, "marker file empty", time.Time{}},
+		{"reason only", "database migration\n", 0, "database migration", time.Time{}},
+		{"max age", "", time.Hour, "marker file max age", modTime.Add(time.Hour)},
+		{"rfc3339", "2026-01-31T18:00:00Z\nwaiting for approval", time.Hour, "waiting for approval", time.Date(2026, 1, 31, 18, 0, 0, 0, time.UTC)},
+		{"unix timestamp", "1769889600", 0, "marker file unix timestamp", time.Unix(1769889600, 0)},
+		{"numeric reason", "4217", 0, "4217", time.Time{}},
+		{"duration", "45m\nload test\nphase 2", 0, "load test phase 2", modTime.Add(45 * time.Minute)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hold := parseMarker(tt.name, tt.content, modTime, tt.maxAge)
+			if hold.Reason != tt.reason {
+				t.Errorf("Reason = %q, want %q", hold.Reason, tt.reason)
+			}
+			if !hold.ExpiresAt.Equal(tt.expiresAt) {
+				t.Errorf("ExpiresAt = %v, want %v", hold.ExpiresAt, tt.expiresAt)
+			}
+		})
+	}
+}
+
+// TestMarkerDirSource vérifie la détection des fichiers marqueurs et leur expiration
+func TestMarkerDirSource(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "busy.d")
+	source, err := NewMarkerDirSource(dir, 0)
+	if err != nil {
+		t.Fatalf("NewMarkerDirSource() error: %v", err)
+	}
+	go source.Start()
+	defer source.Stop()
+
+	if holds, _ := source.Holds(); len(holds) != 0 {
+		t.Fatalf("Empty directory should not hold the instance, got %+v", holds)
+	}
+
+	// Écriture atomique (fichier caché puis renommage) : le marqueur n'est jamais vu vide
+	write := func(name, content string) {
+		tmp := filepath.Join(dir, "."+name+".tmp")
+		if err := os.WriteFile(tmp, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(tmp, filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("migration", "database migration")
+	write(".migration.swp", "")
+	write("expired", "2020-01-01T00:00:00Z")
+
+	holds := waitForHolds(t, source, 1)
+	if holds[0].ID != "migration" || holds[0].Reason != "database migration" || holds[0].Source != "marker-files" {
+		t.Errorf("Unexpected hold: %+v", holds[0])
+	}
+
+	if err := os.Remove(filepath.Join(dir, "migration")); err != nil {
+		t.Fatal(err)
+	}
+	waitForHolds(t, source, 0)
+}
+
+// waitForHolds attend que la source retourne le nombre de maintiens attendu
+func waitForHolds(t *testing.T, source *MarkerDirSource, want int) []ActivityHold {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second) // Relecture toutes les 5s hors Linux
+	for {
+		holds, err := source.Holds()
+		if err != nil {
+			t.Fatalf("Holds() error: %v", err)
+		}
+		if len(holds) == want {
+			return holds
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d hold(s), got %+v", want, holds)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
@@ -0,0 +1,148 @@
+package ecsazrlc
+
+import (
+	"log"
+	"time"
+)
+
+// ActivityMetrics regroupe les métriques d'activité d'une instance à un instant donné
+type ActivityMetrics struct {
+	ClusterName string
+	InstanceID  string
+	Timestamp   time.Time
+	BusyAgents  int
+	IdleAgents  int
+	// Durée de la plus longue période d'occupation en cours et agents en retard (règles JobOverdue)
+	LongestJob    time.Duration
+	OverdueAgents int
+}
+
+// metricValue est une valeur de métrique nommée, commune à tous les formats de sortie
+type metricValue struct {
+	Name  string
+	Value float64
+	Unit  string
+}
+
+// NewActivityMetrics calcule les métriques à partir de l'état des agents
+func NewActivityMetrics(clusterName, instanceID string, states []AgentState) ActivityMetrics {
+	metrics := ActivityMetrics{
+		ClusterName: clusterName,
+		InstanceID:  instanceID,
+		Timestamp:   time.Now(),
+	}
+	for _, state := range states {
+		if state.Busy {
+			metrics.BusyAgents++
+		} else {
+			metrics.IdleAgents++
+		}
+		if state.Overdue {
+			metrics.OverdueAgents++
+		}
+		if duration := state.JobDuration(metrics.Timestamp); duration > metrics.LongestJob {
+			metrics.LongestJob = duration
+		}
+	}
+	return metrics
+}
+
+// TotalAgents retourne le nombre total d'agents détectés
+func (m ActivityMetrics) TotalAgents() int {
+	return m.BusyAgents + m.IdleAgents
+}
+
+// values retourne le jeu de métriques publié par chaque backend
+func (m ActivityMetrics) values() []metricValue {
+	return []metricValue{
+		{Name: "BusyAgents", Value: float64(m.BusyAgents), Unit: "Count"},
+		{Name: "IdleAgents", Value: float64(m.IdleAgents), Unit: "Count"},
+		{Name: "TotalAgents", Value: float64(m.TotalAgents()), Unit: "Count"},
+		{Name: "LongestJobDuration", Value: m.LongestJob.Seconds(), Unit: "Seconds"},
+		{Name: "OverdueAgents", Value: float64(m.OverdueAgents), Unit: "Count"},
+	}
+}
+
+// MetricsPublisher publie les métriques d'activité vers un backend
+type MetricsPublisher interface {
+	// Publish enregistre un point de mesure (éventuellement mis en tampon)
+	Publish(metrics ActivityMetrics) error
+	// Flush envoie les points en attente
+	Flush() error
+}
+
+// MetricsReporter échantillonne l'état des agents et le publie périodiquement
+type MetricsReporter struct {
+	publisher     MetricsPublisher
+	clusterName   string
+	instanceID    string
+	interval      time.Duration
+	flushInterval time.Duration
+	stopChan      chan struct{}
+}
+
+// NewMetricsReporter crée un rapporteur de métriques.
+// interval est la période d'échantillonnage (le heartbeat), flushInterval la période d'envoi.
+func NewMetricsReporter(publisher MetricsPublisher, clusterName, instanceID string, interval, flushInterval time.Duration) *MetricsReporter {
+	if flushInterval < interval {
+		flushInterval = interval
+	}
+	return &MetricsReporter{
+		publisher:     publisher,
+		clusterName:   clusterName,
+		instanceID:    instanceID,
+		interval:      interval,
+		flushInterval: flushInterval,
+		stopChan:      make(chan struct{}),
+	}
+}
+
+// collect échantillonne l'état des agents et publie un point de mesure
+func (r *MetricsReporter) collect(monitor *Monitor) {
+	states, err := monitor.GetAgentStates()
+	if err != nil {
+		log.Printf("Error collecting agent states for metrics: %v", err)
+		return
+	}
+
+	if err := r.publisher.Publish(NewActivityMetrics(r.clusterName, r.instanceID, states)); err != nil {
+		log.Printf("Error publishing metrics: %v", err)
+	}
+}
+
+// flush envoie les points en attente
+func (r *MetricsReporter) flush() {
+	if err := r.publisher.Flush(); err != nil {
+		log.Printf("Error flushing metrics: %v", err)
+	}
+}
+
+// Start démarre l'échantillonnage périodique (bloquant jusqu'à Stop)
+func (r *MetricsReporter) Start(monitor *Monitor) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	flushTicker := time.NewTicker(r.flushInterval)
+	defer flushTicker.Stop()
+
+	log.Printf("Starting metrics reporting every %v (flush every %v)", r.interval, r.flushInterval)
+
+	for {
+		select {
+		case <-ticker.C:
+			r.collect(monitor)
+
+		case <-flushTicker.C:
+			r.flush()
+
+		case <-r.stopChan:
+			r.flush()
+			log.Println("Metrics reporting stopped")
+			return
+		}
+	}
+}
+
+// Stop arrête le rapporteur de métriques
+func (r *MetricsReporter) Stop() {
+	close(r.stopChan)
+}
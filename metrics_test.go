@@ -0,0 +1,79 @@
+package ecsazrlc
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingPublisher mémorise les métriques publiées
+type recordingPublisher struct {
+	mu        sync.Mutex
+	published []ActivityMetrics
+	flushes   int
+}
+
+func (p *recordingPublisher) Publish(metrics ActivityMetrics) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.published = append(p.published, metrics)
+	return nil
+}
+
+func (p *recordingPublisher) Flush() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.flushes++
+	return nil
+}
+
+// TestNewActivityMetrics vérifie le décompte des agents occupés et inactifs
+func TestNewActivityMetrics(t *testing.T) {
+	started := time.Now().Add(-time.Hour)
+	states := []AgentState{{Busy: true, BusySince: started, Overdue: true}, {Busy: false}, {Busy: true, BusySince: time.Now()}}
+
+	metrics := NewActivityMetrics("test-cluster", "i-123", states)
+	if metrics.BusyAgents != 2 || metrics.IdleAgents != 1 || metrics.TotalAgents() != 3 {
+		t.Errorf("Unexpected metrics: %+v", metrics)
+	}
+	if metrics.OverdueAgents != 1 || metrics.LongestJob < time.Hour {
+		t.Errorf("Unexpected job metrics: %+v", metrics)
+	}
+
+	values := metrics.values()
+	if len(values) != 5 || values[0].Name != "BusyAgents" || values[0].Value != 2 {
+		t.Errorf("Unexpected metric values: %+v", values)
+	}
+}
+
+// TestMetricsReporter vérifie l'échantillonnage et le flush à l'arrêt
+func TestMetricsReporter(t *testing.T) {
+	fake := newFakeDocker(t,
+		&fakeContainer{ID: "aaaaaaaaaaaa0001", Name: "agent-busy", Image: "azp-agent:latest", Processes: []string{"Agent.Worker"}},
+	)
+	monitor := fake.monitor(t, MonitorConfig{})
+	publisher := &recordingPublisher{}
+
+	reporter := NewMetricsReporter(publisher, "test-cluster", "i-123", 20*time.Millisecond, time.Hour)
+	done := make(chan struct{})
+	go func() {
+		reporter.Start(monitor)
+		close(done)
+	}()
+
+	time.Sleep(70 * time.Millisecond)
+	reporter.Stop()
+	<-done
+
+	publisher.mu.Lock()
+	defer publisher.mu.Unlock()
+	if len(publisher.published) == 0 {
+		t.Fatal("Expected metrics to be published")
+	}
+	if publisher.published[0].BusyAgents != 1 || publisher.published[0].InstanceID != "i-123" {
+		t.Errorf("Unexpected metrics: %+v", publisher.published[0])
+	}
+	if publisher.flushes != 1 {
+		t.Errorf("Expected a final flush on stop, got %d", publisher.flushes)
+	}
+}
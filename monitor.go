@@ -6,6 +6,7 @@ import (
 	"io"
 	"log"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/docker/docker/api/types"
@@ -16,12 +17,30 @@ import (
 
 // Monitor surveille l'activité des conteneurs Azure DevOps Agent
 type Monitor struct {
-	dockerClient      *client.Client
+	runtime           ContainerRuntime // Runtime interrogé (Docker, Podman ou containerd)
+	dockerClient      *client.Client   // Client Docker pour les fonctions propres à son API (nil sous containerd)
 	ctx               context.Context
 	cancel            context.CancelFunc
 	activityChan      chan ActivityEvent
-	excludeContainers []string // Liste des noms/IDs de conteneurs à exclure
-	excludeImages     []string // Liste des images à exclure
+	excludeContainers []string    // Liste des noms/IDs de conteneurs à exclure
+	excludeImages     []string    // Liste des images à exclure
+	probes            []BusyProbe // Sondes d'occupation, évaluées dans l'ordre
+	transitionSinks   []TransitionSink
+	sinksMu           sync.Mutex
+	longRunningAfter  time.Duration
+	logWatcher        *logWatcher       // Suivi des logs des agents (nil si désactivé)
+	jobOwnerLabel     string            // Label désignant l'agent propriétaire d'un conteneur de job
+	leases            *LeaseStore       // Baux d'activité explicites
+	hostAgents        *hostAgentScanner // Détection des agents hors conteneur (nil si désactivée)
+	procRoot          string            // /proc de l'hôte pour lire les processus des conteneurs
+	sources           []ActivitySource  // Sources de maintiens d'activité (baux, fichiers marqueurs...)
+	sourcesMu         sync.Mutex
+	api               apiAccess         // Appels de l'API Docker refusés (proxy du socket)
+	containers        *containerTracker // État des conteneurs agents reconstitué à partir des événements
+	jobs              *jobClock         // Début de la période d'occupation de chaque agent
+	overdue           *overduePolicy    // Règles JobOverdue (nil si aucune)
+	activityMu        sync.RWMutex
+	activityClosed    bool
 }
 
 // ActivityEvent représente un événement d'activité
@@ -32,12 +51,41 @@ type ActivityEvent struct {
 	Action        string
 	Timestamp     time.Time
 	IsAzureAgent  bool
+	Job           *JobMetadata // Contexte du pipeline (nil si inconnu)
+	HostPID       int          // PID de Agent.Listener pour un agent hors conteneur (0 pour un conteneur)
+	Endpoint      string       // Endpoint du runtime d'où provient l'événement ("host" pour un agent hors conteneur)
+	Detail        string       // Complément de l'action : état de santé, ancien nom, ID de la session exec
+	Exec          *ExecSession // Session exec des événements exec_start et exec_die
 }
 
 // MonitorConfig contient la configuration du moniteur
 type MonitorConfig struct {
 	ExcludeContainers []string // Noms ou IDs de conteneurs à exclure
 	ExcludeImages     []string // Images à exclure (patterns)
+
+	LongRunningJobAfter time.Duration // Durée d'occupation au-delà de laquelle un job est signalé comme long (0 = désactivé)
+
+	AzureDevOps     *AzureDevOpsClient // Client Azure DevOps pour l'état réel des agents (optionnel)
+	AzureDevOpsPool string             // Pool par défaut si le conteneur ne définit pas AZP_POOL
+
+	JobLogPatterns *LogPatterns // Motifs de début/fin de job pour suivre les logs des agents (désactivé si nil)
+
+	JobOwnerLabel       string // Label désignant l'agent propriétaire d'un conteneur de job (DefaultJobOwnerLabel si vide)
+	JobContainerNetwork bool   // Attribuer à un agent les conteneurs partageant un de ses réseaux utilisateur
+
+	Stats *StatsThresholds // Seuils de consommation utilisés en dernier recours (désactivé si nil)
+
+	MaxLeaseTTL time.Duration // Durée maximale d'un bail d'activité (DefaultMaxLeaseTTL si 0)
+
+	HostProcRoot string // /proc de l'hôte pour détecter les agents hors conteneur (désactivé si vide) et lire les processus des conteneurs (DefaultProcRoot si vide)
+
+	Runtime             string // Runtime de conteneurs : RuntimeAuto (défaut), RuntimeDocker, RuntimePodman ou RuntimeContainerd
+	ContainerdAddress   string // Socket containerd (DefaultContainerdAddress si vide)
+	ContainerdNamespace string // Namespace containerd (DefaultContainerdNamespace si vide)
+
+	Endpoints []EndpointConfig // Démons Docker à surveiller ensemble (remplace Runtime si non vide)
+
+	OverdueRules []OverdueRule // Durées maximales d'occupation par image ou pool ; la première règle correspondante s'applique
 }
 
 // NewMonitor crée une nouvelle instance du moniteur
@@ -47,21 +95,79 @@ func NewMonitor() (*Monitor, error) {
 
 // NewMonitorWithConfig crée une nouvelle instance du moniteur avec configuration
 func NewMonitorWithConfig(config MonitorConfig) (*Monitor, error) {
-	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	ctx, cancel := context.WithCancel(context.Background())
+
+	runtime, err := newContainerRuntime(ctx, config)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create Docker client: %w", err)
+		cancel()
+		return nil, fmt.Errorf("failed to create container runtime client: %w", err)
 	}
+	config.Runtime = runtime.Name()
 
-	ctx, cancel := context.WithCancel(context.Background())
+	return newMonitor(ctx, cancel, runtime, config), nil
+}
 
-	return &Monitor{
-		dockerClient:      cli,
+// newMonitor assemble un moniteur autour d'un runtime existant
+func newMonitor(ctx context.Context, cancel context.CancelFunc, runtime ContainerRuntime, config MonitorConfig) *Monitor {
+	m := &Monitor{
+		runtime:           runtime,
 		ctx:               ctx,
 		cancel:            cancel,
 		activityChan:      make(chan ActivityEvent, 100),
 		excludeContainers: config.ExcludeContainers,
 		excludeImages:     config.ExcludeImages,
-	}, nil
+		longRunningAfter:  config.LongRunningJobAfter,
+		leases:            NewLeaseStore(config.MaxLeaseTTL),
+		containers:        newContainerTracker(),
+		jobs:              newJobClock(),
+		procRoot:          procRootPath(config.HostProcRoot),
+	}
+	if len(config.OverdueRules) > 0 {
+		m.overdue = newOverduePolicy(config.OverdueRules, config.AzureDevOpsPool)
+	}
+	if docker, ok := runtime.(*dockerRuntime); ok {
+		m.dockerClient = docker.client
+	}
+	_, multi := runtime.(*multiRuntime)
+	dockerAPI := m.dockerClient != nil || multi
+	m.sources = append(m.sources, m.leases)
+
+	// Les agents de l'hôte n'ont pas de conteneur : leur sonde se prononce avant toutes les autres
+	if config.HostProcRoot != "" {
+		m.hostAgents = &hostAgentScanner{procRoot: config.HostProcRoot}
+		m.probes = append(m.probes, &hostProcessProbe{scanner: m.hostAgents})
+	}
+
+	// Un agent en pause n'exécute aucun job
+	m.probes = append(m.probes, &lifecycleProbe{containers: m.containers})
+
+	// Une session docker exec ouverte (orchestrateur externe) rend l'agent occupé
+	m.probes = append(m.probes, &execProbe{monitor: m})
+
+	// Un conteneur de job vivant rend son agent occupé, quelles que soient les autres sondes
+	jobProbe := newJobContainerProbe(m, config.JobOwnerLabel, config.JobContainerNetwork)
+	m.jobOwnerLabel = jobProbe.ownerLabel
+	m.probes = append(m.probes, jobProbe)
+
+	// Azure DevOps fait foi lorsqu'il est configuré, puis les logs ; les processus servent de repli
+	if config.AzureDevOps != nil {
+		m.probes = append(m.probes, newAzureDevOpsProbe(m, config.AzureDevOps, config.AzureDevOpsPool))
+	}
+	if config.JobLogPatterns != nil && !dockerAPI {
+		log.Printf("Warning: following agent logs requires the Docker API, not available with %s", runtime.Name())
+	} else if config.JobLogPatterns != nil {
+		m.logWatcher = newLogWatcher(m, config.JobLogPatterns)
+		m.probes = append(m.probes, m.logWatcher)
+		m.transitionSinks = append(m.transitionSinks, m.logWatcher)
+	}
+	m.probes = append(m.probes, newProcessProbe(m))
+	if config.Stats != nil && !dockerAPI {
+		log.Printf("Warning: the stats probe requires the Docker API, not available with %s", runtime.Name())
+	} else if config.Stats != nil {
+		m.probes = append(m.probes, newStatsProbe(m, *config.Stats))
+	}
+
+	return m
 }
 
 // isExcluded vérifie si un conteneur doit être exclu
@@ -69,7 +175,7 @@ func (m *Monitor) isExcluded(containerID, containerName, imageName string) bool
 	// Vérifier l'exclusion par nom ou ID de conteneur
 	for _, excluded := range m.excludeContainers {
 		if strings.Contains(containerName, excluded) || strings.Contains(containerID, excluded) {
-			log.Printf("Container %s (%s) excluded by container filter: %s", containerName, containerID[:12], excluded)
+			log.Printf("Container %s (%s) excluded by container filter: %s", containerName, shortID(containerID), excluded)
 			return true
 		}
 	}
@@ -77,7 +183,7 @@ func (m *Monitor) isExcluded(containerID, containerName, imageName string) bool
 	// Vérifier l'exclusion par image
 	for _, excluded := range m.excludeImages {
 		if strings.Contains(imageName, excluded) {
-			log.Printf("Container %s (%s) excluded by image filter: %s", containerName, containerID[:12], excluded)
+			log.Printf("Container %s (%s) excluded by image filter: %s", containerName, shortID(containerID), excluded)
 			return true
 		}
 	}
@@ -85,8 +191,21 @@ func (m *Monitor) isExcluded(containerID, containerName, imageName string) bool
 	return false
 }
 
+// shortID retourne la forme courte d'un identifiant de conteneur
+func shortID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
+
 // IsAzureAgentContainer vérifie si un conteneur est un agent Azure DevOps
 func (m *Monitor) IsAzureAgentContainer(containerInfo types.ContainerJSON) bool {
+	// Les conteneurs de job lancés par un agent ne sont pas des agents
+	if isJobContainer(containerInfo.Config.Labels, m.jobOwnerLabel) {
+		return false
+	}
+
 	// Vérifier l'image
 	imageName := strings.ToLower(containerInfo.Config.Image)
 	if strings.Contains(imageName, "azure") && strings.Contains(imageName, "agent") {
@@ -120,11 +239,25 @@ func (m *Monitor) IsAzureAgentContainer(containerInfo types.ContainerJSON) bool
 
 // GetRunningAzureAgents retourne la liste des agents Azure actuellement en cours d'exécution
 func (m *Monitor) GetRunningAzureAgents() ([]ActivityEvent, error) {
-	containers, err := m.dockerClient.ContainerList(m.ctx, container.ListOptions{})
+	containers, err := m.listContainers(m.ctx)
+	if err != nil {
+		return nil, err
+	}
+	return m.azureAgents(containers), nil
+}
+
+// listContainers liste les conteneurs en cours d'exécution
+func (m *Monitor) listContainers(ctx context.Context) ([]container.Summary, error) {
+	containers, err := m.runtime.List(ctx)
+	err = m.api.check(m.runtime.Endpoint(""), CapabilityList, err)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list containers: %w", err)
 	}
+	return containers, nil
+}
 
+// azureAgents retourne les agents Azure parmi les conteneurs listés, puis ceux lancés sur l'hôte
+func (m *Monitor) azureAgents(containers []container.Summary) []ActivityEvent {
 	var agents []ActivityEvent
 	for _, c := range containers {
 		name := strings.TrimPrefix(c.Names[0], "/")
@@ -134,25 +267,42 @@ func (m *Monitor) GetRunningAzureAgents() ([]ActivityEvent, error) {
 			continue
 		}
 
-		containerInfo, err := m.dockerClient.ContainerInspect(m.ctx, c.ID)
+		containerInfo, err := m.runtime.Inspect(m.ctx, c.ID)
+		err = m.api.check(m.runtime.Endpoint(c.ID), CapabilityInspect, err)
 		if err != nil {
 			log.Printf("Warning: failed to inspect container %s: %v", c.ID, err)
 			continue
 		}
 
 		if m.IsAzureAgentContainer(containerInfo) {
+			m.containers.observe(c.ID, name, c.Image, m.runtime.Endpoint(c.ID), c.State == container.StatePaused)
 			agents = append(agents, ActivityEvent{
-				ContainerID:   c.ID[:12],
+				ContainerID:   shortID(c.ID),
 				ContainerName: name,
 				ImageName:     c.Image,
 				Action:        "running",
 				Timestamp:     time.Now(),
 				IsAzureAgent:  true,
+				Job:           jobPointer(jobMetadataFromEnv(containerInfo.Config.Env, containerInfo.Config.Labels)),
+				Endpoint:      m.runtime.Endpoint(c.ID),
 			})
 		}
 	}
 
-	return agents, nil
+	// Agents lancés directement sur l'hôte, soumis aux mêmes règles d'exclusion
+	if m.hostAgents != nil {
+		hostAgents, err := m.hostAgents.agents()
+		if err != nil {
+			log.Printf("Warning: failed to scan host processes: %v", err)
+		}
+		for _, agent := range hostAgents {
+			if !m.isExcluded(agent.ContainerID, agent.ContainerName, agent.ImageName) {
+				agents = append(agents, agent)
+			}
+		}
+	}
+
+	return agents
 }
 
 // StartMonitoring démarre la surveillance des événements Docker
@@ -163,15 +313,19 @@ func (m *Monitor) StartMonitoring() error {
 		return fmt.Errorf("failed to get initial agents: %w", err)
 	}
 
-	log.Printf("Found %d Azure agent container(s) currently running", len(initialAgents))
+	log.Printf("Found %d Azure agent(s) currently running", len(initialAgents))
 	for _, agent := range initialAgents {
-		m.activityChan <- agent
+		if agent.HostPID == 0 {
+			m.discoverExecs(m.ctx, agent)
+		}
+		m.emitActivity(agent)
+	}
+	if m.logWatcher != nil {
+		m.logWatcher.followRunning(initialAgents)
 	}
 
 	// Écouter les événements Docker
-	eventsChan, errChan := m.dockerClient.Events(m.ctx, events.ListOptions{
-		Since: fmt.Sprintf("%d", time.Now().Add(-1*time.Minute).Unix()), // Éviter de manquer les événements récents
-	})
+	eventsChan, errChan := m.runtime.Events(m.ctx)
 
 	go func() {
 		for {
@@ -181,6 +335,7 @@ func (m *Monitor) StartMonitoring() error {
 				return
 
 			case err := <-errChan:
+				err = m.api.check(m.runtime.Endpoint(""), CapabilityEvents, err)
 				if err != nil && err != io.EOF {
 					log.Printf("Error receiving Docker events: %v", err)
 				}
@@ -201,56 +356,127 @@ func (m *Monitor) handleDockerEvent(event events.Message) {
 		return
 	}
 
-	// Événements intéressants pour détecter l'activité
-	interestingActions := map[string]bool{
-		"start":      true,
-		"die":        true,
-		"stop":       true,
-		"kill":       true,
-		"create":     true,
-		"exec_start": true,
-	}
-
-	if !interestingActions[string(event.Action)] {
+	// Docker suffixe certaines actions d'un complément ("exec_start: bash -c ...", "health_status: healthy")
+	action, detail := splitAction(event.Action)
+	if !lifecycleActions[action] {
 		return
 	}
 
+	name := event.Actor.Attributes["name"]
+	image := event.Actor.Attributes["image"]
+	endpoint := m.runtime.Endpoint(event.Actor.ID)
+	tracked, known := m.containers.get(event.Actor.ID)
+
 	// Inspecter le conteneur pour vérifier s'il s'agit d'un agent Azure
-	containerInfo, err := m.dockerClient.ContainerInspect(m.ctx, event.Actor.ID)
-	if err != nil {
-		// Le conteneur peut avoir été supprimé
-		if event.Action == "die" || event.Action == "stop" || event.Action == "kill" {
-			log.Printf("Container %s already removed", event.Actor.ID[:12])
+	var job JobMetadata
+	var config *container.Config
+	if action == events.ActionDestroy {
+		// Le conteneur n'existe plus : seul un agent déjà suivi est signalé
+		if !known {
 			return
 		}
-		log.Printf("Failed to inspect container %s: %v", event.Actor.ID[:12], err)
-		return
+	} else {
+		containerInfo, err := m.runtime.Inspect(m.ctx, event.Actor.ID)
+		err = m.api.check(endpoint, CapabilityInspect, err)
+		switch {
+		case err != nil && !known:
+			// Le conteneur peut avoir été supprimé
+			if action == events.ActionDie || action == events.ActionStop || action == events.ActionKill || action == events.ActionOOM {
+				log.Printf("Container %s already removed", shortID(event.Actor.ID))
+				return
+			}
+			log.Printf("Failed to inspect container %s: %v", shortID(event.Actor.ID), err)
+			return
+		case err == nil:
+			if !m.IsAzureAgentContainer(containerInfo) {
+				return
+			}
+			config = containerInfo.Config
+			job = jobMetadataFromEnv(config.Env, config.Labels)
+		}
+		// Agent suivi supprimé entre-temps (--rm) : son dernier état connu suffit
+	}
+	if name == "" {
+		name = tracked.Name
+	}
+	if image == "" {
+		image = tracked.Image
 	}
-
-	name := event.Actor.Attributes["name"]
-	image := event.Actor.Attributes["image"]
 
 	// Vérifier si le conteneur est exclu
 	if m.isExcluded(event.Actor.ID, name, image) {
 		return
 	}
-
-	isAzureAgent := m.IsAzureAgentContainer(containerInfo)
-	if !isAzureAgent {
-		return
-	}
+	m.containers.apply(event, action, detail, endpoint)
 
 	activityEvent := ActivityEvent{
-		ContainerID:   event.Actor.ID[:12],
+		ContainerID:   shortID(event.Actor.ID),
 		ContainerName: name,
 		ImageName:     image,
-		Action:        string(event.Action),
+		Action:        string(action),
 		Timestamp:     time.Unix(event.Time, 0),
 		IsAzureAgent:  true,
+		Endpoint:      endpoint,
+	}
+	switch action {
+	case events.ActionHealthStatus:
+		activityEvent.Detail = detail
+	case events.ActionRename:
+		activityEvent.Detail = strings.TrimPrefix(event.Actor.Attributes["oldName"], "/")
+	case events.ActionExecStart, events.ActionExecDie:
+		activityEvent.Detail = event.Actor.Attributes["execID"]
+	}
+
+	// Contexte du pipeline : environnement et labels du conteneur, puis de la session exec
+	if action == events.ActionExecStart || action == events.ActionExecDie {
+		var execJob JobMetadata
+		var healthcheck bool
+		activityEvent.Exec, execJob, healthcheck = m.handleExecEvent(event, action, detail, config)
+		if healthcheck {
+			// Le healthcheck exécuté par le démon n'est pas une activité de l'agent
+			return
+		}
+		job = job.Merge(execJob)
 	}
+	activityEvent.Job = jobPointer(job)
 
 	log.Printf("Azure Agent Activity: %s - %s [%s]", activityEvent.Action, activityEvent.ContainerName, activityEvent.ContainerID)
-	m.activityChan <- activityEvent
+	m.emitActivity(activityEvent)
+
+	// Signaler le démarrage, l'arrêt, les OOM et les redémarrages des agents aux récepteurs de transitions
+	state := AgentState{ActivityEvent: activityEvent}
+	switch action {
+	case events.ActionStart:
+		m.HandleTransition(agentTransition(TransitionAgentStarted, state, "container started", activityEvent.Timestamp))
+	case events.ActionDie:
+		reason := "container exited"
+		if code := event.Actor.Attributes["exitCode"]; code != "" {
+			reason += " with code " + code
+		}
+		m.HandleTransition(agentTransition(TransitionAgentStopped, state, reason, activityEvent.Timestamp))
+	case events.ActionOOM:
+		m.HandleTransition(agentTransition(TransitionAgentOOMKilled, state, "container killed by the OOM killer", activityEvent.Timestamp))
+	case events.ActionRestart:
+		m.HandleTransition(agentTransition(TransitionAgentRestarted, state, "container restarted", activityEvent.Timestamp))
+	}
+}
+
+// emitActivity publie un événement d'activité, sauf si le moniteur est arrêté
+func (m *Monitor) emitActivity(event ActivityEvent) {
+	m.activityMu.RLock()
+	defer m.activityMu.RUnlock()
+	if m.activityClosed {
+		return
+	}
+	select {
+	case m.activityChan <- event:
+	case <-m.ctx.Done():
+	}
+}
+
+// Leases retourne les baux d'activité du moniteur
+func (m *Monitor) Leases() *LeaseStore {
+	return m.leases
 }
 
 // GetActivityChannel retourne le canal des événements d'activité
@@ -258,13 +484,25 @@ func (m *Monitor) GetActivityChannel() <-chan ActivityEvent {
 	return m.activityChan
 }
 
-// HasActiveAgents vérifie s'il y a des agents Azure actifs
+// HasActiveAgents vérifie s'il y a des agents Azure actifs ou des maintiens d'activité
+// (baux, fichiers marqueurs...) en cours. Un agent présent compte, occupé ou non : les sondes
+// d'occupation (Azure DevOps, processus...) n'interviennent pas ici, seulement avec le warm pool.
 func (m *Monitor) HasActiveAgents() (bool, error) {
+	if len(m.ActivityHolds()) > 0 {
+		return true, nil
+	}
+
 	agents, err := m.GetRunningAzureAgents()
 	if err != nil {
 		return false, err
 	}
-	return len(agents) > 0, nil
+	for _, agent := range agents {
+		// Un agent dont le job a dépassé sa durée maximale (action release) ne protège plus l'instance
+		if m.overdue == nil || !m.overdue.released(agent.ContainerID) {
+			return true, nil
+		}
+	}
+	return false, nil
 }
 
 // Stop arrête le monitoring
@@ -272,8 +510,14 @@ func (m *Monitor) Stop() {
 	if m.cancel != nil {
 		m.cancel()
 	}
-	if m.dockerClient != nil {
-		m.dockerClient.Close()
+	if m.runtime != nil {
+		m.runtime.Close()
+	}
+
+	m.activityMu.Lock()
+	defer m.activityMu.Unlock()
+	if !m.activityClosed {
+		m.activityClosed = true
+		close(m.activityChan)
 	}
-	close(m.activityChan)
 }
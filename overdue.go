@@ -0,0 +1,296 @@
+package ecsazrlc
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OverdueAction est l'action appliquée à un agent occupé au-delà de la durée maximale de sa règle
+type OverdueAction string
+
+const (
+	OverdueActionAlert   OverdueAction = "alert"   // Émettre JobOverdue uniquement
+	OverdueActionRelease OverdueAction = "release" // Ne plus protéger l'instance pour cet agent
+	OverdueActionStop    OverdueAction = "stop"    // Arrêter le conteneur agent après la période d'avertissement
+)
+
+// DefaultOverdueWarning est le délai par défaut entre JobOverdue et l'arrêt du conteneur (action stop)
+const DefaultOverdueWarning = 10 * time.Minute
+
+// ParseOverdueAction valide le nom d'une action JobOverdue
+func ParseOverdueAction(value string) (OverdueAction, error) {
+	switch action := OverdueAction(value); action {
+	case OverdueActionAlert, OverdueActionRelease, OverdueActionStop:
+		return action, nil
+	default:
+		return "", fmt.Errorf("unknown overdue action %q (alert, release or stop)", value)
+	}
+}
+
+// OverdueRule fixe la durée d'occupation continue maximale des agents d'une image ou d'un pool
+type OverdueRule struct {
+	Image   string        // Partie du nom d'image (vide = toutes les images)
+	Pool    string        // Pool Azure DevOps de l'agent, AZP_POOL (vide = tous les pools)
+	MaxBusy time.Duration // Durée d'occupation continue au-delà de laquelle le job est en retard
+	Action  OverdueAction
+	Warning time.Duration // Délai entre JobOverdue et l'arrêt du conteneur (action stop)
+}
+
+// ParseOverdueRule lit une règle de la forme "[image=..,][pool=..,]max=4h[,action=stop][,warning=10m]"
+func ParseOverdueRule(value string) (OverdueRule, error) {
+	rule := OverdueRule{Action: OverdueActionAlert, Warning: DefaultOverdueWarning}
+	for _, option := range strings.Split(value, ",") {
+		key, val, _ := strings.Cut(strings.TrimSpace(option), "=")
+		var err error
+		switch key {
+		case "image":
+			rule.Image = val
+		case "pool":
+			rule.Pool = val
+		case "max":
+			rule.MaxBusy, err = time.ParseDuration(val)
+		case "action":
+			rule.Action, err = ParseOverdueAction(val)
+		case "warning":
+			rule.Warning, err = time.ParseDuration(val)
+		default:
+			return OverdueRule{}, fmt.Errorf("unknown overdue rule option %q", key)
+		}
+		if err != nil {
+			return OverdueRule{}, fmt.Errorf("invalid overdue rule option %q: %w", key, err)
+		}
+	}
+	if rule.MaxBusy <= 0 {
+		return OverdueRule{}, fmt.Errorf("overdue rule %q requires a positive max duration", value)
+	}
+	if rule.Warning < 0 {
+		return OverdueRule{}, fmt.Errorf("overdue rule %q has a negative warning period", value)
+	}
+	return rule, nil
+}
+
+// String décrit la règle pour les journaux
+func (r OverdueRule) String() string {
+	scope := "all agents"
+	switch {
+	case r.Image != "" && r.Pool != "":
+		scope = fmt.Sprintf("image %s in pool %s", r.Image, r.Pool)
+	case r.Image != "":
+		scope = "image " + r.Image
+	case r.Pool != "":
+		scope = "pool " + r.Pool
+	}
+	return fmt.Sprintf("%s: max %s, action %s", scope, r.MaxBusy, r.Action)
+}
+
+// stopsOverdueAgents indique si une règle arrête les agents en retard
+func stopsOverdueAgents(rules []OverdueRule) bool {
+	for _, rule := range rules {
+		if rule.Action == OverdueActionStop {
+			return true
+		}
+	}
+	return false
+}
+
+// overdueJob est le suivi d'un agent en retard, pour la période d'occupation en cours
+type overdueJob struct {
+	busySince time.Time
+	rule      OverdueRule
+	alerted   bool // JobOverdue émis
+	stopped   bool // Arrêt du conteneur demandé
+}
+
+// overduePolicy applique les règles JobOverdue aux relevés d'état des agents
+type overduePolicy struct {
+	rules       []OverdueRule
+	defaultPool string
+	mu          sync.Mutex
+	pools       map[string]string      // Pool de chaque conteneur agent (AZP_POOL), par ID
+	jobs        map[string]*overdueJob // Agents en retard par ID
+}
+
+// newOverduePolicy crée une politique à partir de règles ordonnées
+func newOverduePolicy(rules []OverdueRule, defaultPool string) *overduePolicy {
+	return &overduePolicy{
+		rules:       rules,
+		defaultPool: defaultPool,
+		pools:       map[string]string{},
+		jobs:        map[string]*overdueJob{},
+	}
+}
+
+// pool retourne le pool Azure DevOps d'un agent (vide pour un agent de l'hôte ou en cas d'erreur)
+func (p *overduePolicy) pool(m *Monitor, state AgentState) string {
+	if state.HostPID != 0 {
+		return ""
+	}
+	p.mu.Lock()
+	pool, ok := p.pools[state.ContainerID]
+	p.mu.Unlock()
+	if ok {
+		return pool
+	}
+
+	info, err := m.runtime.Inspect(m.ctx, state.ContainerID)
+	if err = m.api.check(m.runtime.Endpoint(state.ContainerID), CapabilityInspect, err); err != nil {
+		log.Printf("Warning: failed to inspect %s for overdue rules: %v", state.ContainerName, err)
+		return ""
+	}
+	pool = agentIdentity(info, p.defaultPool).PoolName
+
+	p.mu.Lock()
+	p.pools[state.ContainerID] = pool
+	p.mu.Unlock()
+	return pool
+}
+
+// match retourne la première règle s'appliquant à un agent
+func (p *overduePolicy) match(m *Monitor, state AgentState) (OverdueRule, bool) {
+	for _, rule := range p.rules {
+		if rule.Image != "" && !strings.Contains(state.ImageName, rule.Image) {
+			continue
+		}
+		if rule.Pool != "" && p.pool(m, state) != rule.Pool {
+			continue
+		}
+		return rule, true
+	}
+	return OverdueRule{}, false
+}
+
+// apply marque les agents en retard d'un relevé complet ; ceux dont la règle libère la protection
+// restent occupés mais sont marqués Released. Les agents redevenus inactifs ou disparus sont oubliés.
+func (p *overduePolicy) apply(m *Monitor, states []AgentState, now time.Time) {
+	current := map[string]bool{}
+	for i := range states {
+		state := &states[i]
+		current[state.ContainerID] = true
+		if !state.Busy {
+			p.forget(state.ContainerID)
+			continue
+		}
+		rule, ok := p.match(m, *state)
+		if !ok || state.JobDuration(now) < rule.MaxBusy {
+			continue
+		}
+
+		p.mu.Lock()
+		job, ok := p.jobs[state.ContainerID]
+		if !ok || !job.busySince.Equal(state.BusySince) {
+			job = &overdueJob{busySince: state.BusySince}
+			p.jobs[state.ContainerID] = job
+		}
+		job.rule = rule
+		p.mu.Unlock()
+
+		state.Overdue = true
+		if rule.Action == OverdueActionRelease {
+			state.Released = true
+			state.Reason = fmt.Sprintf("overdue: protection released after %s busy (%s)", rule.MaxBusy, state.Reason)
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for id := range p.pools {
+		if !current[id] {
+			delete(p.pools, id)
+		}
+	}
+	for id := range p.jobs {
+		if !current[id] {
+			delete(p.jobs, id)
+		}
+	}
+}
+
+// forget oublie le retard d'un agent redevenu inactif
+func (p *overduePolicy) forget(containerID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.jobs, containerID)
+}
+
+// released indique si la protection apportée par un agent a été libérée
+func (p *overduePolicy) released(containerID string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	job, ok := p.jobs[containerID]
+	return ok && job.rule.Action == OverdueActionRelease
+}
+
+// enforce émet JobOverdue une fois par période d'occupation et arrête les conteneurs
+// dont la période d'avertissement est écoulée
+func (p *overduePolicy) enforce(m *Monitor, states []AgentState, now time.Time) {
+	for _, state := range states {
+		if !state.Overdue {
+			continue
+		}
+		p.mu.Lock()
+		job, ok := p.jobs[state.ContainerID]
+		if !ok {
+			p.mu.Unlock()
+			continue
+		}
+		rule := job.rule
+		alert := !job.alerted
+		job.alerted = true
+		stopAt := job.busySince.Add(rule.MaxBusy + rule.Warning)
+		stop := rule.Action == OverdueActionStop && !job.stopped && !now.Before(stopAt)
+		if stop {
+			job.stopped = true
+		}
+		p.mu.Unlock()
+
+		if alert {
+			reason := fmt.Sprintf("busy for %s (max %s), action: %s", state.JobDuration(now).Truncate(time.Second), rule.MaxBusy, rule.Action)
+			if rule.Action == OverdueActionStop {
+				reason += fmt.Sprintf(" at %s", stopAt.Format(time.RFC3339))
+			}
+			m.HandleTransition(agentTransition(TransitionJobOverdue, state, reason, now))
+		}
+		if stop {
+			if err := m.stopAgent(state, 30*time.Second); err != nil {
+				log.Printf("Error stopping overdue agent %s: %v", state.ContainerName, err)
+				continue
+			}
+			log.Printf("Overdue agent %s stopped after %s busy", state.ContainerName, state.JobDuration(now).Truncate(time.Second))
+		}
+	}
+}
+
+// WatchOverdueJobs relève périodiquement l'état des agents et applique les règles JobOverdue.
+// S'arrête avec le moniteur.
+func (m *Monitor) WatchOverdueJobs(interval time.Duration) {
+	if m.overdue == nil {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for _, rule := range m.overdue.rules {
+		log.Printf("Overdue job rule: %s", rule)
+	}
+	check := func() {
+		states, err := m.GetAgentStates()
+		if err != nil {
+			log.Printf("Error checking agent states for overdue jobs: %v", err)
+			return
+		}
+		m.overdue.enforce(m, states, time.Now())
+	}
+
+	check()
+	for {
+		select {
+		case <-ticker.C:
+			check()
+		case <-m.ctx.Done():
+			return
+		}
+	}
+}
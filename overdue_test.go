@@ -0,0 +1,169 @@
+package ecsazrlc
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestParseOverdueRule vérifie la lecture des règles JobOverdue
+func TestParseOverdueRule(t *testing.T) {
+	rule, err := ParseOverdueRule("image=azp-agent,pool=Linux,max=4h,action=stop,warning=5m")
+	if err != nil {
+		t.Fatalf("ParseOverdueRule() error: %v", err)
+	}
+	expected := OverdueRule{Image: "azp-agent", Pool: "Linux", MaxBusy: 4 * time.Hour, Action: OverdueActionStop, Warning: 5 * time.Minute}
+	if rule != expected {
+		t.Errorf("Expected %+v, got %+v", expected, rule)
+	}
+
+	rule, err = ParseOverdueRule("max=90m")
+	if err != nil || rule.Action != OverdueActionAlert || rule.Warning != DefaultOverdueWarning {
+		t.Errorf("Unexpected defaults: %+v (%v)", rule, err)
+	}
+
+	for _, value := range []string{"image=azp", "max=0s", "max=1h,action=kill", "max=1h,color=red", "max=soon", "max=1h,warning=-1m"} {
+		if _, err := ParseOverdueRule(value); err == nil {
+			t.Errorf("ParseOverdueRule(%q) should fail", value)
+		}
+	}
+}
+
+// TestOverduePolicy vérifie les actions release et stop des règles JobOverdue
+func TestOverduePolicy(t *testing.T) {
+	linux := &fakeContainer{ID: "aaaaaaaaaaaa0001", Name: "agent-linux", Image: "azp-agent", Env: []string{"AZP_POOL=Linux"}, Processes: []string{"Agent.Listener", "Agent.Worker"}}
+	windows := &fakeContainer{ID: "bbbbbbbbbbbb0002", Name: "agent-windows", Image: "azp-agent", Env: []string{"AZP_POOL=Windows"}, Processes: []string{"Agent.Listener", "Agent.Worker"}}
+	fake := newFakeDocker(t, linux, windows)
+	var mu sync.Mutex
+	var stopped []string
+	fake.route("POST /containers/", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		stopped = append(stopped, r.URL.Path)
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	})
+	monitor := fake.monitor(t, MonitorConfig{OverdueRules: []OverdueRule{
+		{Pool: "Linux", MaxBusy: time.Hour, Action: OverdueActionRelease},
+		{Image: "azp", MaxBusy: 2 * time.Hour, Action: OverdueActionStop, Warning: 10 * time.Minute},
+	}})
+	sink := &recordingSink{}
+	monitor.AddTransitionSink(sink)
+
+	// Deux agents occupés depuis 90 minutes
+	now := time.Now()
+	monitor.jobs.busySince = map[string]time.Time{"aaaaaaaaaaaa": now.Add(-90 * time.Minute), "bbbbbbbbbbbb": now.Add(-90 * time.Minute)}
+	states, err := monitor.GetAgentStates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName := func(states []AgentState) map[string]AgentState {
+		indexed := map[string]AgentState{}
+		for _, state := range states {
+			indexed[state.ContainerName] = state
+		}
+		return indexed
+	}
+	agents := byName(states)
+	if state := agents["agent-linux"]; !state.Overdue || !state.Busy || !state.Released || !strings.HasPrefix(state.Reason, "overdue: protection released after 1h0m0s busy") {
+		t.Errorf("Linux agent should be overdue and released, got %+v", state)
+	}
+	if state := agents["agent-windows"]; state.Overdue || !state.Busy || state.JobDuration(time.Now()) < 90*time.Minute {
+		t.Errorf("Windows agent should be busy for 90 minutes, got %+v", state)
+	}
+	if active, _ := monitor.HasActiveAgents(); !active {
+		t.Error("The Windows agent should still protect the instance")
+	}
+
+	// JobOverdue n'est émis qu'une fois par période d'occupation
+	monitor.overdue.enforce(monitor, states, now)
+	monitor.overdue.enforce(monitor, states, now)
+	if types := sink.types(); len(types) != 1 || types[0] != TransitionJobOverdue {
+		t.Fatalf("Expected one JobOverdue transition, got %v", types)
+	}
+	if reason := sink.transitions[0].Reason; !strings.Contains(reason, "(max 1h0m0s), action: release") {
+		t.Errorf("Unexpected JobOverdue reason: %q", reason)
+	}
+
+	// Le Windows agent dépasse 2h : averti, puis arrêté à la fin de la période d'avertissement
+	monitor.jobs.busySince["bbbbbbbbbbbb"] = now.Add(-2*time.Hour - time.Minute)
+	states, _ = monitor.GetAgentStates()
+	monitor.overdue.enforce(monitor, states, now)
+	if len(sink.types()) != 2 || !strings.Contains(sink.transitions[1].Reason, "action: stop at ") {
+		t.Errorf("Expected a JobOverdue warning before stopping, got %+v", sink.transitions)
+	}
+	mu.Lock()
+	if len(stopped) != 0 {
+		t.Errorf("Agent should not be stopped during the warning period, got %v", stopped)
+	}
+	mu.Unlock()
+	monitor.overdue.enforce(monitor, states, now.Add(10*time.Minute))
+	mu.Lock()
+	if len(stopped) != 1 || !strings.Contains(stopped[0], "/containers/bbbbbbbbbbbb/stop") {
+		t.Errorf("Expected the Windows agent to be stopped, got %v", stopped)
+	}
+	mu.Unlock()
+	if active, _ := monitor.HasActiveAgents(); !active {
+		t.Error("A stopping overdue agent still protects the instance until it exits")
+	}
+
+	// Un agent redevenu inactif n'est plus en retard
+	fake.mu.Lock()
+	linux.Processes = []string{"Agent.Listener"}
+	fake.mu.Unlock()
+	agents = byName(mustAgentStates(t, monitor))
+	if state := agents["agent-linux"]; state.Overdue || state.Released || state.Busy || !state.BusySince.IsZero() {
+		t.Errorf("Idle agent should no longer be overdue, got %+v", state)
+	}
+	if monitor.overdue.released("aaaaaaaaaaaa") {
+		t.Error("Protection release should end with the job")
+	}
+}
+
+// mustAgentStates retourne l'état des agents ou arrête le test
+func mustAgentStates(t *testing.T, monitor *Monitor) []AgentState {
+	t.Helper()
+	states, err := monitor.GetAgentStates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return states
+}
+
+// TestReleasedAgentsDoNotProtect vérifie qu'une instance dont tous les agents sont libérés n'est plus active
+func TestReleasedAgentsDoNotProtect(t *testing.T) {
+	fake := newFakeDocker(t, &fakeContainer{ID: "aaaaaaaaaaaa0001", Name: "agent", Image: "azp-agent", Processes: []string{"Agent.Worker"}})
+	monitor := fake.monitor(t, MonitorConfig{OverdueRules: []OverdueRule{{MaxBusy: time.Hour, Action: OverdueActionRelease}}})
+
+	monitor.jobs.busySince = map[string]time.Time{"aaaaaaaaaaaa": time.Now().Add(-2 * time.Hour)}
+	mustAgentStates(t, monitor)
+	if active, _ := monitor.HasActiveAgents(); active {
+		t.Error("An instance whose only agent was released should not be active")
+	}
+}
+
+// TestReleasedAgentStillBusy vérifie qu'un agent libéré reste occupé pour le drain et les transitions
+func TestReleasedAgentStillBusy(t *testing.T) {
+	f := newDrainFixture(t)
+	monitor := f.docker.monitor(t, MonitorConfig{OverdueRules: []OverdueRule{{MaxBusy: time.Hour, Action: OverdueActionRelease}}})
+	monitor.jobs.busySince = map[string]time.Time{"aaaaaaaaaaaa": time.Now().Add(-2 * time.Hour)}
+
+	states := mustAgentStates(t, monitor)
+	tracker := newTransitionTracker(0)
+	tracker.update([]AgentState{agentState("aaaaaaaaaaaa", true)}, time.Now())
+	for _, transition := range tracker.update(states, time.Now()) {
+		if transition.Type == TransitionAgentIdle && transition.ContainerID == "aaaaaaaaaaaa" {
+			t.Errorf("A released agent should not be reported idle: %+v", transition)
+		}
+	}
+
+	watcher := NewDrainWatcher(f.notifier, monitor, DrainWatcherConfig{Interval: time.Hour, Action: DrainActionStopAfterJob})
+	watcher.progress()
+	if stopped := f.stoppedContainers(); len(stopped) != 1 || !strings.HasPrefix("bbbbbbbbbbbb0002", stopped[0]) {
+		t.Errorf("Only the idle agent should be stopped, not the released one, got %v", stopped)
+	}
+	if busy := f.lastAttributes(t)[attrDrainBusy]; busy != "1" {
+		t.Errorf("The drain should still wait for the released agent, got %s busy", busy)
+	}
+}
@@ -0,0 +1,142 @@
+package ecsazrlc
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/client"
+)
+
+// Runtimes de conteneurs pris en charge
+const (
+	RuntimeAuto   = "auto"   // Docker si son socket existe, sinon Podman ; détection via /version
+	RuntimeDocker = "docker" // API Docker (DOCKER_HOST ou socket par défaut)
+	RuntimePodman = "podman" // API compatible de Podman, socket détecté automatiquement
+)
+
+// Socket Docker par défaut
+const dockerSocketPath = "/var/run/docker.sock"
+
+// Socket Podman du service système (rootful)
+const podmanRootSocketPath = "/run/podman/podman.sock"
+
+// podmanSocketPaths retourne les sockets Podman candidats, le socket rootless en premier
+func podmanSocketPaths() []string {
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	if runtimeDir == "" {
+		runtimeDir = filepath.Join("/run/user", strconv.Itoa(os.Getuid()))
+	}
+	return []string{filepath.Join(runtimeDir, "podman", "podman.sock"), podmanRootSocketPath}
+}
+
+// DetectPodmanSocket retourne l'adresse unix:// du premier socket Podman existant
+func DetectPodmanSocket() (string, bool) {
+	for _, path := range podmanSocketPaths() {
+		if _, err := os.Stat(path); err == nil {
+			return "unix://" + path, true
+		}
+	}
+	return "", false
+}
+
+// newRuntimeClient crée le client de l'API du runtime et indique s'il s'agit de Podman
+func newRuntimeClient(ctx context.Context, runtime string) (*client.Client, bool, error) {
+	opts := []client.Opt{client.FromEnv, client.WithAPIVersionNegotiation()}
+
+	// DOCKER_HOST, s'il est défini, désigne toujours le socket à utiliser
+	explicitHost := os.Getenv("DOCKER_HOST") != ""
+	switch runtime {
+	case RuntimePodman:
+		if !explicitHost {
+			host, ok := DetectPodmanSocket()
+			if !ok {
+				return nil, false, fmt.Errorf("no Podman socket found (tried %s)", strings.Join(podmanSocketPaths(), ", "))
+			}
+			opts = append(opts, client.WithHost(host))
+		}
+	case "", RuntimeAuto:
+		if _, err := os.Stat(dockerSocketPath); !explicitHost && err != nil {
+			if host, ok := DetectPodmanSocket(); ok {
+				opts = append(opts, client.WithHost(host))
+			}
+		}
+	case RuntimeDocker:
+	default:
+		return nil, false, fmt.Errorf("unknown container runtime %q (expected %s, %s or %s)", runtime, RuntimeAuto, RuntimeDocker, RuntimePodman)
+	}
+
+	cli, err := client.NewClientWithOpts(opts...)
+	if err != nil {
+		return nil, false, err
+	}
+
+	podman := runtime == RuntimePodman || (runtime != RuntimeDocker && isPodmanServer(ctx, cli))
+	if podman {
+		log.Printf("Using Podman API at %s", cli.DaemonHost())
+	}
+	return cli, podman, nil
+}
+
+// isPodmanServer indique si le démon derrière le client est Podman (composant "Podman Engine")
+func isPodmanServer(ctx context.Context, cli *client.Client) bool {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	version, err := cli.ServerVersion(ctx)
+	if err != nil {
+		// Démon injoignable : l'erreur sera remontée par les premiers appels du moniteur
+		return false
+	}
+	for _, component := range version.Components {
+		if strings.Contains(component.Name, "Podman") {
+			return true
+		}
+	}
+	return false
+}
+
+// Statuts libpod et leurs équivalents Docker
+var podmanActions = map[string]events.Action{
+	"died":      events.ActionDie,
+	"exec":      events.ActionExecStart,
+	"exec_died": events.ActionExecDie,
+	"remove":    events.ActionDestroy,
+}
+
+// normalizePodmanEvent ramène un événement Podman (API compatible ou libpod) au format Docker
+func normalizePodmanEvent(event events.Message) events.Message {
+	// Podman renseigne parfois seulement les champs historiques (status, id, from)
+	if event.Action == "" {
+		event.Action = events.Action(event.Status)
+	}
+	if event.Actor.ID == "" {
+		event.Actor.ID = event.ID
+	}
+	if event.Time == 0 && event.TimeNano != 0 {
+		event.Time = event.TimeNano / int64(time.Second)
+	}
+	if event.Type == "" && event.Actor.ID != "" {
+		event.Type = events.ContainerEventType
+	}
+
+	attributes := make(map[string]string, len(event.Actor.Attributes)+1)
+	for key, value := range event.Actor.Attributes {
+		attributes[key] = value
+	}
+	if attributes["image"] == "" && event.From != "" {
+		attributes["image"] = event.From
+	}
+	event.Actor.Attributes = attributes
+
+	if action, ok := podmanActions[string(event.Action)]; ok {
+		event.Action = action
+	}
+	return event
+}
@@ -0,0 +1,145 @@
+package ecsazrlc
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+)
+
+// Conteneur agent des événements enregistrés dans testdata/podman
+const podmanAgentID = "3f7a9c2e1b4d5a6f8e9d0c1b2a3f4e5d6c7b8a9f0e1d2c3b4a5f6e7d8c9b0a1f"
+
+// loadPodmanEvents lit les événements Podman enregistrés
+func loadPodmanEvents(t *testing.T) []events.Message {
+	t.Helper()
+	file, err := os.Open(filepath.Join("testdata", "podman", "events.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var messages []events.Message
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var message events.Message
+		if err := json.Unmarshal(scanner.Bytes(), &message); err != nil {
+			t.Fatalf("Invalid recorded event %q: %v", scanner.Text(), err)
+		}
+		messages = append(messages, message)
+	}
+	return messages
+}
+
+// TestNormalizePodmanEvent vérifie la conversion des statuts libpod et des champs historiques
+func TestNormalizePodmanEvent(t *testing.T) {
+	messages := loadPodmanEvents(t)
+
+	died := normalizePodmanEvent(messages[4])
+	if died.Action != events.ActionDie {
+		t.Errorf("died should become die, got %q", died.Action)
+	}
+	if exec := normalizePodmanEvent(messages[2]); exec.Action != events.ActionExecStart {
+		t.Errorf("exec should become exec_start, got %q", exec.Action)
+	}
+
+	// Événement ne portant que les champs historiques
+	legacy := normalizePodmanEvent(messages[7])
+	if legacy.Type != events.ContainerEventType || legacy.Action != events.ActionStart || legacy.Actor.ID != podmanAgentID {
+		t.Errorf("Unexpected normalized legacy event: %+v", legacy)
+	}
+	if legacy.Actor.Attributes["image"] != "docker.io/library/azp-agent:latest" || legacy.Time != 1760000050 {
+		t.Errorf("Image and time should come from legacy fields: %+v", legacy)
+	}
+	if messages[7].Actor.Attributes["image"] != "" {
+		t.Error("Normalization must not modify the original attributes")
+	}
+}
+
+// TestPodmanEvents vérifie le traitement des événements Podman enregistrés par le moniteur
+func TestPodmanEvents(t *testing.T) {
+	fake := newFakeDocker(t, &fakeContainer{ID: podmanAgentID, Name: "azp-agent-1", Image: "docker.io/library/azp-agent:latest"})
+	fake.route("GET /events", func(w http.ResponseWriter, r *http.Request) {
+		data, _ := os.ReadFile(filepath.Join("testdata", "podman", "events.jsonl"))
+		w.Write(data)
+		// Flux maintenu ouvert comme celui du démon
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	monitor := newMonitor(ctx, cancel, newDockerRuntime(fake.client(t), true), MonitorConfig{})
+
+	if err := monitor.StartMonitoring(); err != nil {
+		t.Fatalf("StartMonitoring() error: %v", err)
+	}
+
+	var actions []string
+	for len(actions) < 7 {
+		select {
+		case event := <-monitor.GetActivityChannel():
+			if event.ContainerID != podmanAgentID[:12] || event.ContainerName != "azp-agent-1" {
+				t.Errorf("Unexpected container in %+v", event)
+			}
+			actions = append(actions, event.Action)
+		case <-time.After(time.Second):
+			t.Fatalf("Expected 7 activity events, got %v", actions)
+		}
+	}
+
+	// Événement initial du conteneur en cours, puis les événements enregistrés
+	expected := []string{"running", "create", "start", "exec_start", "exec_die", "die", "start"}
+	for i := range expected {
+		if actions[i] != expected[i] {
+			t.Fatalf("Expected actions %v, got %v", expected, actions)
+		}
+	}
+	select {
+	case event := <-monitor.GetActivityChannel():
+		t.Errorf("Unexpected extra event: %+v", event)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// TestDetectPodmanSocket vérifie la découverte du socket rootless
+func TestDetectPodmanSocket(t *testing.T) {
+	runtimeDir := t.TempDir()
+	t.Setenv("XDG_RUNTIME_DIR", runtimeDir)
+
+	if host, ok := DetectPodmanSocket(); ok && host != "unix://"+podmanRootSocketPath {
+		t.Fatalf("No rootless socket yet, got %s", host)
+	}
+
+	socket := filepath.Join(runtimeDir, "podman", "podman.sock")
+	os.MkdirAll(filepath.Dir(socket), 0o700)
+	os.WriteFile(socket, nil, 0o600)
+
+	host, ok := DetectPodmanSocket()
+	if !ok || host != "unix://"+socket {
+		t.Errorf("Expected the rootless socket, got %q (%v)", host, ok)
+	}
+}
+
+// TestIsPodmanServer vérifie la reconnaissance de Podman via /version
+func TestIsPodmanServer(t *testing.T) {
+	fake := newFakeDocker(t)
+	if isPodmanServer(t.Context(), fake.client(t)) {
+		t.Error("A server without version information should not be detected as Podman")
+	}
+
+	fake.route("GET /version", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(types.Version{
+			Components: []types.ComponentVersion{{Name: "Podman Engine", Version: "5.2.2"}},
+		})
+	})
+	if !isPodmanServer(t.Context(), fake.client(t)) {
+		t.Error("Podman Engine component should be detected")
+	}
+}
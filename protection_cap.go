@@ -0,0 +1,76 @@
+package ecsazrlc
+
+import (
+	"sync"
+	"time"
+)
+
+// Attribut ECS publié lorsque la protection de l'instance est plafonnée
+const attrProtectionCapped = "azure-agent-protection-capped"
+
+// protectionCap borne la durée pendant laquelle une instance est signalée active sans interruption,
+// pour qu'une heuristique défaillante ne la maintienne pas en vie indéfiniment
+type protectionCap struct {
+	mu          sync.Mutex
+	max         time.Duration // 0 = pas de plafond
+	activeSince time.Time     // Début de la période d'activité continue (zéro si inactive)
+	cappedAt    time.Time     // Plafond atteint (zéro sinon)
+	published   bool          // Attribut azure-agent-protection-capped présent sur l'instance
+}
+
+// observe enregistre l'activité détectée et retourne l'activité à signaler ;
+// changed indique que le plafond vient d'être atteint ou levé (retour à l'inactivité)
+func (c *protectionCap) observe(active bool, now time.Time) (assert bool, changed bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !active {
+		changed = !c.cappedAt.IsZero()
+		c.activeSince = time.Time{}
+		c.cappedAt = time.Time{}
+		return false, changed
+	}
+	if c.activeSince.IsZero() {
+		c.activeSince = now
+	}
+	if c.max > 0 && c.cappedAt.IsZero() && now.Sub(c.activeSince) >= c.max {
+		c.cappedAt = now
+		changed = true
+	}
+	return c.cappedAt.IsZero(), changed
+}
+
+// capped retourne l'instant où le plafond a été atteint (zéro s'il ne l'est pas)
+func (c *protectionCap) capped() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.cappedAt
+}
+
+// setMax définit la durée maximale d'activité continue (0 pour désactiver)
+func (c *protectionCap) setMax(max time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.max = max
+}
+
+// maxDuration retourne la durée maximale d'activité continue
+func (c *protectionCap) maxDuration() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.max
+}
+
+// attributePublished indique si l'attribut du plafond est présent sur l'instance
+func (c *protectionCap) attributePublished() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.published
+}
+
+// setAttributePublished enregistre la publication ou le retrait de l'attribut du plafond
+func (c *protectionCap) setAttributePublished(published bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.published = published
+}
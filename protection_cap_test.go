@@ -0,0 +1,135 @@
+package ecsazrlc
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestProtectionCap vérifie le plafonnement de la durée d'activité continue
+func TestProtectionCap(t *testing.T) {
+	start := time.Unix(1_700_000_000, 0)
+	c := protectionCap{max: 12 * time.Hour}
+
+	if assert, changed := c.observe(true, start); !assert || changed {
+		t.Errorf("Activity should be asserted below the cap, got %v/%v", assert, changed)
+	}
+	if assert, changed := c.observe(true, start.Add(12*time.Hour)); assert || !changed {
+		t.Errorf("Activity should be capped after 12h, got %v/%v", assert, changed)
+	}
+	if assert, changed := c.observe(true, start.Add(13*time.Hour)); assert || changed {
+		t.Errorf("Activity should stay capped, got %v/%v", assert, changed)
+	}
+	if capped := c.capped(); !capped.Equal(start.Add(12 * time.Hour)) {
+		t.Errorf("Unexpected cap time: %v", capped)
+	}
+
+	// Le retour à l'inactivité lève le plafond et relance le décompte
+	if assert, changed := c.observe(false, start.Add(14*time.Hour)); assert || !changed {
+		t.Errorf("Inactivity should lift the cap, got %v/%v", assert, changed)
+	}
+	if assert, _ := c.observe(true, start.Add(15*time.Hour)); !assert {
+		t.Error("A new activity period should be asserted")
+	}
+
+	unlimited := protectionCap{}
+	unlimited.observe(true, start)
+	if assert, _ := unlimited.observe(true, start.Add(30*24*time.Hour)); !assert {
+		t.Error("Without cap, activity should always be asserted")
+	}
+}
+
+// attributeValues retourne les attributs d'un appel PutAttributes par nom
+func attributeValues(call ecsCall) map[string]string {
+	values := map[string]string{}
+	for _, raw := range call.Body["attributes"].([]interface{}) {
+		attr := raw.(map[string]interface{})
+		value, _ := attr["value"].(string)
+		values[attr["name"].(string)] = value
+	}
+	return values
+}
+
+// TestSendActivitySignalCapped vérifie que le notificateur cesse de protéger l'instance après le plafond
+func TestSendActivitySignalCapped(t *testing.T) {
+	fake := newFakeECS(t)
+	sink := &recordingSink{}
+	notifier := newTestNotifier(t, fake)
+	notifier.SetTransitionSink(sink)
+	notifier.SetMaxProtection(12 * time.Hour)
+
+	if err := notifier.SendActivitySignal(true); err != nil {
+		t.Fatal(err)
+	}
+	notifier.protection.activeSince = time.Now().Add(-13 * time.Hour)
+	if err := notifier.SendActivitySignal(true); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := fake.callsTo("PutAttributes")
+	if len(calls) != 2 {
+		t.Fatalf("Expected 2 PutAttributes calls, got %d", len(calls))
+	}
+	if values := attributeValues(calls[0]); values[attrActivity] != "active" || values[attrProtectionCapped] != "" {
+		t.Errorf("Unexpected attributes before the cap: %v", values)
+	}
+	if values := attributeValues(calls[1]); values[attrActivity] != "inactive" || values[attrProtectionCapped] == "" {
+		t.Errorf("Unexpected attributes after the cap: %v", values)
+	}
+	if types := sink.types(); len(types) != 1 || types[0] != TransitionProtectionCapped {
+		t.Errorf("Expected a ProtectionCapped transition, got %v", types)
+	}
+	if !notifier.ProtectionCapped() {
+		t.Error("Protection should be reported capped")
+	}
+	// Le plafond n'empêche pas d'annuler un drain : l'instance repasse en ACTIVE
+	if err := notifier.CancelDrain(context.Background()); err != nil {
+		t.Errorf("CancelDrain() should restore ACTIVE while capped, got %v", err)
+	}
+	if calls := fake.callsTo("UpdateContainerInstancesState"); len(calls) != 1 || calls[0].Body["status"] != "ACTIVE" {
+		t.Errorf("Expected the instance to be set back to ACTIVE, got %+v", calls)
+	}
+
+	// L'instance redevenue inactive retire l'attribut
+	if err := notifier.SendActivitySignal(false); err != nil {
+		t.Fatal(err)
+	}
+	deletes := fake.callsTo("DeleteAttributes")
+	if len(deletes) != 1 {
+		t.Fatalf("Expected 1 DeleteAttributes call, got %d", len(deletes))
+	}
+	if _, ok := attributeValues(deletes[0])[attrProtectionCapped]; !ok {
+		t.Errorf("Expected the %s attribute to be deleted, got %+v", attrProtectionCapped, deletes)
+	}
+	if notifier.ProtectionCapped() {
+		t.Error("Protection cap should be lifted once idle")
+	}
+}
+
+// TestProtectionCappedDeleteRetried vérifie que l'attribut du plafond est retiré au signal suivant après un échec
+func TestProtectionCappedDeleteRetried(t *testing.T) {
+	fake := newFakeECS(t)
+	notifier := newTestNotifier(t, fake)
+	notifier.SetMaxProtection(time.Hour)
+	notifier.protection.activeSince = time.Now().Add(-2 * time.Hour)
+	if err := notifier.SendActivitySignal(true); err != nil {
+		t.Fatal(err)
+	}
+
+	fake.handle("DeleteAttributes", func(body map[string]interface{}) interface{} {
+		return ecsError{Type: "ClientException", Message: "temporary failure"}
+	})
+	if err := notifier.SendActivitySignal(false); err == nil {
+		t.Fatal("Expected the failed DeleteAttributes call to be reported")
+	}
+
+	fake.handle("DeleteAttributes", nil)
+	for range 2 {
+		if err := notifier.SendActivitySignal(false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if deletes := fake.callsTo("DeleteAttributes"); len(deletes) != 2 {
+		t.Errorf("Expected the deletion to be retried once and then stop, got %d DeleteAttributes calls", len(deletes))
+	}
+}
@@ -0,0 +1,151 @@
+package ecsazrlc
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/client"
+)
+
+// ContainerRuntime abstrait le runtime de conteneurs interrogé par le moniteur.
+// Les types de l'API Docker servent de format commun à tous les runtimes.
+type ContainerRuntime interface {
+	Name() string
+	// List retourne les conteneurs en cours d'exécution
+	List(ctx context.Context) ([]container.Summary, error)
+	Inspect(ctx context.Context, containerID string) (container.InspectResponse, error)
+	// Events retourne le flux d'événements des conteneurs ; il s'arrête après une erreur
+	Events(ctx context.Context) (<-chan events.Message, <-chan error)
+	// Top retourne les processus d'un conteneur
+	Top(ctx context.Context, containerID string) (container.TopResponse, error)
+	// Endpoint retourne le nom de l'endpoint hébergeant le conteneur
+	Endpoint(containerID string) string
+	Close() error
+}
+
+// dockerRuntime est le runtime Docker (ou l'API compatible de Podman)
+type dockerRuntime struct {
+	client   *client.Client
+	name     string
+	endpoint string // Nom de l'endpoint (adresse du démon par défaut)
+	podman   bool   // Événements Podman à normaliser
+}
+
+// newDockerRuntime crée un runtime autour d'un client de l'API Docker
+func newDockerRuntime(cli *client.Client, podman bool) *dockerRuntime {
+	name := RuntimeDocker
+	if podman {
+		name = RuntimePodman
+	}
+	return &dockerRuntime{client: cli, name: name, endpoint: cli.DaemonHost(), podman: podman}
+}
+
+// Name retourne le nom du runtime
+func (r *dockerRuntime) Name() string {
+	return r.name
+}
+
+// List retourne les conteneurs en cours d'exécution
+func (r *dockerRuntime) List(ctx context.Context) ([]container.Summary, error) {
+	return r.client.ContainerList(ctx, container.ListOptions{})
+}
+
+// Inspect retourne le détail d'un conteneur
+func (r *dockerRuntime) Inspect(ctx context.Context, containerID string) (container.InspectResponse, error) {
+	return r.client.ContainerInspect(ctx, containerID)
+}
+
+// Events retourne le flux d'événements du démon, ramenés au format Docker pour Podman
+func (r *dockerRuntime) Events(ctx context.Context) (<-chan events.Message, <-chan error) {
+	messages, errs := r.client.Events(ctx, events.ListOptions{
+		Since: fmt.Sprintf("%d", time.Now().Add(-1*time.Minute).Unix()), // Éviter de manquer les événements récents
+	})
+	if !r.podman {
+		return messages, errs
+	}
+
+	normalized := make(chan events.Message)
+	go func() {
+		for {
+			select {
+			case message := <-messages:
+				select {
+				case normalized <- normalizePodmanEvent(message):
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return normalized, errs
+}
+
+// Top retourne les processus d'un conteneur
+func (r *dockerRuntime) Top(ctx context.Context, containerID string) (container.TopResponse, error) {
+	return r.client.ContainerTop(ctx, containerID, nil)
+}
+
+// Endpoint retourne le nom de l'endpoint du démon
+func (r *dockerRuntime) Endpoint(containerID string) string {
+	return r.endpoint
+}
+
+// Close ferme la connexion au démon
+func (r *dockerRuntime) Close() error {
+	return r.client.Close()
+}
+
+// dockerClientFor retourne le client Docker du démon hébergeant le conteneur (nil hors API Docker)
+func (m *Monitor) dockerClientFor(containerID string) *client.Client {
+	if m.dockerClient != nil {
+		return m.dockerClient
+	}
+	if multi, ok := m.runtime.(*multiRuntime); ok {
+		if endpoint := multi.owner(containerID); endpoint != nil {
+			return endpoint.client
+		}
+	}
+	return nil
+}
+
+// newContainerRuntime sélectionne le runtime selon la configuration et les sockets présents
+func newContainerRuntime(ctx context.Context, config MonitorConfig) (ContainerRuntime, error) {
+	if len(config.Endpoints) > 0 {
+		return newMultiRuntime(ctx, config.Endpoints)
+	}
+	if config.Runtime == RuntimeContainerd || (isAutoRuntime(config.Runtime) && useContainerd(config)) {
+		return newContainerdRuntime(config.ContainerdAddress, config.ContainerdNamespace, procRootPath(config.HostProcRoot))
+	}
+
+	cli, podman, err := newRuntimeClient(ctx, config.Runtime)
+	if err != nil {
+		return nil, err
+	}
+	return newDockerRuntime(cli, podman), nil
+}
+
+// isAutoRuntime indique si le runtime doit être détecté
+func isAutoRuntime(runtime string) bool {
+	return runtime == "" || runtime == RuntimeAuto
+}
+
+// useContainerd indique si containerd est le seul runtime disponible sur l'hôte
+func useContainerd(config MonitorConfig) bool {
+	if os.Getenv("DOCKER_HOST") != "" {
+		return false
+	}
+	if _, err := os.Stat(dockerSocketPath); err == nil {
+		return false
+	}
+	if _, ok := DetectPodmanSocket(); ok {
+		return false
+	}
+	_, err := os.Stat(containerdSocketPath(config.ContainerdAddress))
+	return err == nil
+}
@@ -0,0 +1,144 @@
+package ecsazrlc
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+)
+
+// fakeRuntime est un runtime de test sans API Docker
+type fakeRuntime struct {
+	containers []*fakeContainer
+	events     chan events.Message
+}
+
+func (r *fakeRuntime) Name() string { return "fake" }
+
+func (r *fakeRuntime) find(containerID string) *fakeContainer {
+	for _, c := range r.containers {
+		if strings.HasPrefix(c.ID, containerID) {
+			return c
+		}
+	}
+	return nil
+}
+
+func (r *fakeRuntime) List(ctx context.Context) ([]container.Summary, error) {
+	var list []container.Summary
+	for _, c := range r.containers {
+		list = append(list, container.Summary{ID: c.ID, Names: []string{"/" + c.Name}, Image: c.Image, Labels: c.Labels, State: "running"})
+	}
+	return list, nil
+}
+
+func (r *fakeRuntime) Inspect(ctx context.Context, containerID string) (container.InspectResponse, error) {
+	c := r.find(containerID)
+	if c == nil {
+		return container.InspectResponse{}, errors.New("no such container")
+	}
+	return container.InspectResponse{
+		ContainerJSONBase: &container.ContainerJSONBase{ID: c.ID, Name: "/" + c.Name, State: &container.State{Running: true}},
+		Config:            &container.Config{Image: c.Image, Env: c.Env, Labels: c.Labels},
+	}, nil
+}
+
+func (r *fakeRuntime) Events(ctx context.Context) (<-chan events.Message, <-chan error) {
+	return r.events, make(chan error)
+}
+
+func (r *fakeRuntime) Top(ctx context.Context, containerID string) (container.TopResponse, error) {
+	c := r.find(containerID)
+	if c == nil {
+		return container.TopResponse{}, errors.New("no such container")
+	}
+	top := container.TopResponse{Titles: []string{"PID", "CMD"}}
+	for _, cmd := range c.Processes {
+		top.Processes = append(top.Processes, []string{"1", cmd})
+	}
+	return top, nil
+}
+
+func (r *fakeRuntime) Endpoint(containerID string) string { return "fake" }
+
+func (r *fakeRuntime) Close() error { return nil }
+
+// TestMonitorWithRuntime vérifie que le moniteur fonctionne sur un runtime autre que Docker
+func TestMonitorWithRuntime(t *testing.T) {
+	agent := &fakeContainer{ID: containerdAgentID, Name: "azp-agent-1", Image: "docker.io/library/azp-agent:latest", Processes: []string{"/azp/bin/Agent.Listener run"}}
+	runtime := &fakeRuntime{containers: []*fakeContainer{agent}, events: make(chan events.Message, 1)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	// Les fonctions propres à l'API Docker sont désactivées
+	monitor := newMonitor(ctx, cancel, runtime, MonitorConfig{JobLogPatterns: &LogPatterns{}, Stats: &StatsThresholds{}})
+	if monitor.dockerClient != nil || monitor.logWatcher != nil {
+		t.Fatal("Docker-only features should be disabled without the Docker API")
+	}
+
+	if err := monitor.StartMonitoring(); err != nil {
+		t.Fatalf("StartMonitoring() error: %v", err)
+	}
+	if event := <-monitor.GetActivityChannel(); event.Action != "running" || event.ContainerName != "azp-agent-1" {
+		t.Errorf("Unexpected initial event: %+v", event)
+	}
+
+	states, err := monitor.GetAgentStates()
+	if err != nil {
+		t.Fatalf("GetAgentStates() error: %v", err)
+	}
+	if len(states) != 1 || states[0].Busy {
+		t.Errorf("Agent should be idle, got %+v", states)
+	}
+
+	agent.Processes = append(agent.Processes, "/azp/bin/Agent.Worker spawnclient 3 4")
+	runtime.events <- events.Message{
+		Type:   events.ContainerEventType,
+		Action: events.ActionExecStart,
+		Actor:  events.Actor{ID: containerdAgentID, Attributes: map[string]string{"name": "azp-agent-1", "image": agent.Image, "execID": "3f0c2a9e51d4"}},
+		Time:   time.Now().Unix(),
+	}
+	select {
+	case event := <-monitor.GetActivityChannel():
+		if event.Action != "exec_start" {
+			t.Errorf("Expected exec_start, got %+v", event)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("No activity event received from the runtime events")
+	}
+
+	states, _ = monitor.GetAgentStates()
+	if len(states) != 1 || !states[0].Busy {
+		t.Errorf("Agent should be busy while Agent.Worker runs, got %+v", states)
+	}
+}
+
+// TestMonitorShortContainerID vérifie les identifiants containerd courts, choisis librement avec `ctr run`
+func TestMonitorShortContainerID(t *testing.T) {
+	agent := &fakeContainer{ID: "azp1", Name: "azp1", Image: "docker.io/library/azp-agent:latest", Processes: []string{"/azp/bin/Agent.Listener run"}}
+	runtime := &fakeRuntime{containers: []*fakeContainer{agent}, events: make(chan events.Message, 1)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	monitor := newMonitor(ctx, cancel, runtime, MonitorConfig{JobLogPatterns: &LogPatterns{}, Stats: &StatsThresholds{}})
+
+	agents, err := monitor.GetRunningAzureAgents()
+	if err != nil {
+		t.Fatalf("GetRunningAzureAgents() error: %v", err)
+	}
+	if len(agents) != 1 || agents[0].ContainerID != "azp1" {
+		t.Fatalf("Expected agent azp1, got %+v", agents)
+	}
+
+	states, err := monitor.GetAgentStates()
+	if err != nil {
+		t.Fatalf("GetAgentStates() error: %v", err)
+	}
+	if len(states) != 1 || states[0].Busy {
+		t.Errorf("Agent should be idle, got %+v", states)
+	}
+}
@@ -0,0 +1,257 @@
+package ecsazrlc
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+)
+
+// TerminationMethod est la manière dont l'instance se termine une fois drainée
+type TerminationMethod string
+
+const (
+	TerminationMethodAutoScaling TerminationMethod = "autoscaling" // TerminateInstanceInAutoScalingGroup avec décrément de capacité
+	TerminationMethodHook        TerminationMethod = "hook"        // Commande externe (shutdown, API maison...)
+)
+
+// ParseTerminationMethod valide le nom d'une méthode de terminaison
+func ParseTerminationMethod(value string) (TerminationMethod, error) {
+	switch method := TerminationMethod(value); method {
+	case TerminationMethodAutoScaling, TerminationMethodHook:
+		return method, nil
+	default:
+		return "", fmt.Errorf("unknown termination method %q (autoscaling or hook)", value)
+	}
+}
+
+// Valeurs par défaut de l'auto-terminaison
+const (
+	DefaultSelfTerminateInterval     = 30 * time.Second
+	DefaultSelfTerminateDrainTimeout = 10 * time.Minute
+)
+
+// SelfTerminationConfig contient la configuration de l'auto-terminaison
+type SelfTerminationConfig struct {
+	IdleAfter      time.Duration     // Durée d'inactivité de tous les agents avant de terminer l'instance
+	Interval       time.Duration     // Intervalle de vérification
+	Method         TerminationMethod // Méthode de terminaison
+	HookCommand    string            // Commande shell exécutée avec la méthode "hook"
+	DrainTimeout   time.Duration     // Attente maximale du départ des tâches ECS après le drain
+	RemainingTasks int               // Tâches tolérées après le drain (1 si ecsazrlc tourne lui-même en tâche ECS)
+	DryRun         bool              // Journaliser les étapes sans appeler AWS
+}
+
+// Étapes de l'auto-terminaison
+type terminationPhase int
+
+const (
+	phaseIdleWatch   terminationPhase = iota // Attente de la période d'inactivité
+	phaseDraining                            // Instance en DRAINING, attente du départ des tâches
+	phaseTerminating                         // Terminaison demandée (nouvelle tentative en cas d'échec)
+	phaseTerminated                          // Terminaison acceptée, plus rien à faire
+)
+
+// SelfTerminator termine l'instance lorsqu'elle est restée inactive assez longtemps :
+// drain ECS, attente du départ des tâches puis terminaison EC2
+type SelfTerminator struct {
+	notifier    *ECSNotifier
+	monitor     *Monitor
+	autoscaling *autoscaling.Client
+	config      SelfTerminationConfig
+	mu          sync.Mutex
+	phase       terminationPhase
+	idleSince   time.Time // Début de la période d'inactivité (zéro si active)
+	drainedAt   time.Time // Passage en DRAINING
+	dryRunDone  bool      // Étapes déjà journalisées pour la période d'inactivité en cours
+	stopChan    chan struct{}
+	done        chan struct{}
+}
+
+// NewSelfTerminator crée l'auto-terminaison de l'instance
+func NewSelfTerminator(notifier *ECSNotifier, monitor *Monitor, config SelfTerminationConfig) (*SelfTerminator, error) {
+	cfg, err := loadAWSConfig(notifier.ctx)
+	if err != nil {
+		return nil, err
+	}
+	return newSelfTerminatorWithClient(notifier, monitor, autoscaling.NewFromConfig(cfg), config), nil
+}
+
+// newSelfTerminatorWithClient crée l'auto-terminaison avec un client Auto Scaling existant
+func newSelfTerminatorWithClient(notifier *ECSNotifier, monitor *Monitor, client *autoscaling.Client, config SelfTerminationConfig) *SelfTerminator {
+	if config.Interval <= 0 {
+		config.Interval = DefaultSelfTerminateInterval
+	}
+	if config.DrainTimeout <= 0 {
+		config.DrainTimeout = DefaultSelfTerminateDrainTimeout
+	}
+	if config.Method == "" {
+		config.Method = TerminationMethodAutoScaling
+	}
+	return &SelfTerminator{
+		notifier:    notifier,
+		monitor:     monitor,
+		autoscaling: client,
+		config:      config,
+		stopChan:    make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+}
+
+// Start vérifie périodiquement l'inactivité de l'instance (bloquant jusqu'à Stop)
+func (s *SelfTerminator) Start() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.check(time.Now())
+		case <-s.stopChan:
+			return
+		}
+	}
+}
+
+// Stop arrête l'auto-terminaison
+func (s *SelfTerminator) Stop() {
+	close(s.stopChan)
+	<-s.done
+}
+
+// idle indique si tous les agents sont inactifs et qu'aucun bail n'est détenu ;
+// avec un warm pool, l'instance doit en outre avoir été jugée libérable
+func (s *SelfTerminator) idle() (bool, error) {
+	if len(s.monitor.ActivityHolds()) > 0 {
+		return false, nil
+	}
+	if s.notifier.warmPool != nil && !s.notifier.warmPool.Releasable() {
+		return false, nil
+	}
+	states, err := s.monitor.GetAgentStates()
+	if err != nil {
+		return false, err
+	}
+	for _, state := range states {
+		if state.Busy {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// check fait avancer l'auto-terminaison d'une étape
+func (s *SelfTerminator) check(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.phase == phaseTerminated {
+		return
+	}
+
+	idle, err := s.idle()
+	if err != nil {
+		log.Printf("Error checking agent activity for self-termination: %v", err)
+		return
+	}
+
+	if !idle {
+		s.idleSince = time.Time{}
+		s.dryRunDone = false
+		// Un agent a repris un job avant la terminaison : l'instance est conservée
+		if s.phase == phaseDraining || s.phase == phaseTerminating {
+			log.Printf("Activity resumed while draining for self-termination, cancelling drain")
+			if err := s.notifier.CancelDrain(s.notifier.ctx); err != nil {
+				log.Printf("Error cancelling self-termination drain: %v", err)
+			}
+			s.phase = phaseIdleWatch
+		}
+		return
+	}
+
+	switch s.phase {
+	case phaseIdleWatch:
+		if s.idleSince.IsZero() {
+			s.idleSince = now
+		}
+		idleFor := now.Sub(s.idleSince)
+		if idleFor < s.config.IdleAfter {
+			return
+		}
+		if s.config.DryRun {
+			if !s.dryRunDone {
+				s.dryRunDone = true
+				log.Printf("[DRY RUN] Instance idle for %s: would drain %s, wait up to %s for tasks to leave (%d remaining allowed), then terminate via %s",
+					idleFor.Truncate(time.Second), s.notifier.containerInstanceARN, s.config.DrainTimeout, s.config.RemainingTasks, s.config.Method)
+			}
+			return
+		}
+		log.Printf("Instance idle for %s, draining before self-termination", idleFor.Truncate(time.Second))
+		if err := s.notifier.Drain(s.notifier.ctx); err != nil {
+			log.Printf("Error draining instance for self-termination: %v", err)
+			return
+		}
+		s.drainedAt = now
+		s.phase = phaseDraining
+		fallthrough
+
+	case phaseDraining:
+		instance, err := s.notifier.describeContainerInstance(s.notifier.ctx)
+		if err != nil {
+			log.Printf("Error checking running tasks for self-termination: %v", err)
+			return
+		}
+		running := int(instance.RunningTasksCount)
+		if running > s.config.RemainingTasks {
+			if now.Sub(s.drainedAt) < s.config.DrainTimeout {
+				log.Printf("Waiting for %d task(s) to leave before self-termination", running-s.config.RemainingTasks)
+				return
+			}
+			log.Printf("Warning: %d task(s) still running after %s, terminating anyway", running, s.config.DrainTimeout)
+		}
+		s.phase = phaseTerminating
+		s.notifier.emit(StateTransition{
+			Type:      TransitionInstanceTerminating,
+			Reason:    fmt.Sprintf("idle since %s, terminating via %s", s.idleSince.UTC().Format(time.RFC3339), s.config.Method),
+			Timestamp: now,
+		})
+		fallthrough
+
+	case phaseTerminating:
+		if err := s.terminate(); err != nil {
+			log.Printf("Error terminating instance: %v", err)
+			return
+		}
+		s.phase = phaseTerminated
+	}
+}
+
+// terminate termine l'instance avec la méthode configurée
+func (s *SelfTerminator) terminate() error {
+	switch s.config.Method {
+	case TerminationMethodHook:
+		output, err := s.notifier.runInstanceHook(s.notifier.ctx, s.config.HookCommand)
+		if err != nil {
+			return fmt.Errorf("termination hook failed: %w (output: %s)", err, output)
+		}
+		log.Printf("Termination hook completed: %s", output)
+	default:
+		if s.notifier.instanceID == "" {
+			return fmt.Errorf("EC2 instance ID not set")
+		}
+		_, err := s.autoscaling.TerminateInstanceInAutoScalingGroup(s.notifier.ctx, &autoscaling.TerminateInstanceInAutoScalingGroupInput{
+			InstanceId:                     aws.String(s.notifier.instanceID),
+			ShouldDecrementDesiredCapacity: aws.Bool(true),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to terminate instance in Auto Scaling group: %w", err)
+		}
+		log.Printf("Instance %s termination requested from its Auto Scaling group", s.notifier.instanceID)
+	}
+	return nil
+}
@@ -0,0 +1,294 @@
+package ecsazrlc
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+)
+
+// fakeAutoScaling simule TerminateInstanceInAutoScalingGroup (protocole query) sur un serveur HTTP local
+type fakeAutoScaling struct {
+	mu       sync.Mutex
+	server   *httptest.Server
+	requests []url.Values
+}
+
+func newFakeAutoScaling(t *testing.T) *fakeAutoScaling {
+	t.Helper()
+	f := &fakeAutoScaling{}
+	f.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		values, _ := url.ParseQuery(string(data))
+
+		f.mu.Lock()
+		f.requests = append(f.requests, values)
+		f.mu.Unlock()
+
+		w.Header().Set("Content-Type", "text/xml")
+		io.WriteString(w, `<TerminateInstanceInAutoScalingGroupResponse><TerminateInstanceInAutoScalingGroupResult><Activity><ActivityId>test</ActivityId><StatusCode>InProgress</StatusCode></Activity></TerminateInstanceInAutoScalingGroupResult><ResponseMetadata><RequestId>test</RequestId></ResponseMetadata></TerminateInstanceInAutoScalingGroupResponse>`)
+	}))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func (f *fakeAutoScaling) client() *autoscaling.Client {
+	return autoscaling.New(autoscaling.Options{
+		Region:           "us-east-1",
+		BaseEndpoint:     aws.String(f.server.URL),
+		Credentials:      aws.AnonymousCredentials{},
+		RetryMaxAttempts: 1,
+	})
+}
+
+// received retourne les requêtes reçues
+func (f *fakeAutoScaling) received() []url.Values {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]url.Values(nil), f.requests...)
+}
+
+// terminationFixture regroupe les faux services utilisés par les tests d'auto-terminaison
+type terminationFixture struct {
+	ecs         *fakeECS
+	docker      *fakeDocker
+	autoscaling *fakeAutoScaling
+	agent       *fakeContainer
+	sink        *recordingSink
+	terminator  *SelfTerminator
+	mu          sync.Mutex
+	tasks       int
+}
+
+// newTerminationFixture crée une instance avec un agent inactif et deux tâches ECS
+func newTerminationFixture(t *testing.T, config SelfTerminationConfig) *terminationFixture {
+	t.Helper()
+	f := &terminationFixture{ecs: newFakeECS(t), autoscaling: newFakeAutoScaling(t), sink: &recordingSink{}, tasks: 2}
+	f.ecs.handle("DescribeContainerInstances", func(body map[string]interface{}) interface{} {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		instance := fakeInstance("arn:instance", "i-123", "DRAINING", nil)
+		instance["runningTasksCount"] = f.tasks
+		return map[string]interface{}{"containerInstances": []interface{}{instance}}
+	})
+
+	f.agent = &fakeContainer{ID: "aaaaaaaaaaaa0001", Name: "agent", Image: "azp-agent", Processes: []string{"Agent.Listener"}}
+	f.docker = newFakeDocker(t, f.agent)
+
+	notifier := newTestNotifier(t, f.ecs)
+	notifier.SetTransitionSink(f.sink)
+	f.terminator = newSelfTerminatorWithClient(notifier, f.docker.monitor(t, MonitorConfig{}), f.autoscaling.client(), config)
+	return f
+}
+
+// setTasks change le nombre de tâches ECS en cours sur l'instance
+func (f *terminationFixture) setTasks(tasks int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.tasks = tasks
+}
+
+// setBusy démarre ou termine un job sur l'agent
+func (f *terminationFixture) setBusy(busy bool) {
+	f.docker.mu.Lock()
+	defer f.docker.mu.Unlock()
+	f.agent.Processes = []string{"Agent.Listener"}
+	if busy {
+		f.agent.Processes = append(f.agent.Processes, "Agent.Worker")
+	}
+}
+
+// drainStates retourne les statuts demandés via UpdateContainerInstancesState
+func (f *terminationFixture) drainStates() []string {
+	var states []string
+	for _, call := range f.ecs.callsTo("UpdateContainerInstancesState") {
+		states = append(states, call.Body["status"].(string))
+	}
+	return states
+}
+
+// TestParseTerminationMethod vérifie la validation des méthodes de terminaison
+func TestParseTerminationMethod(t *testing.T) {
+	for _, value := range []string{"autoscaling", "hook"} {
+		if method, err := ParseTerminationMethod(value); err != nil || string(method) != value {
+			t.Errorf("ParseTerminationMethod(%q) = %q, %v", value, method, err)
+		}
+	}
+	if _, err := ParseTerminationMethod("shutdown"); err == nil {
+		t.Error("ParseTerminationMethod(\"shutdown\") should fail")
+	}
+}
+
+// TestSelfTerminateAutoScaling vérifie l'enchaînement drain, attente des tâches et terminaison
+func TestSelfTerminateAutoScaling(t *testing.T) {
+	f := newTerminationFixture(t, SelfTerminationConfig{IdleAfter: 15 * time.Minute, RemainingTasks: 1})
+	start := time.Now()
+
+	// Pas encore inactive assez longtemps
+	f.terminator.check(start)
+	f.terminator.check(start.Add(10 * time.Minute))
+	if states := f.drainStates(); len(states) != 0 {
+		t.Fatalf("Instance should not be drained before the idle period, got %v", states)
+	}
+
+	// Drain, puis attente du départ des tâches (une tâche tolérée : ecsazrlc lui-même)
+	f.terminator.check(start.Add(15 * time.Minute))
+	if states := f.drainStates(); len(states) != 1 || states[0] != "DRAINING" {
+		t.Fatalf("Expected the instance to be drained, got %v", states)
+	}
+	if len(f.autoscaling.received()) != 0 {
+		t.Fatal("Instance should not be terminated while tasks are running")
+	}
+
+	f.setTasks(1)
+	f.terminator.check(start.Add(16 * time.Minute))
+	requests := f.autoscaling.received()
+	if len(requests) != 1 {
+		t.Fatalf("Expected 1 Auto Scaling request, got %d", len(requests))
+	}
+	request := requests[0]
+	if request.Get("Action") != "TerminateInstanceInAutoScalingGroup" || request.Get("InstanceId") != "i-123" || request.Get("ShouldDecrementDesiredCapacity") != "true" {
+		t.Errorf("Unexpected termination request: %v", request)
+	}
+	if types := f.sink.types(); len(types) != 2 || types[0] != TransitionInstanceDraining || types[1] != TransitionInstanceTerminating {
+		t.Errorf("Expected InstanceDraining then InstanceTerminating, got %v", types)
+	}
+
+	// Terminaison acceptée : plus aucun appel
+	f.terminator.check(start.Add(17 * time.Minute))
+	if len(f.autoscaling.received()) != 1 {
+		t.Error("Instance should be terminated only once")
+	}
+}
+
+// TestSelfTerminateDrainTimeout vérifie que la terminaison n'attend pas indéfiniment les tâches
+func TestSelfTerminateDrainTimeout(t *testing.T) {
+	f := newTerminationFixture(t, SelfTerminationConfig{IdleAfter: time.Minute, DrainTimeout: 5 * time.Minute})
+	start := time.Now()
+
+	f.terminator.check(start)
+	f.terminator.check(start.Add(time.Minute))
+	f.terminator.check(start.Add(5 * time.Minute))
+	if len(f.autoscaling.received()) != 0 {
+		t.Fatal("Instance should wait for tasks until the drain timeout")
+	}
+	f.terminator.check(start.Add(6 * time.Minute))
+	if len(f.autoscaling.received()) != 1 {
+		t.Error("Instance should be terminated once the drain timeout has elapsed")
+	}
+}
+
+// TestSelfTerminateCancelledByActivity vérifie qu'un job repris pendant le drain conserve l'instance
+func TestSelfTerminateCancelledByActivity(t *testing.T) {
+	f := newTerminationFixture(t, SelfTerminationConfig{IdleAfter: time.Minute})
+	start := time.Now()
+
+	f.terminator.check(start)
+	f.terminator.check(start.Add(time.Minute))
+	f.setBusy(true)
+	f.terminator.check(start.Add(2 * time.Minute))
+	if states := f.drainStates(); len(states) != 2 || states[1] != "ACTIVE" {
+		t.Fatalf("Expected the drain to be cancelled, got %v", states)
+	}
+
+	// Le décompte d'inactivité repart de zéro
+	f.setBusy(false)
+	f.setTasks(0)
+	f.terminator.check(start.Add(3 * time.Minute))
+	f.terminator.check(start.Add(3*time.Minute + 30*time.Second))
+	if len(f.autoscaling.received()) != 0 || len(f.drainStates()) != 2 {
+		t.Fatal("A new idle period should be required before terminating")
+	}
+	f.terminator.check(start.Add(4 * time.Minute))
+	if len(f.autoscaling.received()) != 1 {
+		t.Error("Instance should be terminated after a new idle period")
+	}
+}
+
+// TestSelfTerminateHeldByLease vérifie qu'un bail d'activité empêche la terminaison
+func TestSelfTerminateHeldByLease(t *testing.T) {
+	f := newTerminationFixture(t, SelfTerminationConfig{IdleAfter: time.Minute})
+	f.terminator.monitor.AddActivitySource(&fakeActivitySource{holds: []ActivityHold{{Source: "lease", ID: "deploy"}}})
+
+	start := time.Now()
+	f.terminator.check(start)
+	f.terminator.check(start.Add(time.Hour))
+	if len(f.drainStates()) != 0 {
+		t.Error("Instance holding a lease should not be drained")
+	}
+}
+
+// TestSelfTerminateDryRun vérifie qu'aucune API AWS n'est appelée en mode simulation
+func TestSelfTerminateDryRun(t *testing.T) {
+	f := newTerminationFixture(t, SelfTerminationConfig{IdleAfter: time.Minute, DryRun: true})
+	start := time.Now()
+
+	f.terminator.check(start)
+	f.terminator.check(start.Add(time.Minute))
+	f.terminator.check(start.Add(time.Hour))
+	if calls := f.ecs.callsTo("UpdateContainerInstancesState"); len(calls) != 0 || len(f.ecs.callsTo("DescribeContainerInstances")) != 0 {
+		t.Errorf("Dry run should not call ECS, got %d updates", len(calls))
+	}
+	if len(f.autoscaling.received()) != 0 || len(f.sink.types()) != 0 {
+		t.Error("Dry run should neither terminate nor emit transitions")
+	}
+	if !f.terminator.dryRunDone {
+		t.Error("Dry run should have logged the intended steps")
+	}
+}
+
+// TestSelfTerminateHook vérifie la terminaison par commande externe
+func TestSelfTerminateHook(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "terminated")
+	f := newTerminationFixture(t, SelfTerminationConfig{
+		IdleAfter:   time.Minute,
+		Method:      TerminationMethodHook,
+		HookCommand: `echo "$ECSAZRLC_INSTANCE_ID" > ` + output,
+	})
+	f.setTasks(0)
+
+	start := time.Now()
+	f.terminator.check(start)
+	f.terminator.check(start.Add(time.Minute))
+
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatalf("Termination hook did not run: %v", err)
+	}
+	if strings.TrimSpace(string(data)) != "i-123" {
+		t.Errorf("Unexpected hook environment: %q", data)
+	}
+	if len(f.autoscaling.received()) != 0 {
+		t.Error("Hook method should not call Auto Scaling")
+	}
+}
+
+// TestSelfTerminateKeptWarm vérifie qu'une instance gardée au chaud par le warm pool n'est pas terminée
+func TestSelfTerminateKeptWarm(t *testing.T) {
+	f := newTerminationFixture(t, SelfTerminationConfig{IdleAfter: time.Minute})
+	pool := &WarmPool{}
+	f.terminator.notifier.SetWarmPool(pool)
+
+	start := time.Now()
+	f.terminator.check(start)
+	f.terminator.check(start.Add(time.Hour))
+	if len(f.drainStates()) != 0 {
+		t.Fatal("Instance kept warm should not be drained")
+	}
+
+	pool.releasable = true
+	f.terminator.check(start.Add(2 * time.Hour))
+	f.terminator.check(start.Add(2*time.Hour + time.Minute))
+	if states := f.drainStates(); len(states) != 1 || states[0] != "DRAINING" {
+		t.Errorf("Releasable instance should be drained, got %v", states)
+	}
+}
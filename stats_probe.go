@@ -0,0 +1,228 @@
+package ecsazrlc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// StatsThresholds définit quand la consommation de ressources d'un agent signale un job
+type StatsThresholds struct {
+	CPUPercent         float64       // Pourcentage CPU (100 = un cœur) ; 0 pour ignorer
+	BlockIOBytesPerSec float64       // Débit disque lecture + écriture ; 0 pour ignorer
+	NetworkBytesPerSec float64       // Débit réseau reçu + émis ; 0 pour ignorer
+	Window             time.Duration // Durée pendant laquelle un seuil doit être dépassé
+	MinInterval        time.Duration // Intervalle minimal entre deux relevés d'un même conteneur
+}
+
+// DefaultStatsThresholds retourne des seuils adaptés à un agent inactif qui interroge Azure DevOps
+func DefaultStatsThresholds() StatsThresholds {
+	return StatsThresholds{
+		CPUPercent:  20,
+		Window:      time.Minute,
+		MinInterval: 15 * time.Second,
+	}
+}
+
+// statsSample est un relevé cumulé des compteurs d'un conteneur
+type statsSample struct {
+	At           time.Time
+	CPUTotal     uint64 // Temps CPU cumulé du conteneur (ns)
+	SystemCPU    uint64 // Temps CPU cumulé de l'hôte (ns, 0 si indisponible)
+	OnlineCPUs   uint32
+	BlockIOBytes uint64
+	NetworkBytes uint64
+}
+
+// statsRates sont les débits calculés entre deux relevés
+type statsRates struct {
+	CPUPercent         float64
+	BlockIOBytesPerSec float64
+	NetworkBytesPerSec float64
+}
+
+// rates calcule les débits entre un relevé précédent et celui-ci
+func (s statsSample) rates(previous statsSample) statsRates {
+	elapsed := s.At.Sub(previous.At).Seconds()
+	if elapsed <= 0 {
+		return statsRates{}
+	}
+
+	var rates statsRates
+	cpuDelta := float64(counterDelta(s.CPUTotal, previous.CPUTotal))
+	if systemDelta := float64(counterDelta(s.SystemCPU, previous.SystemCPU)); systemDelta > 0 && s.OnlineCPUs > 0 {
+		rates.CPUPercent = cpuDelta / systemDelta * float64(s.OnlineCPUs) * 100
+	} else {
+		// Sans temps CPU de l'hôte (Windows, certains cgroups) : rapport au temps écoulé
+		rates.CPUPercent = cpuDelta / (elapsed * float64(time.Second)) * 100
+	}
+	rates.BlockIOBytesPerSec = float64(counterDelta(s.BlockIOBytes, previous.BlockIOBytes)) / elapsed
+	rates.NetworkBytesPerSec = float64(counterDelta(s.NetworkBytes, previous.NetworkBytes)) / elapsed
+	return rates
+}
+
+// counterDelta retourne l'accroissement d'un compteur (0 s'il a été réinitialisé)
+func counterDelta(current, previous uint64) uint64 {
+	if current < previous {
+		return 0
+	}
+	return current - previous
+}
+
+// newStatsSample extrait les compteurs utiles d'une réponse de l'API stats
+func newStatsSample(stats container.StatsResponse, at time.Time) statsSample {
+	sample := statsSample{
+		At:         at,
+		CPUTotal:   stats.CPUStats.CPUUsage.TotalUsage,
+		SystemCPU:  stats.CPUStats.SystemUsage,
+		OnlineCPUs: stats.CPUStats.OnlineCPUs,
+	}
+	if sample.OnlineCPUs == 0 {
+		sample.OnlineCPUs = uint32(len(stats.CPUStats.CPUUsage.PercpuUsage))
+	}
+	for _, entry := range stats.BlkioStats.IoServiceBytesRecursive {
+		if op := strings.ToLower(entry.Op); op == "read" || op == "write" {
+			sample.BlockIOBytes += entry.Value
+		}
+	}
+	// Windows ne renseigne pas blkio_stats
+	sample.BlockIOBytes += stats.StorageStats.ReadSizeBytes + stats.StorageStats.WriteSizeBytes
+	for _, network := range stats.Networks {
+		sample.NetworkBytes += network.RxBytes + network.TxBytes
+	}
+	return sample
+}
+
+// statsProbe déduit l'occupation d'un agent de sa consommation de ressources.
+// Utilisée en dernier recours, lorsque les autres sondes ne savent pas se prononcer.
+type statsProbe struct {
+	thresholds StatsThresholds
+	stats      func(ctx context.Context, containerID string) (container.StatsResponse, error)
+	now        func() time.Time
+	mu         sync.Mutex
+	samples    map[string][]statsSample // Fenêtre glissante par conteneur
+}
+
+// newStatsProbe crée une sonde basée sur ContainerStats
+func newStatsProbe(m *Monitor, thresholds StatsThresholds) *statsProbe {
+	if thresholds.Window <= 0 {
+		thresholds.Window = time.Minute
+	}
+	if thresholds.MinInterval <= 0 {
+		thresholds.MinInterval = 15 * time.Second
+	}
+	return &statsProbe{
+		thresholds: thresholds,
+		stats: func(ctx context.Context, containerID string) (container.StatsResponse, error) {
+			cli := m.dockerClientFor(containerID)
+			if cli == nil {
+				return container.StatsResponse{}, fmt.Errorf("no Docker API endpoint for container %s", containerID)
+			}
+			var reader container.StatsResponseReader
+			err := m.dockerCall(containerID, CapabilityStats, func() (err error) {
+				reader, err = cli.ContainerStatsOneShot(ctx, containerID)
+				return err
+			})
+			if err != nil {
+				return container.StatsResponse{}, err
+			}
+			defer reader.Body.Close()
+
+			var stats container.StatsResponse
+			if err := json.NewDecoder(reader.Body).Decode(&stats); err != nil {
+				return container.StatsResponse{}, fmt.Errorf("failed to decode stats: %w", err)
+			}
+			return stats, nil
+		},
+		now:     time.Now,
+		samples: map[string][]statsSample{},
+	}
+}
+
+// Name retourne le nom de la sonde
+func (p *statsProbe) Name() string {
+	return "stats"
+}
+
+// Probe relève les compteurs du conteneur (au plus une fois par MinInterval) et évalue la fenêtre
+func (p *statsProbe) Probe(ctx context.Context, agent ActivityEvent) (ProbeResult, error) {
+	now := p.now()
+
+	p.mu.Lock()
+	window := p.samples[agent.ContainerID]
+	due := len(window) == 0 || now.Sub(window[len(window)-1].At) >= p.thresholds.MinInterval
+	p.mu.Unlock()
+
+	if due {
+		stats, err := p.stats(ctx, agent.ContainerID)
+		if errors.Is(err, ErrCapabilityUnavailable) {
+			return ProbeResult{}, nil
+		}
+		if err != nil {
+			return ProbeResult{}, fmt.Errorf("failed to read container stats: %w", err)
+		}
+		window = p.record(agent.ContainerID, newStatsSample(stats, now))
+	}
+
+	return p.evaluate(window, now), nil
+}
+
+// record ajoute un relevé à la fenêtre d'un conteneur et oublie les conteneurs disparus
+func (p *statsProbe) record(containerID string, sample statsSample) []statsSample {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	window := append(p.samples[containerID], sample)
+	// Conserver le plus récent relevé antérieur à la fenêtre pour la couvrir entièrement
+	start := 0
+	for start+1 < len(window) && sample.At.Sub(window[start+1].At) >= p.thresholds.Window {
+		start++
+	}
+	window = append([]statsSample(nil), window[start:]...)
+	p.samples[containerID] = window
+
+	for id, other := range p.samples {
+		if sample.At.Sub(other[len(other)-1].At) > 2*p.thresholds.Window {
+			delete(p.samples, id)
+		}
+	}
+	return window
+}
+
+// evaluate détermine si les seuils sont dépassés sur toute la fenêtre
+func (p *statsProbe) evaluate(window []statsSample, now time.Time) ProbeResult {
+	if len(window) < 2 || now.Sub(window[0].At) < p.thresholds.Window {
+		// Fenêtre incomplète
+		return ProbeResult{}
+	}
+
+	// Débit minimal de chaque métrique sur la fenêtre
+	lowest := statsRates{CPUPercent: math.Inf(1), BlockIOBytesPerSec: math.Inf(1), NetworkBytesPerSec: math.Inf(1)}
+	for i := 1; i < len(window); i++ {
+		rates := window[i].rates(window[i-1])
+		lowest.CPUPercent = math.Min(lowest.CPUPercent, rates.CPUPercent)
+		lowest.BlockIOBytesPerSec = math.Min(lowest.BlockIOBytesPerSec, rates.BlockIOBytesPerSec)
+		lowest.NetworkBytesPerSec = math.Min(lowest.NetworkBytesPerSec, rates.NetworkBytesPerSec)
+	}
+
+	span := window[len(window)-1].At.Sub(window[0].At).Truncate(time.Second)
+	switch {
+	case p.thresholds.CPUPercent > 0 && lowest.CPUPercent >= p.thresholds.CPUPercent:
+		return ProbeResult{Known: true, Busy: true, Reason: fmt.Sprintf("cpu above %.0f%% for %s (min %.1f%%)", p.thresholds.CPUPercent, span, lowest.CPUPercent)}
+	case p.thresholds.BlockIOBytesPerSec > 0 && lowest.BlockIOBytesPerSec >= p.thresholds.BlockIOBytesPerSec:
+		return ProbeResult{Known: true, Busy: true, Reason: fmt.Sprintf("block io above %.0f B/s for %s (min %.0f B/s)", p.thresholds.BlockIOBytesPerSec, span, lowest.BlockIOBytesPerSec)}
+	case p.thresholds.NetworkBytesPerSec > 0 && lowest.NetworkBytesPerSec >= p.thresholds.NetworkBytesPerSec:
+		return ProbeResult{Known: true, Busy: true, Reason: fmt.Sprintf("network above %.0f B/s for %s (min %.0f B/s)", p.thresholds.NetworkBytesPerSec, span, lowest.NetworkBytesPerSec)}
+	}
+
+	last := window[len(window)-1].rates(window[len(window)-2])
+	return ProbeResult{Known: true, Busy: false, Reason: fmt.Sprintf("usage below thresholds for %s (cpu %.1f%%, block io %.0f B/s, network %.0f B/s)",
+		span, last.CPUPercent, last.BlockIOBytesPerSec, last.NetworkBytesPerSec)}
+}
@@ -0,0 +1,108 @@
+package ecsazrlc
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// cpuStats construit une réponse stats avec des compteurs CPU et réseau cumulés
+func cpuStats(cpuTotal, system, network uint64) container.StatsResponse {
+	return container.StatsResponse{
+		CPUStats: container.CPUStats{
+			CPUUsage:    container.CPUUsage{TotalUsage: cpuTotal},
+			SystemUsage: system,
+			OnlineCPUs:  2,
+		},
+		Networks: map[string]container.NetworkStats{"eth0": {RxBytes: network}},
+	}
+}
+
+// TestStatsProbeWindow vérifie la détection sur fenêtre glissante et la limitation des relevés
+func TestStatsProbeWindow(t *testing.T) {
+	now := time.Unix(1000, 0)
+	calls := 0
+	var next container.StatsResponse
+
+	probe := newStatsProbe(nil, StatsThresholds{CPUPercent: 50, Window: 30 * time.Second, MinInterval: 10 * time.Second})
+	probe.now = func() time.Time { return now }
+	probe.stats = func(ctx context.Context, containerID string) (container.StatsResponse, error) {
+		calls++
+		return next, nil
+	}
+	agent := ActivityEvent{ContainerID: "aaaaaaaaaaaa", ContainerName: "runner"}
+
+	// Chaque pas : 10 s, l'hôte consomme 20 s CPU (2 cœurs), le conteneur 8 s -> 80 %
+	step := func(cpu, system uint64) ProbeResult {
+		next = cpuStats(cpu, system, 0)
+		result, err := probe.Probe(context.Background(), agent)
+		if err != nil {
+			t.Fatalf("Probe() error: %v", err)
+		}
+		return result
+	}
+
+	if result := step(0, 0); result.Known {
+		t.Error("A single sample must not be conclusive")
+	}
+
+	// Relevé trop rapproché : pas d'appel à Docker
+	now = now.Add(time.Second)
+	probe.Probe(context.Background(), agent)
+	if calls != 1 {
+		t.Errorf("Expected sampling to be rate limited, got %d calls", calls)
+	}
+
+	var result ProbeResult
+	cpu, system := uint64(0), uint64(0)
+	for i := 0; i < 3; i++ {
+		now = now.Add(10 * time.Second)
+		cpu += 8e9
+		system += 20e9
+		result = step(cpu, system)
+	}
+	if !result.Known || !result.Busy || !strings.Contains(result.Reason, "cpu") {
+		t.Fatalf("Expected busy on cpu, got %+v", result)
+	}
+
+	// Un seul intervalle sous le seuil suffit à ne plus être occupé
+	now = now.Add(10 * time.Second)
+	system += 20e9
+	result = step(cpu, system)
+	if !result.Known || result.Busy {
+		t.Errorf("Expected idle once usage drops, got %+v", result)
+	}
+}
+
+// TestStatsSampleRates vérifie le calcul des débits
+func TestStatsSampleRates(t *testing.T) {
+	start := time.Unix(0, 0)
+	previous := newStatsSample(cpuStats(0, 0, 1000), start)
+	current := newStatsSample(cpuStats(5e8, 0, 3000), start.Add(2*time.Second))
+	current.BlockIOBytes = 4096
+
+	rates := current.rates(previous)
+	if rates.CPUPercent != 25 {
+		t.Errorf("CPU percent without host time = %v, want 25", rates.CPUPercent)
+	}
+	if rates.NetworkBytesPerSec != 1000 || rates.BlockIOBytesPerSec != 2048 {
+		t.Errorf("Unexpected IO rates: %+v", rates)
+	}
+}
+
+// TestStatsProbeDocker vérifie la lecture des stats via l'API Docker
+func TestStatsProbeDocker(t *testing.T) {
+	fake := newFakeDocker(t, &fakeContainer{ID: "aaaaaaaaaaaa0001", Name: "runner", Image: "azp-runner", Stats: cpuStats(42, 100, 7)})
+	probe := newStatsProbe(fake.monitor(t, MonitorConfig{}), DefaultStatsThresholds())
+
+	stats, err := probe.stats(context.Background(), "aaaaaaaaaaaa")
+	if err != nil {
+		t.Fatalf("stats() error: %v", err)
+	}
+	if stats.CPUStats.CPUUsage.TotalUsage != 42 || stats.Networks["eth0"].RxBytes != 7 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
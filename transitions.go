@@ -0,0 +1,199 @@
+package ecsazrlc
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// TransitionType identifie un changement d'état d'un agent ou de l'instance
+type TransitionType string
+
+const (
+	TransitionAgentBusy           TransitionType = "AgentBusy"
+	TransitionAgentIdle           TransitionType = "AgentIdle"
+	TransitionInstanceBusy        TransitionType = "InstanceBusy"
+	TransitionInstanceIdle        TransitionType = "InstanceIdle"
+	TransitionInstanceDraining    TransitionType = "InstanceDraining"
+	TransitionProtectionCapped    TransitionType = "ProtectionCapped"
+	TransitionInstanceTerminating TransitionType = "InstanceTerminating"
+	TransitionAgentStarted        TransitionType = "AgentStarted"
+	TransitionAgentStopped        TransitionType = "AgentStopped"
+	TransitionAgentOOMKilled      TransitionType = "AgentOOMKilled"
+	TransitionAgentRestarted      TransitionType = "AgentRestarted"
+	TransitionJobLongRunning      TransitionType = "JobLongRunning"
+	TransitionJobOverdue          TransitionType = "JobOverdue"
+	TransitionJobStarted          TransitionType = "JobStarted"
+	TransitionJobFinished         TransitionType = "JobFinished"
+)
+
+// StateTransition décrit une transition d'état observée
+type StateTransition struct {
+	Type          TransitionType
+	ContainerID   string // Vide pour les transitions de l'instance
+	ContainerName string
+	ImageName     string
+	Reason        string
+	JobName       string // Transitions de job uniquement
+	JobResult     string // Résultat du job (JobFinished)
+	BusyAgents    int
+	IdleAgents    int
+	Timestamp     time.Time
+}
+
+// TransitionSink reçoit les transitions d'état
+type TransitionSink interface {
+	HandleTransition(transition StateTransition)
+}
+
+// AddTransitionSink abonne un récepteur aux transitions du moniteur
+func (m *Monitor) AddTransitionSink(sink TransitionSink) {
+	m.sinksMu.Lock()
+	defer m.sinksMu.Unlock()
+	m.transitionSinks = append(m.transitionSinks, sink)
+}
+
+// HandleTransition diffuse une transition à tous les récepteurs abonnés.
+// Le moniteur est lui-même un TransitionSink, ce qui permet aux autres composants
+// (notificateur ECS, ...) de publier leurs transitions par son intermédiaire.
+func (m *Monitor) HandleTransition(transition StateTransition) {
+	if transition.Timestamp.IsZero() {
+		transition.Timestamp = time.Now()
+	}
+
+	m.sinksMu.Lock()
+	sinks := append([]TransitionSink(nil), m.transitionSinks...)
+	m.sinksMu.Unlock()
+
+	log.Printf("[TRANSITION] %s %s %s", transition.Type, transition.ContainerName, transition.Reason)
+	for _, sink := range sinks {
+		sink.HandleTransition(transition)
+	}
+}
+
+// transitionTracker calcule les transitions entre deux relevés d'état successifs
+type transitionTracker struct {
+	agents           map[string]AgentState
+	longRunningSent  map[string]bool // Alerte "job long" déjà émise pour la période en cours
+	longRunningAfter time.Duration   // 0 pour désactiver la détection des jobs longs
+	instanceBusy     *bool
+}
+
+// newTransitionTracker crée un suivi de transitions vide
+func newTransitionTracker(longRunningAfter time.Duration) *transitionTracker {
+	return &transitionTracker{
+		agents:           map[string]AgentState{},
+		longRunningSent:  map[string]bool{},
+		longRunningAfter: longRunningAfter,
+	}
+}
+
+// update compare un nouveau relevé au précédent et retourne les transitions
+func (t *transitionTracker) update(states []AgentState, now time.Time) []StateTransition {
+	var transitions []StateTransition
+	current := make(map[string]AgentState, len(states))
+	busyAgents, idleAgents := 0, 0
+
+	for _, state := range states {
+		current[state.ContainerID] = state
+		if state.Busy {
+			busyAgents++
+		} else {
+			idleAgents++
+		}
+
+		previous, known := t.agents[state.ContainerID]
+		switch {
+		case state.Busy && (!known || !previous.Busy):
+			transitions = append(transitions, agentTransition(TransitionAgentBusy, state, state.Reason, now))
+		case !state.Busy && known && previous.Busy:
+			t.clearBusy(state.ContainerID)
+			transitions = append(transitions, agentTransition(TransitionAgentIdle, state, state.Reason, now))
+		}
+
+		// Job occupé depuis plus longtemps que le seuil configuré, mesuré sur BusySince du relevé
+		if state.Busy && t.longRunningAfter > 0 && !t.longRunningSent[state.ContainerID] {
+			if busyFor := state.JobDuration(now); busyFor >= t.longRunningAfter {
+				t.longRunningSent[state.ContainerID] = true
+				reason := fmt.Sprintf("busy for %s", busyFor.Truncate(time.Second))
+				transitions = append(transitions, agentTransition(TransitionJobLongRunning, state, reason, now))
+			}
+		}
+	}
+
+	// Un agent occupé qui disparaît est considéré comme redevenu inactif
+	for id, previous := range t.agents {
+		if _, still := current[id]; !still && previous.Busy {
+			t.clearBusy(id)
+			transitions = append(transitions, agentTransition(TransitionAgentIdle, previous, "agent stopped", now))
+		}
+	}
+	t.agents = current
+
+	instanceBusy := busyAgents > 0
+	if t.instanceBusy == nil || *t.instanceBusy != instanceBusy {
+		transitionType := TransitionInstanceIdle
+		if instanceBusy {
+			transitionType = TransitionInstanceBusy
+		}
+		transitions = append(transitions, StateTransition{
+			Type:       transitionType,
+			BusyAgents: busyAgents,
+			IdleAgents: idleAgents,
+			Timestamp:  now,
+		})
+		t.instanceBusy = &instanceBusy
+	}
+
+	for i := range transitions {
+		transitions[i].BusyAgents = busyAgents
+		transitions[i].IdleAgents = idleAgents
+	}
+	return transitions
+}
+
+// clearBusy réarme l'alerte "job long" d'un agent
+func (t *transitionTracker) clearBusy(containerID string) {
+	delete(t.longRunningSent, containerID)
+}
+
+// agentTransition construit une transition pour un agent
+func agentTransition(transitionType TransitionType, state AgentState, reason string, now time.Time) StateTransition {
+	return StateTransition{
+		Type:          transitionType,
+		ContainerID:   state.ContainerID,
+		ContainerName: state.ContainerName,
+		ImageName:     state.ImageName,
+		Reason:        reason,
+		Timestamp:     now,
+	}
+}
+
+// WatchTransitions relève périodiquement l'état des agents et diffuse les transitions.
+// S'arrête avec le moniteur.
+func (m *Monitor) WatchTransitions(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	tracker := newTransitionTracker(m.longRunningAfter)
+	check := func() {
+		states, err := m.GetAgentStates()
+		if err != nil {
+			log.Printf("Error checking agent states for transitions: %v", err)
+			return
+		}
+		for _, transition := range tracker.update(states, time.Now()) {
+			m.HandleTransition(transition)
+		}
+	}
+
+	check()
+	for {
+		select {
+		case <-ticker.C:
+			check()
+		case <-m.ctx.Done():
+			return
+		}
+	}
+}
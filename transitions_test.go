@@ -0,0 +1,160 @@
+package ecsazrlc
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingSink mémorise les transitions reçues
+type recordingSink struct {
+	mu          sync.Mutex
+	transitions []StateTransition
+}
+
+func (s *recordingSink) HandleTransition(transition StateTransition) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.transitions = append(s.transitions, transition)
+}
+
+// types retourne les types des transitions reçues
+func (s *recordingSink) types() []TransitionType {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var types []TransitionType
+	for _, transition := range s.transitions {
+		types = append(types, transition.Type)
+	}
+	return types
+}
+
+// agentState construit un état d'agent de test
+func agentState(id string, busy bool) AgentState {
+	return AgentState{ActivityEvent: ActivityEvent{ContainerID: id, ContainerName: "agent-" + id}, Busy: busy}
+}
+
+// TestTransitionTracker vérifie le calcul des transitions entre relevés
+func TestTransitionTracker(t *testing.T) {
+	tracker := newTransitionTracker(0)
+	now := time.Now()
+
+	steps := []struct {
+		name     string
+		states   []AgentState
+		expected []TransitionType
+	}{
+		{
+			name:     "Initial idle snapshot",
+			states:   []AgentState{agentState("a", false)},
+			expected: []TransitionType{TransitionInstanceIdle},
+		},
+		{
+			name:     "Agent picks up a job",
+			states:   []AgentState{agentState("a", true)},
+			expected: []TransitionType{TransitionAgentBusy, TransitionInstanceBusy},
+		},
+		{
+			name:     "No change",
+			states:   []AgentState{agentState("a", true)},
+			expected: nil,
+		},
+		{
+			name:     "Second agent busy",
+			states:   []AgentState{agentState("a", true), agentState("b", true)},
+			expected: []TransitionType{TransitionAgentBusy},
+		},
+		{
+			name:     "First agent finishes, second stops",
+			states:   []AgentState{agentState("a", false)},
+			expected: []TransitionType{TransitionAgentIdle, TransitionAgentIdle, TransitionInstanceIdle},
+		},
+	}
+
+	for _, step := range steps {
+		transitions := tracker.update(step.states, now)
+		if len(transitions) != len(step.expected) {
+			t.Fatalf("%s: got %d transitions %+v, want %v", step.name, len(transitions), transitions, step.expected)
+		}
+		for i, transition := range transitions {
+			if transition.Type != step.expected[i] {
+				t.Errorf("%s: transition %d = %s, want %s", step.name, i, transition.Type, step.expected[i])
+			}
+		}
+	}
+}
+
+// TestMonitorHandleTransition vérifie la diffusion des transitions aux récepteurs
+func TestMonitorHandleTransition(t *testing.T) {
+	monitor := &Monitor{}
+	first, second := &recordingSink{}, &recordingSink{}
+	monitor.AddTransitionSink(first)
+	monitor.AddTransitionSink(second)
+
+	monitor.HandleTransition(StateTransition{Type: TransitionInstanceDraining})
+
+	for _, sink := range []*recordingSink{first, second} {
+		if len(sink.transitions) != 1 || sink.transitions[0].Timestamp.IsZero() {
+			t.Errorf("Expected one timestamped transition, got %+v", sink.transitions)
+		}
+	}
+}
+
+// TestTransitionTrackerLongRunning vérifie l'alerte unique pour un job trop long
+func TestTransitionTrackerLongRunning(t *testing.T) {
+	tracker := newTransitionTracker(time.Hour)
+	start := time.Now()
+
+	// busyAt construit un relevé occupé dont la période a commencé à since
+	busyAt := func(since time.Time) []AgentState {
+		state := agentState("a", true)
+		state.BusySince = since
+		return []AgentState{state}
+	}
+
+	tracker.update(busyAt(start), start)
+
+	var longRunning int
+	for _, offset := range []time.Duration{30 * time.Minute, 61 * time.Minute, 2 * time.Hour} {
+		for _, transition := range tracker.update(busyAt(start), start.Add(offset)) {
+			if transition.Type == TransitionJobLongRunning {
+				longRunning++
+			}
+		}
+	}
+	if longRunning != 1 {
+		t.Errorf("Expected exactly one JobLongRunning transition, got %d", longRunning)
+	}
+
+	// Un nouveau job réarme l'alerte
+	tracker.update([]AgentState{agentState("a", false)}, start.Add(3*time.Hour))
+	tracker.update(busyAt(start.Add(4*time.Hour)), start.Add(4*time.Hour))
+	transitions := tracker.update(busyAt(start.Add(4*time.Hour)), start.Add(6*time.Hour))
+	if len(transitions) != 1 || transitions[0].Type != TransitionJobLongRunning {
+		t.Errorf("Expected JobLongRunning for the new job, got %+v", transitions)
+	}
+}
+
+// TestTransitionTrackerUsesBusySince vérifie que la durée du job vient du relevé, pas du premier passage du suivi
+func TestTransitionTrackerUsesBusySince(t *testing.T) {
+	tracker := newTransitionTracker(time.Hour)
+	now := time.Now()
+
+	// Le suivi démarre alors que le job tourne déjà depuis deux heures
+	state := agentState("a", true)
+	state.BusySince = now.Add(-2 * time.Hour)
+	transitions := tracker.update([]AgentState{state}, now)
+
+	var found bool
+	for _, transition := range transitions {
+		if transition.Type == TransitionJobLongRunning {
+			found = true
+			if transition.Reason != "busy for 2h0m0s" {
+				t.Errorf("Unexpected reason %q", transition.Reason)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("Expected JobLongRunning from BusySince, got %+v", transitions)
+	}
+}
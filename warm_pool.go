@@ -0,0 +1,230 @@
+package ecsazrlc
+
+import (
+	"hash/fnv"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+// Attribut ECS publié avec le nombre d'agents inactifs de l'instance (mode warm pool)
+const attrIdleAgents = "azure-agent-idle-agents"
+
+// DefaultWarmPoolStaleAfter est l'âge au-delà duquel le relevé d'une autre instance est ignoré
+const DefaultWarmPoolStaleAfter = 5 * time.Minute
+
+// WarmPoolConfig contient la configuration du maintien d'agents inactifs dans le cluster
+type WarmPoolConfig struct {
+	MinIdle    int           // Agents inactifs à conserver sur les autres instances avant de se libérer
+	Interval   time.Duration // Intervalle d'évaluation du cluster
+	StaleAfter time.Duration // Âge maximal du relevé d'une autre instance pour que ses agents comptent
+}
+
+// WarmPool décide, sans leader, si une instance dont tous les agents sont inactifs peut être
+// libérée : elle ne se signale inactive que si les autres instances conservent au moins
+// MinIdle agents inactifs. Chaque instance publie ses agents inactifs dans un attribut ECS
+// et évalue le cluster avec un décalage qui lui est propre, pour que deux instances ne se
+// libèrent pas au même moment en comptant chacune sur les agents de l'autre.
+type WarmPool struct {
+	notifier   *ECSNotifier
+	monitor    *Monitor
+	config     WarmPoolConfig
+	mu         sync.Mutex
+	idleAgents int  // Agents inactifs de l'instance au dernier relevé
+	releasable bool // Dernière décision de l'évaluation du cluster
+	stopChan   chan struct{}
+	done       chan struct{}
+}
+
+// NewWarmPool crée le maintien d'agents inactifs ; à enregistrer avec ECSNotifier.SetWarmPool
+func NewWarmPool(notifier *ECSNotifier, monitor *Monitor, config WarmPoolConfig) *WarmPool {
+	if config.Interval <= 0 {
+		config.Interval = notifier.heartbeatInterval
+	}
+	if config.StaleAfter <= 0 {
+		config.StaleAfter = DefaultWarmPoolStaleAfter
+	}
+	return &WarmPool{
+		notifier: notifier,
+		monitor:  monitor,
+		config:   config,
+		stopChan: make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start évalue périodiquement le cluster, après un décalage propre à l'instance (bloquant jusqu'à Stop)
+func (p *WarmPool) Start() {
+	defer close(p.done)
+
+	select {
+	case <-time.After(p.offset()):
+	case <-p.stopChan:
+		return
+	}
+
+	ticker := time.NewTicker(p.config.Interval)
+	defer ticker.Stop()
+
+	p.evaluate(time.Now())
+	for {
+		select {
+		case <-ticker.C:
+			p.evaluate(time.Now())
+		case <-p.stopChan:
+			return
+		}
+	}
+}
+
+// Stop arrête l'évaluation
+func (p *WarmPool) Stop() {
+	close(p.stopChan)
+	<-p.done
+}
+
+// offset retourne le décalage de l'évaluation, dérivé de l'ARN de l'instance : les instances
+// démarrées ensemble (scale-out) évaluent le cluster à des moments différents
+func (p *WarmPool) offset() time.Duration {
+	hash := fnv.New32a()
+	hash.Write([]byte(p.notifier.containerInstanceARN))
+	return time.Duration(uint64(hash.Sum32()) % uint64(p.config.Interval))
+}
+
+// localActivity relève l'activité de l'instance : agents occupés ou maintiens d'activité, et agents inactifs
+func (p *WarmPool) localActivity() (busy bool, idle int, err error) {
+	if len(p.monitor.ActivityHolds()) > 0 {
+		busy = true
+	}
+	states, err := p.monitor.GetAgentStates()
+	if err != nil {
+		return false, 0, err
+	}
+	for _, state := range states {
+		switch {
+		case state.Released:
+			// Job bloqué dont la protection est libérée : ni occupé ni disponible
+		case state.Busy:
+			busy = true
+		default:
+			idle++
+		}
+	}
+	return busy, idle, nil
+}
+
+// Active indique l'activité à signaler à ECS. L'activité locale est relevée à chaque appel ;
+// la libération d'une instance inactive n'est décidée que par l'évaluation décalée du cluster.
+func (p *WarmPool) Active() (bool, error) {
+	busy, idle, err := p.localActivity()
+	if err != nil {
+		return false, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.idleAgents = idle
+	switch {
+	case busy:
+		p.releasable = false
+		return true, nil
+	case idle == 0:
+		// Aucun agent à garder au chaud
+		return false, nil
+	default:
+		return !p.releasable, nil
+	}
+}
+
+// Releasable indique si la dernière évaluation autorise la libération de l'instance
+func (p *WarmPool) Releasable() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.releasable
+}
+
+// IdleAgents retourne le nombre d'agents inactifs de l'instance au dernier relevé
+func (p *WarmPool) IdleAgents() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.idleAgents
+}
+
+// evaluate compte les agents inactifs conservés ailleurs dans le cluster et publie
+// immédiatement une décision de libération, pour que les autres instances en tiennent compte
+func (p *WarmPool) evaluate(now time.Time) {
+	busy, idle, err := p.localActivity()
+	if err != nil {
+		log.Printf("Error checking agent activity for warm pool: %v", err)
+		return
+	}
+
+	releasable := false
+	if !busy && idle > 0 {
+		elsewhere, err := p.idleElsewhere(now)
+		if err != nil {
+			// Sans vue du cluster, l'instance reste au chaud
+			log.Printf("Error reading cluster idle agents for warm pool: %v", err)
+		} else {
+			releasable = elsewhere >= p.config.MinIdle
+			log.Printf("Warm pool: %d idle agent(s) here, %d kept elsewhere (min %d)", idle, elsewhere, p.config.MinIdle)
+		}
+	}
+
+	p.mu.Lock()
+	changed := releasable != p.releasable
+	p.releasable = releasable
+	p.idleAgents = idle
+	p.mu.Unlock()
+
+	// L'activité locale et l'absence d'agents sont signalées par le heartbeat
+	if !changed || busy || idle == 0 {
+		return
+	}
+	if releasable {
+		log.Printf("Warm pool: enough idle agents elsewhere, instance releasable")
+	} else {
+		log.Printf("Warm pool: instance kept warm")
+	}
+	if err := p.notifier.SendActivitySignal(!releasable); err != nil {
+		log.Printf("Error sending activity signal: %v", err)
+	}
+}
+
+// idleElsewhere additionne les agents inactifs des autres instances qui restent dans le cluster :
+// instances ACTIVE, signalées actives et dont le relevé est récent
+func (p *WarmPool) idleElsewhere(now time.Time) (int, error) {
+	instances, err := listClusterInstances(p.notifier.ctx, p.notifier.ecsClient, p.notifier.clusterName)
+	if err != nil {
+		return 0, err
+	}
+
+	total := 0
+	for _, instance := range instances {
+		if aws.ToString(instance.ContainerInstanceArn) == p.notifier.containerInstanceARN {
+			continue
+		}
+		if aws.ToString(instance.Status) != string(types.ContainerInstanceStatusActive) {
+			continue
+		}
+		// Une instance signalée inactive est en passe d'être libérée, ses agents ne comptent pas
+		if classifyInstance(instance, now, p.config.StaleAfter).Verdict != VerdictBusy {
+			continue
+		}
+		value, ok := instanceAttribute(instance, attrIdleAgents)
+		if !ok {
+			continue
+		}
+		count, err := strconv.Atoi(value)
+		if err != nil || count < 0 {
+			log.Printf("Warning: invalid %s value %q on %s", attrIdleAgents, value, aws.ToString(instance.ContainerInstanceArn))
+			continue
+		}
+		total += count
+	}
+	return total, nil
+}
@@ -0,0 +1,160 @@
+package ecsazrlc
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// warmFixture regroupe les faux services utilisés par les tests du warm pool
+type warmFixture struct {
+	ecs    *fakeECS
+	docker *fakeDocker
+	pool   *WarmPool
+	mu     sync.Mutex
+	others []map[string]interface{}
+}
+
+// newWarmFixture crée une instance avec deux agents inactifs et un warm pool de deux agents
+func newWarmFixture(t *testing.T) *warmFixture {
+	t.Helper()
+	f := &warmFixture{ecs: newFakeECS(t)}
+	f.ecs.handle("ListContainerInstances", func(body map[string]interface{}) interface{} {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		arns := []string{"arn:self"}
+		for _, instance := range f.others {
+			arns = append(arns, instance["containerInstanceArn"].(string))
+		}
+		return map[string]interface{}{"containerInstanceArns": arns}
+	})
+	f.ecs.handle("DescribeContainerInstances", func(body map[string]interface{}) interface{} {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		instances := []interface{}{fakeInstance("arn:self", "i-self", "ACTIVE", map[string]string{attrActivity: "active", attrIdleAgents: "2"})}
+		for _, instance := range f.others {
+			instances = append(instances, instance)
+		}
+		return map[string]interface{}{"containerInstances": instances}
+	})
+
+	f.docker = newFakeDocker(t,
+		&fakeContainer{ID: "aaaaaaaaaaaa0001", Name: "agent-1", Image: "azp-agent", Processes: []string{"Agent.Listener"}},
+		&fakeContainer{ID: "bbbbbbbbbbbb0002", Name: "agent-2", Image: "azp-agent", Processes: []string{"Agent.Listener"}},
+	)
+	notifier := newTestNotifier(t, f.ecs)
+	notifier.containerInstanceARN = "arn:self"
+	notifier.heartbeatInterval = 30 * time.Second
+	f.pool = NewWarmPool(notifier, f.docker.monitor(t, MonitorConfig{}), WarmPoolConfig{MinIdle: 2})
+	notifier.SetWarmPool(f.pool)
+	return f
+}
+
+// setOthers définit les autres instances du cluster
+func (f *warmFixture) setOthers(instances ...map[string]interface{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.others = instances
+}
+
+// otherInstance construit une autre instance du cluster avec ses attributs d'activité
+func otherInstance(arn, status, activity string, idle int, lastCheck time.Time) map[string]interface{} {
+	return fakeInstance(arn, "i-"+arn, status, map[string]string{
+		attrActivity:   activity,
+		attrLastCheck:  fmt.Sprintf("%d", lastCheck.Unix()),
+		attrIdleAgents: fmt.Sprintf("%d", idle),
+	})
+}
+
+// TestWarmPoolIdleElsewhere vérifie que seules les instances qui restent dans le cluster comptent
+func TestWarmPoolIdleElsewhere(t *testing.T) {
+	f := newWarmFixture(t)
+	now := time.Now()
+	f.setOthers(
+		otherInstance("arn:kept", "ACTIVE", "active", 1, now),
+		otherInstance("arn:releasing", "ACTIVE", "inactive", 3, now),
+		otherInstance("arn:draining", "DRAINING", "active", 3, now),
+		otherInstance("arn:stale", "ACTIVE", "active", 3, now.Add(-time.Hour)),
+		otherInstance("arn:busy", "ACTIVE", "active", 2, now),
+	)
+
+	idle, err := f.pool.idleElsewhere(now)
+	if err != nil {
+		t.Fatalf("idleElsewhere() error: %v", err)
+	}
+	if idle != 3 {
+		t.Errorf("Expected 3 idle agents elsewhere, got %d", idle)
+	}
+}
+
+// TestWarmPoolRelease vérifie qu'une instance inactive n'est libérée que si le cluster garde assez d'agents
+func TestWarmPoolRelease(t *testing.T) {
+	f := newWarmFixture(t)
+	now := time.Now()
+
+	// Un seul agent inactif ailleurs : l'instance reste au chaud
+	f.setOthers(otherInstance("arn:other", "ACTIVE", "active", 1, now))
+	f.pool.evaluate(now)
+	if f.pool.Releasable() {
+		t.Fatal("Instance should be kept warm with 1 idle agent elsewhere")
+	}
+	if active, err := f.pool.Active(); err != nil || !active {
+		t.Errorf("Instance kept warm should be reported active, got %v (%v)", active, err)
+	}
+	if calls := f.ecs.callsTo("PutAttributes"); len(calls) != 0 {
+		t.Errorf("No signal should be sent while the decision is unchanged, got %d", len(calls))
+	}
+
+	// Deux agents inactifs ailleurs : la décision est publiée immédiatement
+	f.setOthers(otherInstance("arn:other", "ACTIVE", "active", 2, now))
+	f.pool.evaluate(now)
+	if !f.pool.Releasable() {
+		t.Fatal("Instance should be releasable with 2 idle agents elsewhere")
+	}
+	calls := f.ecs.callsTo("PutAttributes")
+	if len(calls) != 1 {
+		t.Fatalf("Expected 1 PutAttributes call, got %d", len(calls))
+	}
+	if values := attributeValues(calls[0]); values[attrActivity] != "inactive" || values[attrIdleAgents] != "2" {
+		t.Errorf("Unexpected attributes: %v", values)
+	}
+	if active, _ := f.pool.Active(); active {
+		t.Error("Releasable instance should be reported inactive")
+	}
+
+	// Un job démarre : l'instance redevient active et doit être réévaluée
+	f.docker.mu.Lock()
+	f.docker.containers[0].Processes = []string{"Agent.Listener", "Agent.Worker"}
+	f.docker.mu.Unlock()
+	if active, _ := f.pool.Active(); !active {
+		t.Error("Busy instance should be reported active")
+	}
+	if f.pool.Releasable() {
+		t.Error("Busy instance should no longer be releasable")
+	}
+}
+
+// TestWarmPoolClusterError vérifie que l'instance reste au chaud sans vue du cluster
+func TestWarmPoolClusterError(t *testing.T) {
+	f := newWarmFixture(t)
+	f.setOthers(otherInstance("arn:other", "ACTIVE", "active", 5, time.Now()))
+	f.ecs.server.Close()
+	f.pool.evaluate(time.Now())
+	if f.pool.Releasable() {
+		t.Error("Instance should be kept warm when the cluster cannot be read")
+	}
+}
+
+// TestWarmPoolOffset vérifie que le décalage est stable et borné par l'intervalle
+func TestWarmPoolOffset(t *testing.T) {
+	pool := &WarmPool{notifier: &ECSNotifier{containerInstanceARN: "arn:a"}, config: WarmPoolConfig{Interval: time.Minute}}
+	offset := pool.offset()
+	if offset < 0 || offset >= time.Minute || offset != pool.offset() {
+		t.Errorf("Unexpected offset %v", offset)
+	}
+	other := &WarmPool{notifier: &ECSNotifier{containerInstanceARN: "arn:b"}, config: WarmPoolConfig{Interval: time.Minute}}
+	if other.offset() == offset {
+		t.Error("Different instances should get different offsets")
+	}
+}
@@ -0,0 +1,266 @@
+package ecsazrlc
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// En-têtes ajoutés à chaque requête webhook
+const (
+	WebhookSignatureHeader = "X-Ecsazrlc-Signature"
+	WebhookEventHeader     = "X-Ecsazrlc-Event"
+)
+
+// defaultWebhookTemplate envoie le detail de l'événement tel quel, au format JSON
+const defaultWebhookTemplate = `{{ json . }}`
+
+// WebhookConfig contient la configuration du webhook sortant
+type WebhookConfig struct {
+	URL            string            // URL cible (POST)
+	Headers        map[string]string // En-têtes supplémentaires
+	Secret         string            // Secret de signature HMAC-SHA256 (optionnel)
+	Template       string            // Modèle text/template du corps (JSON du detail par défaut)
+	Transitions    []TransitionType  // Transitions à envoyer (toutes si vide)
+	MaxRetries     int               // Nombre de nouvelles tentatives après un échec
+	Backoff        time.Duration     // Délai avant la première nouvelle tentative (doublé ensuite)
+	Timeout        time.Duration     // Délai maximal d'une requête
+	DeadLetterFile string            // Fichier recevant les envois abandonnés (optionnel)
+	ClusterName    string
+	InstanceID     string
+}
+
+// WebhookPayload est la donnée passée au modèle du webhook
+type WebhookPayload struct {
+	TransitionEventDetail
+	DetailType string `json:"detailType"`
+}
+
+// deadLetter est une entrée du fichier de lettres mortes
+type deadLetter struct {
+	Time       time.Time `json:"time"`
+	URL        string    `json:"url"`
+	Transition string    `json:"transition"`
+	Payload    string    `json:"payload"`
+	Error      string    `json:"error"`
+}
+
+// WebhookSink envoie les transitions sélectionnées vers un webhook HTTP
+type WebhookSink struct {
+	config     WebhookConfig
+	template   *template.Template
+	filter     map[TransitionType]bool
+	httpClient *http.Client
+	queue      chan StateTransition
+	stopChan   chan struct{}
+	done       chan struct{}
+	deadMu     sync.Mutex
+}
+
+// NewWebhookSink crée un récepteur webhook après validation du modèle
+func NewWebhookSink(config WebhookConfig) (*WebhookSink, error) {
+	if config.URL == "" {
+		return nil, fmt.Errorf("webhook URL is required")
+	}
+	if config.Template == "" {
+		config.Template = defaultWebhookTemplate
+	}
+	if config.Backoff <= 0 {
+		config.Backoff = time.Second
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+
+	tmpl, err := template.New("webhook").Funcs(template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			data, err := json.Marshal(v)
+			return string(data), err
+		},
+	}).Parse(config.Template)
+	if err != nil {
+		return nil, fmt.Errorf("invalid webhook template: %w", err)
+	}
+
+	filter := map[TransitionType]bool{}
+	for _, transitionType := range config.Transitions {
+		filter[transitionType] = true
+	}
+
+	return &WebhookSink{
+		config:     config,
+		template:   tmpl,
+		filter:     filter,
+		httpClient: &http.Client{Timeout: config.Timeout},
+		queue:      make(chan StateTransition, eventQueueSize),
+		stopChan:   make(chan struct{}),
+		done:       make(chan struct{}),
+	}, nil
+}
+
+// HandleTransition met en file les transitions sélectionnées
+func (s *WebhookSink) HandleTransition(transition StateTransition) {
+	if len(s.filter) > 0 && !s.filter[transition.Type] {
+		return
+	}
+	select {
+	case s.queue <- transition:
+	default:
+		log.Printf("Warning: webhook queue full, dropping %s event", transition.Type)
+	}
+}
+
+// Start envoie les transitions en file (bloquant jusqu'à Stop)
+func (s *WebhookSink) Start() {
+	defer close(s.done)
+	for {
+		select {
+		case transition := <-s.queue:
+			s.deliver(transition)
+
+		case <-s.stopChan:
+			for {
+				select {
+				case transition := <-s.queue:
+					s.deliver(transition)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// render produit le corps de la requête à partir du modèle
+func (s *WebhookSink) render(transition StateTransition) ([]byte, error) {
+	payload := WebhookPayload{
+		TransitionEventDetail: newTransitionEventDetail(transition, s.config.ClusterName, s.config.InstanceID),
+		DetailType:            transitionDetailType(transition.Type),
+	}
+
+	var body bytes.Buffer
+	if err := s.template.Execute(&body, payload); err != nil {
+		return nil, fmt.Errorf("failed to render webhook payload: %w", err)
+	}
+	return body.Bytes(), nil
+}
+
+// deliver envoie une transition en réessayant avec un délai exponentiel
+func (s *WebhookSink) deliver(transition StateTransition) {
+	body, err := s.render(transition)
+	if err != nil {
+		s.deadLetter(transition, nil, err)
+		return
+	}
+
+	backoff := s.config.Backoff
+	for attempt := 0; ; attempt++ {
+		retryable, err := s.post(transition, body)
+		if err == nil {
+			return
+		}
+
+		if !retryable || attempt >= s.config.MaxRetries {
+			log.Printf("Error delivering %s webhook after %d attempt(s): %v", transition.Type, attempt+1, err)
+			s.deadLetter(transition, body, err)
+			return
+		}
+
+		log.Printf("Retrying %s webhook in %v: %v", transition.Type, backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-s.stopChan:
+			// Arrêt demandé : réessayer sans attendre
+		}
+		backoff *= 2
+	}
+}
+
+// post effectue la requête HTTP ; retourne si l'erreur justifie une nouvelle tentative
+func (s *WebhookSink) post(transition StateTransition, body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, s.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range s.config.Headers {
+		req.Header.Set(name, value)
+	}
+	req.Header.Set(WebhookEventHeader, string(transition.Type))
+	if s.config.Secret != "" {
+		req.Header.Set(WebhookSignatureHeader, "sha256="+signPayload(s.config.Secret, body))
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	default:
+		return false, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+}
+
+// signPayload calcule la signature HMAC-SHA256 hexadécimale du corps
+func signPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// deadLetter ajoute un envoi abandonné au fichier de lettres mortes
+func (s *WebhookSink) deadLetter(transition StateTransition, body []byte, cause error) {
+	if s.config.DeadLetterFile == "" {
+		return
+	}
+
+	line, err := json.Marshal(deadLetter{
+		Time:       time.Now().UTC(),
+		URL:        s.config.URL,
+		Transition: string(transition.Type),
+		Payload:    string(body),
+		Error:      cause.Error(),
+	})
+	if err != nil {
+		log.Printf("Error encoding webhook dead letter: %v", err)
+		return
+	}
+
+	s.deadMu.Lock()
+	defer s.deadMu.Unlock()
+
+	file, err := os.OpenFile(s.config.DeadLetterFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		log.Printf("Error opening webhook dead letter file: %v", err)
+		return
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		log.Printf("Error writing webhook dead letter: %v", err)
+	}
+}
+
+// Stop arrête le récepteur après avoir traité les transitions en file
+func (s *WebhookSink) Stop() {
+	close(s.stopChan)
+	<-s.done
+}
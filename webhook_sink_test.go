@@ -0,0 +1,149 @@
+package ecsazrlc
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// webhookRequest enregistre une requête reçue par le serveur de test
+type webhookRequest struct {
+	Header http.Header
+	Body   string
+}
+
+// newWebhookServer démarre un serveur répondant avec les statuts donnés, puis 200
+func newWebhookServer(t *testing.T, statuses ...int) (*httptest.Server, func() []webhookRequest) {
+	t.Helper()
+	var mu sync.Mutex
+	var requests []webhookRequest
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		requests = append(requests, webhookRequest{Header: r.Header.Clone(), Body: string(body)})
+		status := http.StatusOK
+		if len(requests) <= len(statuses) {
+			status = statuses[len(requests)-1]
+		}
+		mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, func() []webhookRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]webhookRequest(nil), requests...)
+	}
+}
+
+// TestWebhookSinkTemplateAndSignature vérifie le rendu du modèle, les en-têtes et la signature
+func TestWebhookSinkTemplateAndSignature(t *testing.T) {
+	server, requests := newWebhookServer(t)
+
+	sink, err := NewWebhookSink(WebhookConfig{
+		URL:         server.URL,
+		Headers:     map[string]string{"Authorization": "Bearer token"},
+		Secret:      "s3cret",
+		Template:    `{"text": {{ json (printf "%s on %s (%s)" .DetailType .InstanceID .ContainerName) }}}`,
+		Transitions: []TransitionType{TransitionAgentStarted},
+		ClusterName: "test-cluster",
+		InstanceID:  "i-123",
+	})
+	if err != nil {
+		t.Fatalf("NewWebhookSink() error: %v", err)
+	}
+	go sink.Start()
+
+	sink.HandleTransition(StateTransition{Type: TransitionAgentBusy, ContainerName: "agent-1"})
+	sink.HandleTransition(StateTransition{Type: TransitionAgentStarted, ContainerName: "agent-1", Timestamp: time.Now()})
+	sink.Stop()
+
+	received := requests()
+	if len(received) != 1 {
+		t.Fatalf("Expected only the selected transition to be sent, got %d request(s)", len(received))
+	}
+
+	request := received[0]
+	if request.Body != `{"text": "Agent Started on i-123 (agent-1)"}` {
+		t.Errorf("Unexpected payload: %s", request.Body)
+	}
+	if request.Header.Get("Authorization") != "Bearer token" || request.Header.Get(WebhookEventHeader) != "AgentStarted" {
+		t.Errorf("Unexpected headers: %v", request.Header)
+	}
+	if request.Header.Get(WebhookSignatureHeader) != "sha256="+signPayload("s3cret", []byte(request.Body)) {
+		t.Errorf("Invalid signature header: %s", request.Header.Get(WebhookSignatureHeader))
+	}
+}
+
+// TestWebhookSinkDefaultPayload vérifie le corps JSON par défaut
+func TestWebhookSinkDefaultPayload(t *testing.T) {
+	server, requests := newWebhookServer(t)
+
+	sink, err := NewWebhookSink(WebhookConfig{URL: server.URL, ClusterName: "test-cluster"})
+	if err != nil {
+		t.Fatalf("NewWebhookSink() error: %v", err)
+	}
+	go sink.Start()
+	sink.HandleTransition(StateTransition{Type: TransitionInstanceDraining, Reason: "drain", Timestamp: time.Now()})
+	sink.Stop()
+
+	var payload WebhookPayload
+	if err := json.Unmarshal([]byte(requests()[0].Body), &payload); err != nil {
+		t.Fatalf("Invalid default payload: %v", err)
+	}
+	if payload.DetailType != "Instance Draining" || payload.ClusterName != "test-cluster" || payload.Reason != "drain" {
+		t.Errorf("Unexpected payload: %+v", payload)
+	}
+}
+
+// TestWebhookSinkRetryAndDeadLetter vérifie les nouvelles tentatives et le fichier de lettres mortes
+func TestWebhookSinkRetryAndDeadLetter(t *testing.T) {
+	server, requests := newWebhookServer(t, http.StatusServiceUnavailable, http.StatusBadRequest)
+	deadLetterFile := filepath.Join(t.TempDir(), "dead.jsonl")
+
+	sink, err := NewWebhookSink(WebhookConfig{
+		URL:            server.URL,
+		MaxRetries:     3,
+		Backoff:        time.Millisecond,
+		DeadLetterFile: deadLetterFile,
+	})
+	if err != nil {
+		t.Fatalf("NewWebhookSink() error: %v", err)
+	}
+	go sink.Start()
+	sink.HandleTransition(StateTransition{Type: TransitionJobLongRunning, Timestamp: time.Now()})
+	sink.Stop()
+
+	// 503 est réessayé, 400 ne l'est pas
+	if len(requests()) != 2 {
+		t.Fatalf("Expected 2 attempts, got %d", len(requests()))
+	}
+
+	data, err := os.ReadFile(deadLetterFile)
+	if err != nil {
+		t.Fatalf("Expected dead letter file: %v", err)
+	}
+	var letter deadLetter
+	if err := json.Unmarshal(data, &letter); err != nil {
+		t.Fatalf("Invalid dead letter: %v", err)
+	}
+	if letter.Transition != "JobLongRunning" || !strings.Contains(letter.Error, "400") {
+		t.Errorf("Unexpected dead letter: %+v", letter)
+	}
+}
+
+// TestNewWebhookSinkInvalidTemplate vérifie le rejet d'un modèle invalide
+func TestNewWebhookSinkInvalidTemplate(t *testing.T) {
+	if _, err := NewWebhookSink(WebhookConfig{URL: "http://localhost", Template: "{{ .Broken "}); err == nil {
+		t.Error("Expected an error for an invalid template")
+	}
+}